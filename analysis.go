@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+// Reads returns the sorted names of the variables the expression reads,
+// identifiers as well as val("name") with a constant name. Variables
+// bound with let() are not included.
+func (c *Compiled) Reads() []string {
+	reads, _ := analyze(c.exp)
+	return sortedKeys(reads)
+}
+
+// Writes returns the sorted names of the variables the expression
+// writes with setVal using constant names.
+func (c *Compiled) Writes() []string {
+	_, writes := analyze(c.exp)
+	return sortedKeys(writes)
+}
+
+// ListVariables returns the sorted names of all variables the
+// expression references without running it, identifiers as well as
+// the constant names of val() and setVal(), e.g. to fetch only the
+// metrics needed. The input is parsed when ParseExpr was not called
+// before, it returns nil on a parser error.
+func (e *Eval) ListVariables() []string {
+	if e.exp == nil && e.ParseExpr() != nil {
+		return nil
+	}
+	reads, writes := analyze(e.exp)
+	for name := range writes {
+		reads[name] = true
+	}
+	return sortedKeys(reads)
+}
+
+// analyze walks exp and collects the variables read and written
+func analyze(exp ast.Expr) (reads, writes map[string]bool) {
+	reads = make(map[string]bool)
+	writes = make(map[string]bool)
+	var walk func(exp ast.Expr, locals map[string]bool)
+	walk = func(exp ast.Expr, locals map[string]bool) {
+		switch exp := exp.(type) {
+		case *ast.Ident:
+			if exp.Name != "true" && exp.Name != "false" && !locals[exp.Name] {
+				reads[exp.Name] = true
+			}
+		case *ast.ParenExpr:
+			walk(exp.X, locals)
+		case *ast.UnaryExpr:
+			walk(exp.X, locals)
+		case *ast.BinaryExpr:
+			walk(exp.X, locals)
+			walk(exp.Y, locals)
+		case *ast.IndexExpr:
+			walk(exp.X, locals)
+			walk(exp.Index, locals)
+		case *ast.SelectorExpr:
+			walk(exp.X, locals)
+		case *ast.CallExpr:
+			args := exp.Args
+			switch resolveName(functionName(exp.Fun)) {
+			case "exists", "val", "valOr":
+				if len(args) >= 1 {
+					if name, ok := constantString(args[0]); ok && !locals[name] {
+						reads[name] = true
+						for _, arg := range args[1:] {
+							walk(arg, locals)
+						}
+						return
+					}
+				}
+			case "setVal":
+				l := len(args)
+				for i, arg := range args {
+					// pairs of name and value or names followed by Values
+					isName := i%2 == 0 && i+1 < l
+					if l%2 == 1 {
+						isName = i < l-1
+					}
+					if name, ok := constantString(arg); ok && isName {
+						writes[name] = true
+						continue
+					}
+					walk(arg, locals)
+				}
+				return
+			case "let":
+				if l := len(args); l >= 3 && l%2 == 1 {
+					scope := make(map[string]bool, len(locals)+l/2)
+					for name := range locals {
+						scope[name] = true
+					}
+					for i := 0; i < l-1; i += 2 {
+						walk(args[i+1], scope)
+						if name, ok := constantString(args[i]); ok {
+							scope[name] = true
+						}
+					}
+					walk(args[l-1], scope)
+					return
+				}
+			}
+			for _, arg := range args {
+				walk(arg, locals)
+			}
+		}
+	}
+	walk(exp, nil)
+	return reads, writes
+}
+
+// constantString returns the value of a string literal
+func constantString(exp ast.Expr) (string, bool) {
+	lit, ok := exp.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	return unquote(lit.Value), true
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadsWrites(t *testing.T) {
+	for _, tc := range []struct {
+		input  string
+		reads  string
+		writes string
+	}{
+		{`(in-out)/in*100 > limit`, "in limit out", ""},
+		{`val("$SYS/b") + round(x, 2)`, "$SYS/b x", ""},
+		{`setVal("a", b * 2, "c", true)`, "b", "a c"},
+		{`setVal("lo", "hi", minMax(x, y))`, "x y", "hi lo"},
+		{`let("x", pow(v, 2), ifExpr(x > 100, 100, x))`, "v", ""},
+		{`let("x", 1, "y", x + z, y)`, "z", ""},
+		{`math.sqrt(a) + str.ellipsis(s, 10) == "" && true`, "a s", ""},
+		{`setVal(name, 1)`, "name", ""},
+	} {
+		c := MustCompile(tc.input)
+		if got := strings.Join(c.Reads(), " "); got != tc.reads {
+			t.Errorf("%s: expected reads %q but got %q", tc.input, tc.reads, got)
+		}
+		if got := strings.Join(c.Writes(), " "); got != tc.writes {
+			t.Errorf("%s: expected writes %q but got %q", tc.input, tc.writes, got)
+		}
+	}
+}
+
+func TestListVariables(t *testing.T) {
+	for input, expected := range map[string][]string{
+		`(in - out) / in * 100 > limit`:             {"in", "limit", "out"},
+		`val("$SYS/b") + val(name)`:                 {"$SYS/b", "name"},
+		`setVal("usage", a / b); usage > 80`:        {"a", "b", "usage"},
+		`let("x", 2, x * y)`:                        {"y"},
+		`sprintf("%s", "no variable") && true`:      {},
+		`round(pow(val("r"), 2) * pi, 0) + rund(1)`: {"pi", "r"},
+	} {
+		if result := New(input).ListVariables(); !reflect.DeepEqual(result, expected) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+	if result := New(`1 +`).ListVariables(); result != nil {
+		t.Errorf("expected nil for a parser error but got %v", result)
+	}
+}
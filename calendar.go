@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"sync"
+	"time"
+)
+
+// HolidayCalendar reports the public holidays of a country or region,
+// see businessDaysBetween() and RegisterHolidayCalendar()
+type HolidayCalendar interface {
+	// IsHoliday returns true when the date of t is a public holiday
+	IsHoliday(t time.Time) bool
+}
+
+// HolidayCalendarFunc adapts an ordinary function to a HolidayCalendar.
+type HolidayCalendarFunc func(t time.Time) bool
+
+// IsHoliday calls f(t)
+func (f HolidayCalendarFunc) IsHoliday(t time.Time) bool {
+	return f(t)
+}
+
+// calendars holds the holiday calendars by name
+var (
+	calendarsMu sync.RWMutex
+	calendars   = map[string]HolidayCalendar{
+		"AT": HolidayCalendarFunc(austrianHoliday),
+	}
+)
+
+// RegisterHolidayCalendar makes cal available as name in
+// businessDaysBetween(), e.g. a calendar with regional holidays
+// or company holidays. The calendar "AT" is included.
+func RegisterHolidayCalendar(name string, cal HolidayCalendar) {
+	calendarsMu.Lock()
+	defer calendarsMu.Unlock()
+	calendars[name] = cal
+}
+
+// holidayCalendar returns the calendar registered as name
+func holidayCalendar(name string) (HolidayCalendar, bool) {
+	calendarsMu.RLock()
+	defer calendarsMu.RUnlock()
+	cal, ok := calendars[name]
+	return cal, ok
+}
+
+// maxCalendarDays limits the span of businessDays(), the
+// holidays of a calendar are checked day by day
+const maxCalendarDays = 1000 * 366
+
+// businessDays counts the weekdays from the day of from up to but
+// excluding the day of to which are no holidays of cal. It is
+// negative when to is before from.
+func businessDays(from, to time.Time, cal HolidayCalendar) int {
+	sign := 1
+	if to.Before(from) {
+		from, to = to, from
+		sign = -1
+	}
+	// the dates in UTC have days of 24 hours
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	days := int((end.Unix() - start.Unix()) / 86400)
+	// whole weeks have 5 weekdays, the rest is counted
+	n := days / 7 * 5
+	for i := days / 7 * 7; i < days; i++ {
+		if weekday(start, i) {
+			n++
+		}
+	}
+	if cal != nil {
+		for i := 0; i < days; i++ {
+			day := time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, from.Location())
+			if weekday(start, i) && cal.IsHoliday(day) {
+				n--
+			}
+		}
+	}
+	return sign * n
+}
+
+// weekday returns true when the day i days after start
+// is Monday to Friday
+func weekday(start time.Time, i int) bool {
+	switch time.Weekday((int(start.Weekday()) + i) % 7) {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+	return true
+}
+
+// austrianHoliday returns true for the public holidays of Austria
+func austrianHoliday(t time.Time) bool {
+	switch m, d := t.Month(), t.Day(); {
+	case m == time.January && (d == 1 || d == 6),
+		m == time.May && d == 1,
+		m == time.August && d == 15,
+		m == time.October && d == 26,
+		m == time.November && d == 1,
+		m == time.December && (d == 8 || d == 25 || d == 26):
+		return true
+	}
+	easter := easterSunday(t.Year())
+	// Easter Monday, Ascension Day, Whit Monday and Corpus Christi
+	for _, offset := range []int{1, 39, 50, 60} {
+		h := easter.AddDate(0, 0, offset)
+		if h.Month() == t.Month() && h.Day() == t.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// easterSunday returns the date of Easter Sunday in the Gregorian
+// calendar using the anonymous Gregorian algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b, c := year/100, year%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEasterSunday(t *testing.T) {
+	for year, want := range map[int]string{
+		2019: "2019-04-21",
+		2024: "2024-03-31",
+		2025: "2025-04-20",
+		2038: "2038-04-25",
+	} {
+		if got := easterSunday(year).Format("2006-01-02"); got != want {
+			t.Errorf("%d: expected %s but got %s", year, want, got)
+		}
+	}
+}
+
+func TestBusinessDaysBetween(t *testing.T) {
+	vienna, _ := time.LoadLocation("Europe/Vienna")
+	epoch := func(date string) float64 {
+		d, _ := time.ParseInLocation("2006-01-02 15:04", date, vienna)
+		return float64(d.Unix())
+	}
+	RegisterHolidayCalendar("company", HolidayCalendarFunc(func(t time.Time) bool {
+		return t.Month() == time.December && t.Day() == 24
+	}))
+	vars := map[string]interface{}{
+		"mon":       epoch("2024-06-10 09:00"),
+		"nextMon":   epoch("2024-06-17 08:00"),
+		"easter":    epoch("2024-03-29 12:00"), // Good Friday, no holiday in AT
+		"afterEast": epoch("2024-04-03 12:00"), // Wednesday
+		"xmas":      epoch("2024-12-23 12:00"),
+		"afterXmas": epoch("2024-12-30 12:00"),
+	}
+	var ok = map[string]interface{}{
+		`businessDaysBetween(mon, nextMon, "AT", "Europe/Vienna")`:         5,
+		`businessDaysBetween(nextMon, mon, "AT", "Europe/Vienna")`:         -5,
+		`businessDaysBetween(mon, mon, "AT", "Europe/Vienna")`:             0,
+		`businessDaysBetween(easter, afterEast, "AT", "Europe/Vienna")`:    2, // Fri, Tue
+		`businessDaysBetween(easter, afterEast)`:                           3,
+		`businessDaysBetween(xmas, afterXmas, "AT", "Europe/Vienna")`:      3, // 23rd, 24th, 27th
+		`businessDaysBetween(xmas, afterXmas, "company", "Europe/Vienna")`: 4,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Variables(vars).Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`businessDaysBetween(mon, nextMon, "XX")`, `businessDaysBetween(mon)`,
+		`businessDaysBetween(mon, "x")`, `businessDaysBetween(mon, nextMon, "AT", "Nowhere/City")`,
+		`businessDaysBetween(0, 1e12, "AT")`, `businessDaysBetween(1e15, 0)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Variables(vars).Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+// TestBusinessDays compares businessDays with counting day by day
+func TestBusinessDays(t *testing.T) {
+	vienna, _ := time.LoadLocation("Europe/Vienna")
+	count := func(from, to time.Time, cal HolidayCalendar) int {
+		n := 0
+		day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+		for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+			if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday && (cal == nil || !cal.IsHoliday(day)) {
+				n++
+			}
+		}
+		return n
+	}
+	from := time.Date(2023, 12, 28, 9, 0, 0, 0, vienna)
+	for _, days := range []int{0, 1, 2, 5, 6, 7, 8, 13, 30, 365, 1000} {
+		to := time.Date(2023, 12, 28+days, 0, 0, 0, 0, vienna)
+		for _, cal := range []HolidayCalendar{nil, HolidayCalendarFunc(austrianHoliday)} {
+			if got, want := businessDays(from, to, cal), count(from, to, cal); got != want {
+				t.Errorf("%d days: expected %d but got %d", days, want, got)
+			}
+			if got, want := businessDays(to, from, cal), -count(from, to, cal); days > 0 && got != want {
+				t.Errorf("-%d days: expected %d but got %d", days, want, got)
+			}
+		}
+	}
+
+	// long spans up to 1000 years are no problem
+	start := time.Now()
+	if n := businessDays(time.Unix(0, 0), time.Unix(999*365*86400, 0), HolidayCalendarFunc(austrianHoliday)); n < 250000 {
+		t.Errorf("expected more than 250000 days but got %d", n)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected a faster count but took %v", d)
+	}
+}
@@ -22,9 +22,22 @@ go build
 ./calc -n 16 -text "Shell calculator result:" -pi 3.141 'sprintf ("%s %.3f",text,pi*n)'
 Shell calculator result: 50.256
 
+./calc --list-functions
+abs(number)                              absolute value of x
+...
+
 */
 
 func main() {
+	if len(os.Args) < 2 {
+		log.Println("usage: calc [-name value ...] expression | --list-functions")
+		os.Exit(1)
+	}
+	if os.Args[1] == "--list-functions" {
+		listFunctions()
+		return
+	}
+
 	// last element of command line
 	toEval := os.Args[len(os.Args)-1]
 
@@ -33,12 +46,20 @@ func main() {
 	e := eval.New(toEval).Variables(opts)
 
 	// execute it
-	if err := e.ParseExpr(); err == nil {
-		fmt.Println(e.Run())
-	} else {
+	result, err := e.RunErr()
+	if err != nil {
 		log.Println(err.Error())
 		os.Exit(1)
 	}
+	fmt.Println(result)
+}
+
+// listFunctions prints the functions with their arguments and a short
+// description, one per line
+func listFunctions() {
+	for _, info := range eval.Functions() {
+		fmt.Printf("%-40s %s\n", info.Signature(), info.Description)
+	}
 }
 
 // parse takes shell args and maps it to key/values
@@ -0,0 +1,174 @@
+package eval
+
+import (
+	"go/ast"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+// Compiled is a parsed expression which can be run many
+// times with different variables. The state of stateful
+// functions like counterInc() is kept between the runs.
+//
+// Example:
+//  var isFast = eval.MustCompile(`val("rtt") < 0.05`)
+//  ...
+//  fast := isFast.MustRun(map[string]interface{}{"rtt": 0.046})
+type Compiled struct {
+	input string
+	exp   ast.Expr
+	// numeric is set for pure numeric expressions, see compileNumeric()
+	numeric *numeric
+	// options copied by Eval.Compile()
+	catalog       Catalog
+	naturalOrder  bool
+	allowSetEnv   bool
+	strict        bool
+	truthy        bool
+	nanPolicy     NaNPolicy
+	missingPolicy MissingPolicy
+	epsilon       float64
+	clock         Clock
+	random        *rand.Rand
+	environ       map[string]string
+	filter        functionFilter
+	functions     map[string]Function
+	// state is kept between runs, a MemoryStore is created
+	// by the first run when no StateStore was set
+	mu    sync.Mutex
+	state StateStore
+}
+
+// Compile parses input and returns a Compiled expression or
+// the parser error.
+func Compile(input string) (*Compiled, error) {
+	e := New(input)
+	if err := e.ParseExpr(); err != nil {
+		return nil, err
+	}
+	return newCompiled(input, e.exp), nil
+}
+
+// newCompiled returns the parsed expression exp of input as Compiled
+func newCompiled(input string, exp ast.Expr) *Compiled {
+	c := &Compiled{input: input, exp: exp}
+	if n, ok := compileNumeric(exp); ok {
+		c.numeric = n
+	}
+	return c
+}
+
+// MustCompile is like Compile but panics if the input cannot
+// be parsed. It simplifies the initialization of package level
+// expressions.
+func MustCompile(input string) *Compiled {
+	c, err := Compile(input)
+	if err != nil {
+		panic(`eval: Compile(` + strconv.Quote(input) + `): ` + err.Error())
+	}
+	return c
+}
+
+// String returns the source text of the expression
+func (c *Compiled) String() string {
+	return c.input
+}
+
+// Run evaluates the expression with the given variables. It returns
+// the result and the first error found while running, e.g. a call
+// of an unknown function.
+//
+// Expressions using only numbers, float64 variables and arithmetic,
+// comparison and logical operators like '(in-out)/in*100 > 80' run on
+// a fast path without allocations.
+func (c *Compiled) Run(variables map[string]interface{}) (interface{}, error) {
+	// strict mode needs the interpreter to report undefined variables,
+	// an epsilon to compare floats
+	if c.numeric != nil && !c.strict && c.epsilon == 0 {
+		if f, ok := c.numeric.run(variables); ok {
+			if c.numeric.isBool {
+				return f != 0, nil
+			}
+			return f, nil
+		}
+	}
+	e := c.newEval(variables)
+	result := e.eval(c.exp)
+	return result, e.err
+}
+
+// Eval evaluates the expression with the given variables like Run but
+// never modifies them, variables written by setVal are dropped after
+// the run. Eval is safe for concurrent use, also with the same map:
+//
+//  c, _ := eval.New(`sprintf("%.1f%%", used/size*100)`).Compile()
+//  for _, disk := range disks {
+//    go report(c.Eval(disk))
+//  }
+//
+// Returns the result, errors are math.NaN() or an empty string like Run.
+func (c *Compiled) Eval(variables map[string]interface{}) interface{} {
+	if c.numeric != nil && !c.strict && c.epsilon == 0 {
+		if f, ok := c.numeric.run(variables); ok {
+			if c.numeric.isBool {
+				return f != 0
+			}
+			return f
+		}
+	}
+	e := c.newEval(variables)
+	e.copyVariables = true
+	return e.eval(c.exp)
+}
+
+// DryRun is like Run but returns the changes of variables and of the
+// StateStore instead of applying them, see Eval.DryRun()
+func (c *Compiled) DryRun(variables map[string]interface{}) (interface{}, []Effect, error) {
+	e := c.newEval(variables)
+	result, effects := e.runDry(c.exp)
+	return result, effects, e.err
+}
+
+// newEval returns an Eval with the options of c running with variables
+func (c *Compiled) newEval(variables map[string]interface{}) *Eval {
+	return &Eval{
+		input:         c.input,
+		exp:           c.exp,
+		variables:     variables,
+		catalog:       c.catalog,
+		naturalOrder:  c.naturalOrder,
+		allowSetEnv:   c.allowSetEnv,
+		strict:        c.strict,
+		truthy:        c.truthy,
+		nanPolicy:     c.nanPolicy,
+		missingPolicy: c.missingPolicy,
+		epsilon:       c.epsilon,
+		clock:         c.clock,
+		random:        c.random,
+		environ:       c.environ,
+		filter:        c.filter,
+		functions:     c.functions,
+		state:         c.stateStore(),
+	}
+}
+
+// stateStore returns the StateStore of c and creates
+// a MemoryStore when there is none
+func (c *Compiled) stateStore() StateStore {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == nil {
+		c.state = NewMemoryStore()
+	}
+	return c.state
+}
+
+// MustRun is like Run but panics on error.
+func (c *Compiled) MustRun(variables map[string]interface{}) interface{} {
+	result, err := c.Run(variables)
+	if err != nil {
+		panic(`eval: Run(` + strconv.Quote(c.input) + `): ` + err.Error())
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package eval
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMustCompile(t *testing.T) {
+	c := MustCompile(`round(pow(val("r"),2) * pi,0)`)
+	result := c.MustRun(map[string]interface{}{"r": 120, "pi": 3.14159})
+	if result != 45239.0 {
+		t.Errorf("Expected 45239 from %s as output but got %v", c, result)
+	}
+
+	// the same expression again with other variables
+	result = c.MustRun(map[string]interface{}{"r": 1, "pi": 3.14159})
+	if result != 3.0 {
+		t.Errorf("Expected 3 from %s as output but got %v", c, result)
+	}
+
+	var panics = map[string]func(){
+		"compile": func() { MustCompile(`round(1,`) },
+		"run":     func() { MustCompile(`rund(3.14,2)`).MustRun(nil) },
+	}
+	for name, f := range panics {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s should panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+func TestEvalCompile(t *testing.T) {
+	twice := func(args ...interface{}) (interface{}, error) {
+		return args[0].(float64) * 2, nil
+	}
+	e := New(`ifExpr(a < b, twice(x), 0.0)`).NaturalOrder(true).RegisterFunction("twice", twice)
+	c, err := e.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// later changes of e don't affect c
+	e.NaturalOrder(false).RegisterFunction("twice", nil)
+
+	variables := map[string]interface{}{"a": "eth2", "b": "eth10", "x": 21.0}
+	if result := c.Eval(variables); result != 42.0 {
+		t.Errorf("Expected 42 but got %v", result)
+	}
+	if _, err := New(`1 +`).Compile(); err == nil {
+		t.Error("Expected a parser error")
+	}
+}
+
+func TestCompiledState(t *testing.T) {
+	c := MustCompile(`counterInc("x")`)
+	for i, want := range []float64{1, 2, 3} {
+		if result, err := c.Run(nil); result != want || err != nil {
+			t.Errorf("%d: expected %v but got %v, %v", i, want, result, err)
+		}
+	}
+	if result := c.Eval(nil); result != 4.0 {
+		t.Errorf("expected 4 but got %v", result)
+	}
+	// a dry run doesn't change the state
+	if result, _, _ := c.DryRun(nil); result != 5.0 {
+		t.Errorf("expected 5 but got %v", result)
+	}
+	if result := c.Eval(nil); result != 5.0 {
+		t.Errorf("expected 5 but got %v", result)
+	}
+
+	changed := MustCompile(`changed("k", v)`)
+	for i, v := range []float64{1, 1, 2} {
+		if result := changed.Eval(map[string]interface{}{"v": v}); result != (i == 2) {
+			t.Errorf("%d: expected %v but got %v", i, i == 2, result)
+		}
+	}
+
+	// a StateStore handed to the Eval is shared by its compiled expressions
+	store := NewMemoryStore()
+	c1, _ := New(`counterInc("y")`).StateStore(store).Compile()
+	c2, _ := New(`counterInc("y")`).StateStore(store).Compile()
+	_, _ = c1.Run(nil)
+	if result, _ := c2.Run(nil); result != 2.0 {
+		t.Errorf("expected 2 but got %v", result)
+	}
+}
+
+func TestCompiledEval(t *testing.T) {
+	c := MustCompile(`setVal("sum", a + b)`)
+	variables := map[string]interface{}{"a": 5.0, "b": 6.0}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = c.Eval(variables)
+		}(i)
+	}
+	wg.Wait()
+	for i, result := range results {
+		if result != nil {
+			t.Errorf("%d: expected nil but got %v", i, result)
+		}
+	}
+	// setVal doesn't modify the variables
+	if _, found := variables["sum"]; found || len(variables) != 2 {
+		t.Errorf("Expected unchanged variables but got %v", variables)
+	}
+
+	// fast path
+	if result := MustCompile(`a * b`).Eval(variables); result != 30.0 {
+		t.Errorf("Expected 30 but got %v", result)
+	}
+}
@@ -0,0 +1,73 @@
+package eval
+
+import "go/ast"
+
+// Kinds of Effect
+const (
+	// EffectVariable is a variable set by setVal()
+	EffectVariable = "variable"
+	// EffectState is a key of the StateStore set by stateful functions
+	// like counterInc(), throttle() or cache()
+	EffectState = "state"
+	// EffectEnv is an environment variable set by setEnv()
+	EffectEnv = "env"
+)
+
+// Effect is a change a run would make, recorded instead of applied in
+// dry-run mode, see Eval.DryRun()
+type Effect struct {
+	// Kind is EffectVariable, EffectState or EffectEnv
+	Kind string
+	// Name of the variable, the key of the StateStore or the name of
+	// the environment variable
+	Name  string
+	Value interface{}
+}
+
+// dryRun holds the effects of a run in dry-run mode and the values of
+// the StateStore written while running
+type dryRun struct {
+	effects []Effect
+	state   map[string]interface{}
+	// scopes is the number of scopes when the run started
+	scopes int
+}
+
+// DryRun is like RunErr but changes neither the variables nor the
+// StateStore nor the environment of the process, e.g. to preview a
+// changed rule against production data. The changes which a run would
+// make are returned in the order they happened instead. Within the run
+// the changes are visible as usual, 'x = 1; x * 2' results in 2.
+func (e *Eval) DryRun() (interface{}, []Effect, error) {
+	if e.exp == nil {
+		if err := e.ParseExpr(); err != nil {
+			return FloatError, nil, err
+		}
+	}
+	e.err = nil
+	result, effects := e.runDry(e.exp)
+	return result, effects, e.err
+}
+
+// runDry evaluates exp in dry-run mode. Variables are set in a scope of
+// their own which is dropped afterwards.
+func (e *Eval) runDry(exp ast.Expr) (interface{}, []Effect) {
+	scopes := e.scopes
+	// the full slice expression keeps append from writing into scopes
+	e.scopes = append(scopes[:len(scopes):len(scopes)], make(map[string]interface{}))
+	e.dry = &dryRun{state: make(map[string]interface{}), scopes: len(e.scopes)}
+	result := e.eval(exp)
+	effects := e.dry.effects
+	e.scopes, e.dry = scopes, nil
+	return result, effects
+}
+
+// record adds the effect of kind on name in dry-run mode,
+// ok is false when not running in dry-run mode
+func (e *Eval) record(kind, name string, value interface{}) (ok bool) {
+	if e.dry == nil {
+		return false
+	}
+	e.dry.effects = append(e.dry.effects, Effect{Kind: kind, Name: name, Value: value})
+	return true
+}
@@ -0,0 +1,71 @@
+package eval
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	variables := map[string]interface{}{"load": 2.5}
+	store := NewMemoryStore()
+	e := New(`x = load * 2; counterInc("alerts"); counterInc("alerts") + x`).Variables(variables).StateStore(store)
+	result, effects, err := e.DryRun()
+	if err != nil || result != 7.0 {
+		t.Errorf("expected 7 but got %v, %v", result, err)
+	}
+	expected := []Effect{
+		{EffectVariable, "x", 5.0},
+		{EffectState, "counter:alerts", 1.0},
+		{EffectState, "counter:alerts", 2.0},
+	}
+	if !reflect.DeepEqual(effects, expected) {
+		t.Errorf("expected %v but got %v", expected, effects)
+	}
+	if _, ok := variables["x"]; ok {
+		t.Errorf("variable x was set")
+	}
+	if v, ok := store.Get("counter:alerts"); ok {
+		t.Errorf("state was set to %v", v)
+	}
+
+	// a real run afterwards applies the effects
+	if result, err := e.RunErr(); err != nil || result != 7.0 || variables["x"] != 5.0 {
+		t.Errorf("expected 7 but got %v, %v", result, err)
+	}
+	if _, effects, _ := e.DryRun(); effects[1].Value != 3.0 {
+		t.Errorf("expected the stored counter but got %v", effects)
+	}
+
+	// setEnv is recorded but must be allowed
+	const key = "EVAL_DRY_RUN_TEST"
+	_, effects, err = New(`setEnv("` + key + `", 1)`).AllowSetEnv(true).DryRun()
+	if err != nil || !reflect.DeepEqual(effects, []Effect{{EffectEnv, key, "1"}}) {
+		t.Errorf("unexpected effects %v, %v", effects, err)
+	}
+	if _, ok := os.LookupEnv(key); ok {
+		t.Errorf("%s was set", key)
+	}
+	if _, _, err := New(`setEnv("` + key + `", 1)`).DryRun(); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed but got %v", err)
+	}
+
+	// the scope of the dry run can't be removed
+	_, effects, err = New(`popScope(); setVal("y", 1)`).Variables(variables).DryRun()
+	if _, ok := variables["y"]; ok || err == nil || len(effects) != 1 {
+		t.Errorf("expected an error of popScope but got %v, %v", effects, err)
+	}
+
+	// temporary variables change nothing
+	for input, expected := range map[string][]Effect{
+		`let("x", load*2, x+1)`:                           nil,
+		`pushScope(); setVal("tmp", 1); popScope(); load`: nil,
+		`pushScope(); y = 1; popScope(); z = load`:        {{EffectVariable, "z", 2.5}},
+	} {
+		_, effects, err := New(input).Variables(variables).DryRun()
+		if err != nil || !reflect.DeepEqual(effects, expected) {
+			t.Errorf("%s: expected %v but got %v, %v", input, expected, effects, err)
+		}
+	}
+}
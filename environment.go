@@ -0,0 +1,358 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"math/rand"
+	"sync"
+)
+
+// ErrLimitExceeded is returned when a run exceeds the Limits
+// of its Environment.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// Function is a function implemented in Go which can be called
+// from expressions. String arguments are passed without quotes.
+type Function func(args ...interface{}) (interface{}, error)
+
+// Provider supplies variables which are not found in the variables
+// map, e.g. metrics fetched on demand.
+type Provider interface {
+	Lookup(name string) (interface{}, bool)
+}
+
+// ProviderFunc adapts an ordinary function to a Provider.
+type ProviderFunc func(name string) (interface{}, bool)
+
+// Lookup calls f(name)
+func (f ProviderFunc) Lookup(name string) (interface{}, bool) {
+	return f(name)
+}
+
+// Catalog translates texts, it is used by plural() and translate()
+// to localize messages. ok is false when there is no translation.
+type Catalog func(text string) (translation string, ok bool)
+
+// Limits restricts the resources a single run may use.
+// Zero values mean unlimited.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of an expression
+	MaxDepth int
+	// MaxCalls is the maximum number of function calls
+	MaxCalls int
+}
+
+// Environment holds variables, providers, functions and limits
+// shared by many compiled expressions. Variables written with
+// setVal in one expression are visible in all following runs.
+//
+// Example:
+//  env := eval.NewEnvironment().Set("n", 10)
+//  _, _ = env.Run(eval.MustCompile(`setVal("double",n*2)`))
+//  r, _ := env.Run(eval.MustCompile(`val("double") + 1`)) // r = 21
+//
+// An Environment is safe for concurrent use, runs are serialized.
+// The Environment is locked while a run is in progress, its Providers
+// and Functions must not call methods of the same Environment like
+// Get or Set, this deadlocks.
+type Environment struct {
+	mu        sync.Mutex
+	variables map[string]interface{}
+	providers []Provider
+	functions map[string]Function
+	limits    Limits
+	scopes    []map[string]interface{}
+	catalog   Catalog
+	state     StateStore
+	// allowSetEnv enables setEnv()
+	allowSetEnv bool
+	// strict makes undefined variables an error
+	strict bool
+	// truthy accepts numbers as conditions
+	truthy bool
+	// nanPolicy of score()
+	nanPolicy NaNPolicy
+	// missingPolicy of val()
+	missingPolicy MissingPolicy
+	// epsilon of == and != on floats
+	epsilon float64
+	// clock, random and environ replace the time, random numbers and
+	// environment variables of the system
+	clock   Clock
+	random  *rand.Rand
+	environ map[string]string
+	// filter restricts the builtins which may be called
+	filter functionFilter
+}
+
+// NewEnvironment returns an empty Environment
+func NewEnvironment() *Environment {
+	return &Environment{
+		variables: make(map[string]interface{}),
+		functions: make(map[string]Function),
+	}
+}
+
+// Set sets variable name to value
+func (env *Environment) Set(name string, value interface{}) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.variables[name] = value
+	return env
+}
+
+// Get returns the value of variable name. Providers are asked
+// when the variable is not set.
+func (env *Environment) Get(name string) (interface{}, bool) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return env.lookup(name)
+}
+
+// Provider adds p to the list of variable providers. Providers
+// are asked in the order they were added.
+func (env *Environment) Provider(p Provider) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.providers = append(env.providers, p)
+	return env
+}
+
+// Function makes fn callable as name(...) in all expressions
+// run in this Environment.
+func (env *Environment) Function(name string, fn Function) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.functions[name] = fn
+	return env
+}
+
+// Catalog sets the message catalog used by plural() and translate()
+func (env *Environment) Catalog(catalog Catalog) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.catalog = catalog
+	return env
+}
+
+// StateStore sets the store keeping the state of stateful functions
+// like throttle(), cache() and counterInc(). Without it the state is
+// kept in memory.
+func (env *Environment) StateStore(store StateStore) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.state = store
+	return env
+}
+
+// Clock sets the source of the current time in all expressions run in
+// this Environment, see Eval.Clock()
+func (env *Environment) Clock(clock Clock) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.clock = clock
+	return env
+}
+
+// Rand sets the generator of random() and uuid() in all expressions run
+// in this Environment, see Eval.Rand()
+func (env *Environment) Rand(r *rand.Rand) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.random = r
+	return env
+}
+
+// Environ replaces the environment of the process in env() and setEnv()
+// in all expressions run in this Environment, see Eval.Environ()
+func (env *Environment) Environ(vars map[string]string) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.environ = vars
+	return env
+}
+
+// AllowSetEnv enables setEnv() in all expressions run in
+// this Environment, see Eval.AllowSetEnv()
+func (env *Environment) AllowSetEnv(enabled bool) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.allowSetEnv = enabled
+	return env
+}
+
+// Strict makes references of undefined variables an error in all
+// expressions run in this Environment, see Eval.Strict()
+func (env *Environment) Strict(enabled bool) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.strict = enabled
+	return env
+}
+
+// Truthy accepts numbers as conditions in all expressions run in this
+// Environment, see Eval.Truthy()
+func (env *Environment) Truthy(enabled bool) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.truthy = enabled
+	return env
+}
+
+// NaNPolicy sets how score() treats math.NaN() inputs in all
+// expressions run in this Environment, see Eval.NaNPolicy()
+func (env *Environment) NaNPolicy(policy NaNPolicy) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.nanPolicy = policy
+	return env
+}
+
+// MissingPolicy sets what val() returns for variables which don't exist
+// in all expressions run in this Environment, see Eval.MissingPolicy()
+func (env *Environment) MissingPolicy(policy MissingPolicy) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.missingPolicy = policy
+	return env
+}
+
+// Epsilon makes == and != compare floats with a tolerance in all
+// expressions run in this Environment, see Eval.Epsilon()
+func (env *Environment) Epsilon(epsilon float64) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.epsilon = epsilon
+	return env
+}
+
+// AllowFunctions restricts the builtins which may be called in all
+// expressions run in this Environment, see Eval.AllowFunctions()
+func (env *Environment) AllowFunctions(names ...string) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.filter = env.filter.allow(names)
+	return env
+}
+
+// DenyFunctions forbids calling the builtins names in all expressions
+// run in this Environment, see Eval.DenyFunctions()
+func (env *Environment) DenyFunctions(names ...string) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.filter = env.filter.deny(names)
+	return env
+}
+
+// Limits sets the resource limits for each run
+func (env *Environment) Limits(limits Limits) *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.limits = limits
+	return env
+}
+
+// Run evaluates c against the Environment and returns the result
+// and the first error found while running. The options c got from
+// Eval.Compile() apply, those set in the Environment take precedence.
+// The Environment is locked until the run is finished.
+func (env *Environment) Run(c *Compiled) (interface{}, error) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	e := c.newEval(env.variables)
+	e.scopes, e.environment = env.scopes, env
+	result := e.eval(c.exp)
+	env.scopes = e.scopes
+	return result, e.err
+}
+
+// DryRun is like Run but returns the changes of variables, of the
+// StateStore and of the environment of the process instead of applying
+// them, e.g. to preview a changed rule against production data before
+// deploying it, see Eval.DryRun()
+func (env *Environment) DryRun(c *Compiled) (interface{}, []Effect, error) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	e := c.newEval(env.variables)
+	e.scopes, e.environment = env.scopes, env
+	result, effects := e.runDry(c.exp)
+	return result, effects, e.err
+}
+
+// PushScope opens a new scope. Variables set with setVal are
+// stored in this scope until PopScope is called, e.g. to keep
+// temporary variables of a rule out of the Environment:
+//
+//  env.PushScope()
+//  result, err := env.Run(rule)
+//  env.PopScope()
+func (env *Environment) PushScope() *Environment {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.scopes = append(env.scopes, make(map[string]interface{}))
+	return env
+}
+
+// PopScope removes the innermost scope together with its
+// variables. It returns an error when there is no scope left.
+func (env *Environment) PopScope() error {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	if len(env.scopes) == 0 {
+		return errors.New("PopScope without PushScope")
+	}
+	env.scopes = env.scopes[:len(env.scopes)-1]
+	return nil
+}
+
+// lookup must be called with env.mu held
+func (env *Environment) lookup(name string) (interface{}, bool) {
+	for i := len(env.scopes) - 1; i >= 0; i-- {
+		if val, ok := env.scopes[i][name]; ok {
+			return val, true
+		}
+	}
+	if val, ok := env.variables[name]; ok {
+		return val, true
+	}
+	return env.provide(name)
+}
+
+// provide asks the providers for variable name
+func (env *Environment) provide(name string) (interface{}, bool) {
+	for _, p := range env.providers {
+		if val, ok := p.Lookup(name); ok {
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// call runs the function name when it is registered, ok is
+// false otherwise. The arguments are evaluated only for registered
+// functions, builtins evaluate their own arguments.
+func (env *Environment) call(e *Eval, name string, exp *ast.CallExpr) (result interface{}, ok bool) {
+	fn, ok := env.functions[name]
+	if !ok {
+		return nil, false
+	}
+	return e.callFunction(name, fn, exp), true
+}
+
+// enter checks the limits when the evaluator descends into exp,
+// ok is false when a limit is exceeded
+func (env *Environment) enter(e *Eval, call bool) bool {
+	if env.limits.MaxDepth > 0 && e.depth > env.limits.MaxDepth {
+		e.fail(fmt.Errorf("%w: depth %d", ErrLimitExceeded, env.limits.MaxDepth))
+		return false
+	}
+	if call {
+		e.calls++
+		if env.limits.MaxCalls > 0 && e.calls > env.limits.MaxCalls {
+			e.fail(fmt.Errorf("%w: %d calls", ErrLimitExceeded, env.limits.MaxCalls))
+			return false
+		}
+	}
+	return true
+}
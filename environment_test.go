@@ -0,0 +1,181 @@
+package eval
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestEnvironment shares variables between several expressions
+func TestEnvironment(t *testing.T) {
+	env := NewEnvironment().Set("n", 10)
+
+	var rules = []struct {
+		input string
+		want  interface{}
+	}{
+		{`setVal("double",n*2)`, nil},
+		{`val("double") + 1`, 21},
+		{`double * 2`, 40},
+	}
+	for _, r := range rules {
+		result, err := env.Run(MustCompile(r.input))
+		if err != nil {
+			t.Errorf("%s leads to error %v", r.input, err)
+		}
+		if result != r.want {
+			t.Errorf("Expected %v from %s as output but got %v", r.want, r.input, result)
+		}
+	}
+
+	if v, ok := env.Get("double"); !ok || v != 20 {
+		t.Errorf("Expected double to be 20 but got %v", v)
+	}
+}
+
+// TestEnvironmentCompiledOptions checks that the options copied by
+// Eval.Compile() apply in an Environment, too
+func TestEnvironmentCompiledOptions(t *testing.T) {
+	at := time.Unix(1718454600, 0)
+	twice := func(args ...interface{}) (interface{}, error) {
+		return args[0].(float64) * 2, nil
+	}
+	seeded := New(`random(1000)`).Rand(rand.New(rand.NewSource(1)))
+	_ = seeded.ParseExpr()
+	want := seeded.Run()
+	for _, tc := range []struct {
+		name    string
+		input   string
+		options func(e *Eval) *Eval
+		want    interface{}
+		err     bool
+	}{
+		{"functions", `twice(2.0)`, func(e *Eval) *Eval { return e.RegisterFunction("twice", twice) }, 4.0, false},
+		{"filter", `sqrt(4)`, func(e *Eval) *Eval { return e.AllowFunctions("abs") }, math.NaN(), true},
+		{"strict", `unknown + 1`, func(e *Eval) *Eval { return e.Strict(true) }, math.NaN(), true},
+		{"truthy", `ifExpr(1, "y", "n")`, func(e *Eval) *Eval { return e.Truthy(true) }, "y", false},
+		{"epsilon", `0.1 + 0.2 == 0.3`, func(e *Eval) *Eval { return e.Epsilon(1e-9) }, true, false},
+		{"nanPolicy", `score(1, 80, 1, float64("x"))`, func(e *Eval) *Eval { return e.NaNPolicy(NaNSkip) }, 80.0, false},
+		{"missingPolicy", `val("unknown")`, func(e *Eval) *Eval { return e.MissingPolicy(MissingNaN) }, math.NaN(), false},
+		{"clock", `time("now", "epoch")`, func(e *Eval) *Eval { return e.Clock(ClockFunc(func() time.Time { return at })) }, at.Unix(), false},
+		{"random", `random(1000)`, func(e *Eval) *Eval { return e.Rand(rand.New(rand.NewSource(1))) }, want, false},
+		{"environ", `env("X")`, func(e *Eval) *Eval { return e.Environ(map[string]string{"X": "1"}) }, "1", false},
+		{"catalog", `translate("hello")`, func(e *Eval) *Eval {
+			return e.Catalog(func(text string) (string, bool) { return "hallo", true })
+		}, "hallo", false},
+		{"naturalOrder", `"eth2" < "eth10"`, func(e *Eval) *Eval { return e.NaturalOrder(true) }, true, false},
+	} {
+		c, err := tc.options(New(tc.input)).Compile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := NewEnvironment().Run(c)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if f, ok := tc.want.(float64); ok && math.IsNaN(f) {
+			if f, ok := result.(float64); !ok || !math.IsNaN(f) {
+				t.Errorf("%s: expected NaN but got %v", tc.name, result)
+			}
+		} else if result != tc.want {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.want, result)
+		}
+		if result, _, _ := NewEnvironment().DryRun(c); tc.name == "functions" && result != 4.0 {
+			t.Errorf("%s: expected 4 from DryRun but got %v", tc.name, result)
+		}
+	}
+
+	// options of the Environment take precedence
+	c, _ := New(`0.1 + 0.2 == 0.3`).Epsilon(1e-20).Compile()
+	if result, _ := NewEnvironment().Epsilon(1e-9).Run(c); result != true {
+		t.Errorf("expected true but got %v", result)
+	}
+}
+
+func TestEnvironmentProvider(t *testing.T) {
+	env := NewEnvironment().Provider(ProviderFunc(func(name string) (interface{}, bool) {
+		if strings.HasPrefix(name, "cpu") {
+			return 42.5, true
+		}
+		return nil, false
+	}))
+	result, _ := env.Run(MustCompile(`cpu0 + val("cpu1")`))
+	if result != 85.0 {
+		t.Errorf("Expected 85 but got %v", result)
+	}
+}
+
+func TestEnvironmentFunction(t *testing.T) {
+	env := NewEnvironment().Function("upper", func(args ...interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, errors.New("one argument expected")
+		}
+		s, _ := args[0].(string)
+		return strings.ToUpper(s), nil
+	})
+
+	result, err := env.Run(MustCompile(`upper("abc")`))
+	if err != nil || result != "ABC" {
+		t.Errorf("Expected ABC but got %v (%v)", result, err)
+	}
+
+	_, err = env.Run(MustCompile(`upper()`))
+	if err == nil {
+		t.Errorf("Expected an error from upper()")
+	}
+}
+
+func TestEnvironmentLimits(t *testing.T) {
+	env := NewEnvironment().Limits(Limits{MaxDepth: 5, MaxCalls: 3})
+
+	var ok = []string{`1+2`, `abs(abs(-1))`, `round(pow(2,2),2)`}
+	for _, s := range ok {
+		if _, err := env.Run(MustCompile(s)); err != nil {
+			t.Errorf("%s leads to error %v", s, err)
+		}
+	}
+
+	var wrong = []string{`abs(abs(abs(abs(-1))))`, `((((((1))))))`}
+	for _, s := range wrong {
+		if _, err := env.Run(MustCompile(s)); !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s should exceed the limits but got %v", s, err)
+		}
+	}
+}
+
+func TestEnvironmentScope(t *testing.T) {
+	env := NewEnvironment().Set("a", 1)
+
+	env.PushScope()
+	_, _ = env.Run(MustCompile(`setVal("a",2,"tmp",true)`))
+	if result, _ := env.Run(MustCompile(`a`)); result != 2 {
+		t.Errorf("Expected 2 inside the scope but got %v", result)
+	}
+	if err := env.PopScope(); err != nil {
+		t.Errorf("PopScope leads to error %v", err)
+	}
+
+	if result, _ := env.Run(MustCompile(`a`)); result != 1 {
+		t.Errorf("Expected 1 after PopScope but got %v", result)
+	}
+	if _, ok := env.Get("tmp"); ok {
+		t.Errorf("tmp must not leak out of the scope")
+	}
+	if err := env.PopScope(); err == nil {
+		t.Errorf("PopScope without PushScope must fail")
+	}
+
+	// the same with builtins
+	_, _ = env.Run(MustCompile(`pushScope()`))
+	_, _ = env.Run(MustCompile(`setVal("tmp",3)`))
+	_, _ = env.Run(MustCompile(`popScope()`))
+	if _, ok := env.Get("tmp"); ok {
+		t.Errorf("tmp must not leak out of the scope")
+	}
+	if _, err := env.Run(MustCompile(`popScope()`)); err == nil {
+		t.Errorf("popScope() without pushScope() must fail")
+	}
+}
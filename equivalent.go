@@ -0,0 +1,194 @@
+package eval
+
+import (
+	"go/ast"
+	"go/token"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// dependent lists the pure builtins whose result depends on more than
+// their arguments, e.g. on variables named by strings, and which can't
+// be folded into constants
+var dependent = map[string]bool{
+	"exists":      true,
+	"let":         true,
+	"lookupTable": true,
+	"plural":      true,
+	"template":    true,
+	"translate":   true,
+	"val":         true,
+	"valOr":       true,
+}
+
+// mirrored holds the comparisons with swapped operands
+var mirrored = map[token.Token]token.Token{token.GTR: token.LSS, token.GEQ: token.LEQ}
+
+// Equivalent reports whether the expressions a and b have the same
+// meaning, e.g. to detect edits of rules which change nothing:
+//
+//	eval.Equivalent(`x > 2*50`, `(100 < x)`) // true
+//
+// Both are compared after parsing without parentheses and with constant
+// subexpressions of pure builtins computed. Operands of +, *, == and !=
+// and those of > and >= are ordered when this doesn't change the order
+// of side effects. Expressions which differ otherwise, e.g. '(a+b)+c' and
+// 'a+(b+c)' which may round differently, are not equivalent. Syntax
+// errors are never equivalent.
+func Equivalent(a, b string) bool {
+	x, err := parseStatements(a)
+	if err != nil {
+		return false
+	}
+	y, err := parseStatements(b)
+	if err != nil {
+		return false
+	}
+	return canonical(x) == canonical(y)
+}
+
+// canonical returns exp as string which is the same for equivalent
+// expressions, see Equivalent()
+func canonical(exp ast.Expr) string {
+	if v, ok := constantValue(exp); ok {
+		return canonicalValue(v)
+	}
+	switch exp := exp.(type) {
+	case *ast.ParenExpr:
+		return canonical(exp.X)
+	case *ast.Ident:
+		return exp.Name
+	case *ast.UnaryExpr:
+		return exp.Op.String() + "(" + canonical(exp.X) + ")"
+	case *ast.BinaryExpr:
+		x, y, op := canonical(exp.X), canonical(exp.Y), exp.Op
+		// side effects must happen in the same order
+		reorderable := pure(exp.X) && pure(exp.Y)
+		switch op {
+		case token.GTR, token.GEQ:
+			// 'a > b' is 'b < a'
+			if reorderable {
+				x, y, op = y, x, mirrored[op]
+			}
+		case token.ADD, token.MUL, token.EQL, token.NEQ:
+			if reorderable && y < x {
+				x, y = y, x
+			}
+		}
+		return "(" + x + " " + op.String() + " " + y + ")"
+	case *ast.CallExpr:
+		name := ";"
+		if exp.Fun != sequence {
+			name = functionName(exp.Fun)
+			if builtin := resolveName(name); isBuiltin(builtin) {
+				name = builtin
+			}
+		}
+		args := make([]string, len(exp.Args))
+		for i, arg := range exp.Args {
+			args[i] = canonical(arg)
+		}
+		if exp.Ellipsis.IsValid() {
+			args[len(args)-1] += "..."
+		}
+		return name + "(" + strings.Join(args, ", ") + ")"
+	case *ast.IndexExpr:
+		return canonical(exp.X) + "[" + canonical(exp.Index) + "]"
+	case *ast.SelectorExpr:
+		return canonical(exp.X) + "." + exp.Sel.Name
+	}
+	var b strings.Builder
+	formatExpr(&b, exp)
+	return b.String()
+}
+
+// constantValue returns the value of exp when it is a constant of
+// literals and pure builtins, ok is false otherwise
+func constantValue(exp ast.Expr) (v interface{}, ok bool) {
+	constant := true
+	ast.Inspect(exp, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			// names of called functions are checked with the call
+			if n.Name != "true" && n.Name != "false" {
+				constant = false
+			}
+		case *ast.CallExpr:
+			name := resolveName(functionName(n.Fun))
+			if n.Fun == sequence || !isBuiltin(name) || impure[name] || dependent[name] || n.Ellipsis.IsValid() {
+				constant = false
+			}
+			for _, arg := range n.Args {
+				if _, ok := constantValue(arg); !ok {
+					constant = false
+				}
+			}
+			return false
+		case *ast.BasicLit:
+			// e.g. 'a' results in NaN like 'b'
+			if n.Kind == token.CHAR || n.Kind == token.IMAG {
+				constant = false
+			}
+		case *ast.IndexExpr, *ast.SelectorExpr, *ast.CompositeLit, *ast.FuncLit:
+			constant = false
+		}
+		return constant
+	})
+	if !constant {
+		return nil, false
+	}
+	e := New("")
+	v = e.eval(exp)
+	switch v.(type) {
+	case int, float64, string, bool:
+		return v, e.err == nil
+	}
+	return nil, false
+}
+
+// canonicalValue returns the constant v as string, floats and ints
+// differ like in the results of Run()
+func canonicalValue(v interface{}) string {
+	switch v := v.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !math.IsNaN(v) && !math.IsInf(v, 0) && !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// pure reports whether exp calls pure builtins only, so that it has no
+// side effects
+func pure(exp ast.Expr) bool {
+	result := true
+	ast.Inspect(exp, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && call.Fun != sequence {
+			name := resolveName(functionName(call.Fun))
+			if !isBuiltin(name) || impure[name] {
+				result = false
+			}
+		}
+		return result
+	})
+	return result
+}
+
+// isBuiltin reports whether name is a builtin which is not replaced
+// by a function registered with RegisterFunction
+func isBuiltin(name string) bool {
+	if _, ok := builtins[name]; !ok {
+		return false
+	}
+	_, registered := registeredFunction(name)
+	return !registered
+}
@@ -0,0 +1,60 @@
+package eval
+
+import "testing"
+
+func TestEquivalent(t *testing.T) {
+	for _, tc := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{`a+1`, `a + 1`, true},
+		{`(a + 1)`, `a + 1`, true},
+		{`(in-out)/in*100`, `((in - out) / in) * 100`, true},
+		{`x > 2*50`, `(100 < x)`, true},
+		{`x >= 10`, `10 <= x`, true},
+		{`x * 2`, `2 * x`, true},
+		{`a == "up"`, `"up" == a`, true},
+		{`0x10 + a`, `16 + a`, true},
+		{`a * 2.50`, `a * 2.5`, true},
+		{`round(a, 1 + 1)`, `round(a, 2)`, true},
+		{`sqrt(16) + a`, `4.0 + a`, true},
+		{`math.sqrt(a)`, `sqrt(a)`, true},
+		{`a + b`, `b + a`, true},
+		{`substr("abc", 0, 1)`, `"a"`, true},
+		{`"x"`, "`x`", true},
+		{`x = 1; x * 2`, `setVal("x", 1); 2 * x`, true},
+		{`samples[1+1]`, `samples[2]`, true},
+		{`sensor.temp.value > 20`, `20 < sensor.temp.value`, true},
+
+		{`(a + b) + c`, `a + (b + c)`, false},
+		{`a - 1`, `1 - a`, false},
+		{`x > 1`, `x < 1`, false},
+		{`2 * 50`, `100.0`, false}, // int and float64
+		{`a + 1`, `a + 2`, false},
+		{`val("a")`, `val("b")`, false},
+		{`val("a" + "b")`, `""`, false},
+		{`time("now", "") > 0`, `0 < time("now", "")`, false},
+		{`counterInc("a") * counterInc("b")`, `counterInc("b") * counterInc("a")`, false},
+		{`a +`, `a +`, false},
+	} {
+		if got := Equivalent(tc.a, tc.b); got != tc.expected {
+			t.Errorf("%s and %s: expected %v but got %v", tc.a, tc.b, tc.expected, got)
+		}
+		if got := Equivalent(tc.b, tc.a); got != tc.expected {
+			t.Errorf("%s and %s: expected %v but got %v", tc.b, tc.a, tc.expected, got)
+		}
+	}
+
+	// registered functions replacing builtins are not computed
+	RegisterFunction("sqrt", func(args ...interface{}) (interface{}, error) {
+		return 0, nil
+	})
+	defer func() {
+		functionsMu.Lock()
+		delete(functions, "sqrt")
+		functionsMu.Unlock()
+	}()
+	if Equivalent(`sqrt(16)`, `4.0`) {
+		t.Errorf("sqrt(16) of a registered function must not be computed")
+	}
+}
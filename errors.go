@@ -0,0 +1,41 @@
+package eval
+
+import "errors"
+
+var (
+	// ErrUnknownFunction is the cause of calling a function which is
+	// neither a builtin nor registered in the Environment.
+	ErrUnknownFunction = errors.New("unknown function")
+	// ErrArity is the cause of calling a builtin with a wrong number
+	// of arguments.
+	ErrArity = errors.New("wrong number of arguments")
+	// ErrNotAllowed is the cause of calling a function which must be
+	// enabled first, e.g. setEnv().
+	ErrNotAllowed = errors.New("not allowed")
+	// ErrUndefinedVariable is returned in strict mode for references
+	// of undefined variables, see Eval.Strict().
+	ErrUndefinedVariable = errors.New("undefined variable")
+)
+
+// Error is an error of a function call found while running. Use
+// errors.Is to check the cause:
+//
+//	if _, err := e.RunErr(); errors.Is(err, eval.ErrUnknownFunction) {
+//		...
+//	}
+type Error struct {
+	// Func is the name of the function as called, e.g. "math.sqrt"
+	Func string
+	// Err is the cause like ErrArity or the error of a Function
+	Err error
+}
+
+// Error returns "function: cause"
+func (err *Error) Error() string {
+	return err.Func + ": " + err.Err.Error()
+}
+
+// Unwrap returns the cause
+func (err *Error) Unwrap() error {
+	return err.Err
+}
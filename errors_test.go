@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRunErr(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		cause error // nil for no error
+		fn    string
+	}{
+		{`sqrt(-1)`, nil, ""}, // a computed NaN is no error
+		{`sqrt(16)`, nil, ""},
+		{`unknown(1)`, ErrUnknownFunction, "unknown"},
+		{`math.unknown(1)`, ErrUnknownFunction, "math.unknown"},
+		{`sqrt(16, 2)`, ErrArity, "sqrt"},
+		{`math.sqrt()`, ErrArity, "math.sqrt"},
+		{`round(2.5)`, ErrArity, "round"},
+		{`1 + substr("abc", 1)`, ErrArity, "substr"},
+		{`setEnv("EVAL_TEST", "1")`, ErrNotAllowed, "setEnv"},
+	} {
+		_, err := New(tc.input).RunErr()
+		if tc.cause == nil {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.input, err)
+			}
+			continue
+		}
+		var e *Error
+		if !errors.As(err, &e) || !errors.Is(err, tc.cause) || e.Func != tc.fn {
+			t.Errorf("%s: expected %q of %s but got %v", tc.input, tc.cause, tc.fn, err)
+		}
+	}
+
+	// parser errors are returned as they are
+	if result, err := New(`sqrt(`).RunErr(); err == nil || !math.IsNaN(result.(float64)) {
+		t.Errorf("expected a parser error but got %v, %v", result, err)
+	}
+
+	// errors of a previous run are forgotten
+	e := New(`sqrt(x)`)
+	if _, err := e.Variables(map[string]interface{}{"x": 4}).RunErr(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	e.Reset(`sqrt()`)
+	if _, err := e.RunErr(); !errors.Is(err, ErrArity) {
+		t.Errorf("expected ErrArity but got %v", err)
+	}
+	e.Reset(`sqrt(4)`)
+	if _, err := e.RunErr(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// errors of Functions are wrapped
+	env := NewEnvironment()
+	failure := errors.New("failure")
+	env.Function("fails", func(args ...interface{}) (interface{}, error) {
+		return nil, failure
+	})
+	if _, err := env.Run(MustCompile(`fails()`)); !errors.Is(err, failure) || err.Error() != "fails: failure" {
+		t.Errorf("expected a wrapped failure but got %v", err)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	variables := map[string]interface{}{"a": 1.0}
+	for _, tc := range []struct {
+		input string
+		name  string // of the undefined variable, "" for none
+	}{
+		{`a + 1`, ""},
+		{`a + b`, "b"},
+		{`val("a")`, ""},
+		{`val("c") + 1`, "c"},
+		{`isNaN(x)`, "x"},
+		{`let("y", 2, y * a)`, ""},
+	} {
+		_, err := New(tc.input).Variables(variables).Strict(true).RunErr()
+		if tc.name == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.input, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrUndefinedVariable) || !strings.Contains(err.Error(), tc.name) {
+			t.Errorf("%s: expected undefined variable %s but got %v", tc.input, tc.name, err)
+		}
+		// without strict mode the result is NaN only
+		if _, err := New(tc.input).Variables(variables).RunErr(); err != nil {
+			t.Errorf("%s: unexpected error %v without strict mode", tc.input, err)
+		}
+	}
+
+	// compiled expressions skip the fast path
+	c, _ := New(`a * b`).Strict(true).Compile()
+	if _, err := c.Run(variables); !errors.Is(err, ErrUndefinedVariable) {
+		t.Errorf("expected undefined variable but got %v", err)
+	}
+	env := NewEnvironment().Strict(true)
+	if _, err := env.Run(MustCompile(`a * 2`)); !errors.Is(err, ErrUndefinedVariable) {
+		t.Errorf("expected undefined variable but got %v", err)
+	}
+}
@@ -1,20 +1,75 @@
 package eval
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/parser"
+	"go/scanner"
 	"go/token"
+	"hash/fnv"
+	"html"
 	"math"
-	"os"
+	"math/rand"
+	"net/mail"
+	"net/url"
+	"path"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 var FloatError = math.NaN()
 
+// standardPressure is the air pressure at sea level in hPa of the
+// international standard atmosphere
+const standardPressure = 1013.25
+
+// now returns the current time, replaced in unit tests
+var now = time.Now
+
+// Values holds the results of functions returning more than one
+// value like minMax(). setVal assigns them to several variables:
+//  setVal("lo", "hi", minMax(a, b, c))
+type Values []interface{}
+
+// NaNPolicy defines how functions aggregating several values like
+// score() treat math.NaN() inputs, e.g. metrics which failed to load
+type NaNPolicy int
+
+const (
+	// NaNPropagate returns math.NaN() when any input is NaN
+	NaNPropagate NaNPolicy = iota
+	// NaNSkip ignores NaN inputs, all inputs NaN return math.NaN()
+	NaNSkip
+	// NaNZero treats NaN inputs as 0
+	NaNZero
+)
+
+// MissingPolicy defines what val() returns for variables which don't
+// exist, see exists()
+type MissingPolicy int
+
+const (
+	// MissingEmpty returns an empty string
+	MissingEmpty MissingPolicy = iota
+	// MissingNaN returns math.NaN()
+	MissingNaN
+	// MissingError returns math.NaN() and ErrUndefinedVariable by RunErr
+	MissingError
+)
+
 //
 // Eval is the main struct converting an input string into an expression.
 // It is a simple interpreter, that translates a calculation string into
@@ -26,12 +81,60 @@ var FloatError = math.NaN()
 //  r := e.Run() // r = -20.2
 //
 // Calculations:
-//  +, -, *, /
+//  +, -, *, /, %
 //
 type Eval struct {
 	input     string
 	exp       ast.Expr
 	variables map[string]interface{}
+	// ownVariables is true when variables was allocated by setVal
+	// and not handed in by the caller via Variables()
+	ownVariables bool
+	// copyVariables is true when variables is shared and must be
+	// copied before setVal writes to it, see Compiled.Eval()
+	copyVariables bool
+	// scopes is a stack of temporary variables on top of variables
+	scopes []map[string]interface{}
+	// catalog translates texts of plural() and translate()
+	catalog Catalog
+	// naturalOrder enables <, >, <= and >= for strings
+	naturalOrder bool
+	// allowSetEnv enables setEnv()
+	allowSetEnv bool
+	// strict makes undefined variables an error
+	strict bool
+	// truthy accepts numbers as conditions
+	truthy bool
+	// nanPolicy of score()
+	nanPolicy NaNPolicy
+	// missingPolicy of val()
+	missingPolicy MissingPolicy
+	// epsilon of == and != on floats
+	epsilon float64
+	// filter restricts the builtins which may be called
+	filter functionFilter
+	// functions registered with RegisterFunction
+	functions map[string]Function
+	// clock, random and environ replace the time, random numbers and
+	// environment variables of the system, see Clock(), Rand(), Environ()
+	clock   Clock
+	random  *rand.Rand
+	environ map[string]string
+	// state of stateful functions like throttle() kept between runs when
+	// not running in an Environment
+	state StateStore
+	// ownState is true when state was allocated internally
+	// and not handed in by the caller via StateStore()
+	ownState bool
+	// err holds the first error found while running
+	err error
+	// dry records the effects of a run instead of applying them, see DryRun()
+	dry *dryRun
+	// environment is set when running in an Environment
+	environment *Environment
+	// depth and calls are counted to check the Limits of environment
+	depth int
+	calls int
 }
 
 // New is the main entry point with a calculation string to eval
@@ -53,33 +156,420 @@ func (e *Eval) SetInput(input string) {
 	e.input = input
 }
 
+// Reset clears the parsed expression and all variables written by
+// setVal and sets a new input string. Variable maps allocated
+// internally are emptied and reused, maps handed in via Variables()
+// are released but never modified. Useful for pooled evaluators:
+//
+//  e := pool.Get().(*eval.Eval)
+//  e.Reset(input)
+//  if e.ParseExpr() == nil { ... }
+func (e *Eval) Reset(input string) *Eval {
+	e.input = input
+	e.exp = nil
+	e.scopes = e.scopes[:0]
+	if e.ownState {
+		e.state = nil
+	}
+	if e.ownVariables {
+		for k := range e.variables {
+			delete(e.variables, k)
+		}
+	} else {
+		e.variables = nil
+	}
+	return e
+}
+
 // Variables adds external variables. In most cases these
 // are float64 or strings.
 func (e *Eval) Variables(variables map[string]interface{}) *Eval {
 	e.variables = variables
+	e.ownVariables = false
+	return e
+}
+
+// Catalog sets the message catalog used by plural() and translate()
+// to localize texts.
+func (e *Eval) Catalog(catalog Catalog) *Eval {
+	e.catalog = catalog
+	return e
+}
+
+// Clock sets the source of the current time of time(), ageSeconds() and
+// the stateful functions, e.g. to test rules at a fixed time:
+//
+//	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+//	e.Clock(eval.ClockFunc(func() time.Time { return at }))
+func (e *Eval) Clock(clock Clock) *Eval {
+	e.clock = clock
+	return e
+}
+
+// Rand sets the generator of random() and uuid(), e.g. with a fixed seed
+// 'rand.New(rand.NewSource(1))' for reproducible tests. Without it random
+// numbers are read from crypto/rand. A rand.Rand is not safe for
+// concurrent use, also not by runs of a Compiled.
+func (e *Eval) Rand(r *rand.Rand) *Eval {
+	e.random = r
+	return e
+}
+
+// Environ replaces the environment of the process in env() and setEnv()
+// by vars, e.g. in tests of rules. setEnv() writes into vars.
+func (e *Eval) Environ(vars map[string]string) *Eval {
+	e.environ = vars
+	return e
+}
+
+// StateStore sets the store keeping the state of stateful functions like
+// throttle(), cache() and counterInc() between runs, e.g. a FileStore to
+// keep it across restarts. Without it the state is kept in memory.
+func (e *Eval) StateStore(store StateStore) *Eval {
+	e.state = store
+	e.ownState = false
+	return e
+}
+
+// NaturalOrder enables the operators <, >, <= and >= for strings
+// which are compared in natural order, e.g. "eth2" < "eth10" is true.
+// Without it comparing strings results in math.NaN().
+func (e *Eval) NaturalOrder(enabled bool) *Eval {
+	e.naturalOrder = enabled
+	return e
+}
+
+// AllowSetEnv enables setEnv() which changes the environment of the
+// process. It is disabled by default so that expressions from
+// untrusted sources can't modify the process.
+func (e *Eval) AllowSetEnv(enabled bool) *Eval {
+	e.allowSetEnv = enabled
+	return e
+}
+
+// Strict makes references of undefined variables, also with val(), an
+// error reported by RunErr, e.g. to validate formulas of config files
+// before they silently result in math.NaN(). Calls of unknown functions
+// are always an error.
+func (e *Eval) Strict(enabled bool) *Eval {
+	e.strict = enabled
+	return e
+}
+
+// Truthy accepts numbers as conditions of &&, ||, !, not() and ifExpr()
+// like in C, 0 is false and all other numbers are true. It eases the
+// migration of formulas like 'ifExpr(errors, "failed", "ok")'. It is
+// disabled by default so that a number used as condition by mistake
+// results in math.NaN().
+func (e *Eval) Truthy(enabled bool) *Eval {
+	e.truthy = enabled
+	return e
+}
+
+// NaNPolicy sets how score() treats math.NaN() inputs,
+// the default is NaNPropagate
+func (e *Eval) NaNPolicy(policy NaNPolicy) *Eval {
+	e.nanPolicy = policy
+	return e
+}
+
+// MissingPolicy sets what val() returns for variables which don't
+// exist, the default is MissingEmpty. Use exists() to check a variable
+// before reading it.
+func (e *Eval) MissingPolicy(policy MissingPolicy) *Eval {
+	e.missingPolicy = policy
+	return e
+}
+
+// Epsilon makes == and != compare floats with a tolerance, e.g.
+// 'val("x") == 3.141' is true for 3.1410000001 with Epsilon(1e-6).
+// Numbers are equal when they differ by epsilon at most. The default 0
+// compares exactly, ints are always compared exactly. See almostEqual()
+// for single comparisons.
+func (e *Eval) Epsilon(epsilon float64) *Eval {
+	e.epsilon = epsilon
+	return e
+}
+
+// AllowFunctions restricts the builtins which may be called to names,
+// e.g. to sandbox formulas of end users:
+//
+//  e.AllowFunctions("round", "pow", "val")
+//
+// Calling other builtins fails with ErrNotAllowed. Namespaced names and
+// aliases are resolved, functions registered in Go are not restricted.
+func (e *Eval) AllowFunctions(names ...string) *Eval {
+	e.filter = e.filter.allow(names)
+	return e
+}
+
+// DenyFunctions forbids calling the builtins names like "env" or "time",
+// calling them fails with ErrNotAllowed, see AllowFunctions()
+func (e *Eval) DenyFunctions(names ...string) *Eval {
+	e.filter = e.filter.deny(names)
+	return e
+}
+
+// RegisterFunction makes fn callable as name(...) in this Eval. It is
+// consulted before the functions registered globally with the package
+// level RegisterFunction and before the builtins, functions of an
+// Environment take precedence. String arguments are passed without quotes:
+//
+//  e := eval.New(`upper(name) + "!"`).RegisterFunction("upper",
+//    func(args ...interface{}) (interface{}, error) {
+//      return strings.ToUpper(fmt.Sprint(args[0])), nil
+//    })
+func (e *Eval) RegisterFunction(name string, fn Function) *Eval {
+	if e.functions == nil {
+		e.functions = make(map[string]Function)
+	}
+	e.functions[name] = fn
 	return e
 }
 
-// ParseExpr takes the input line and extracts tokens
+// Compile returns the parsed expression as Compiled, which runs many
+// times with different variables and is safe for concurrent use. The
+// input is parsed when ParseExpr was not called before. The options of
+// e like the Catalog, NaturalOrder, AllowSetEnv, registered functions
+// and a StateStore handed in via StateStore() are copied, later changes
+// of e don't affect the Compiled expression.
+func (e *Eval) Compile() (*Compiled, error) {
+	if e.exp == nil {
+		if err := e.ParseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	c := newCompiled(e.input, e.exp)
+	c.catalog = e.catalog
+	c.naturalOrder = e.naturalOrder
+	c.allowSetEnv = e.allowSetEnv
+	c.strict = e.strict
+	c.truthy = e.truthy
+	c.nanPolicy = e.nanPolicy
+	c.missingPolicy = e.missingPolicy
+	c.epsilon = e.epsilon
+	c.clock = e.clock
+	c.random = e.random
+	c.environ = e.environ
+	c.filter = e.filter
+	if len(e.functions) > 0 {
+		c.functions = make(map[string]Function, len(e.functions))
+		for name, fn := range e.functions {
+			c.functions[name] = fn
+		}
+	}
+	if !e.ownState {
+		c.state = e.state
+	}
+	return c, nil
+}
+
+// ParseExpr takes the input line and extracts tokens. Several
+// expressions separated by ';' like 'setVal("a",10); val("a")*2'
+// are run left to right, the last one is the result.
 func (e *Eval) ParseExpr() (err error) {
-	e.exp, err = parser.ParseExpr(e.input)
+	e.exp, err = parseStatements(e.input)
 	return
 }
 
+// sequence is the function of the call running the statements
+// of a program left to right, see parseStatements()
+var sequence = &ast.Ident{Name: ";"}
+
+// parseStatements parses the expressions of input separated by ';'.
+// A single expression is returned as it is, several ones as call of
+// sequence. The positions of all statements are those in input.
+func parseStatements(input string) (ast.Expr, error) {
+	ranges := splitStatements(input)
+	switch len(ranges) {
+	case 0:
+		return parseExpr(input)
+	case 1:
+		return parseStatement(input, ranges[0])
+	}
+	call := &ast.CallExpr{Fun: sequence}
+	for _, r := range ranges {
+		exp, err := parseStatement(input, r)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, exp)
+	}
+	return call, nil
+}
+
+// parseExpr parses input like parser.ParseExpr but accepts calls of
+// aliases and namespaced builtins which are Go keywords like 'if(...)'
+// or 'json.type(...)', see RegisterAlias()
+func parseExpr(input string) (ast.Expr, error) {
+	src, keywords := replaceKeywordAliases(input)
+	exp, err := parser.ParseExpr(src)
+	if unknownEscapes(err) {
+		// the literals are complete, see unquote()
+		err = nil
+	}
+	if err != nil || len(keywords) == 0 {
+		return exp, err
+	}
+	ast.Inspect(exp, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			id, ok := call.Fun.(*ast.Ident)
+			if sel, isSel := call.Fun.(*ast.SelectorExpr); isSel {
+				id, ok = sel.Sel, true
+			}
+			if ok {
+				if keyword, ok := keywords[id.Name]; ok {
+					id.Name = keyword
+				}
+			}
+		}
+		return true
+	})
+	return exp, nil
+}
+
+// unknownEscapes reports whether err holds parser errors of escapes
+// unknown to Go like "^\d+$" only, which are tolerated
+func unknownEscapes(err error) bool {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) || len(list) == 0 {
+		return false
+	}
+	for _, e := range list {
+		if e.Msg != "unknown escape sequence" {
+			return false
+		}
+	}
+	return true
+}
+
+// parseStatement parses the statement of input in r. An assignment
+// 'name = x' is parsed as 'setVal("name", x)'.
+func parseStatement(input string, r [2]int) (ast.Expr, error) {
+	name, at, ok := assignment(input, r)
+	if !ok {
+		return parseExpr(blankOutside(input, r))
+	}
+	x, err := parseExpr(blankOutside(input, [2]int{at[1] + 1, r[1]}))
+	if err != nil {
+		return nil, err
+	}
+	// parser.ParseExpr starts the positions at 1
+	pos := token.Pos(at[0] + 1)
+	return &ast.CallExpr{
+		Fun:  &ast.Ident{NamePos: pos, Name: "setVal"},
+		Args: []ast.Expr{&ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: strconv.Quote(name)}, x},
+	}, nil
+}
+
+// assignment returns the variable name and the offsets of the name
+// and of '=' in input when the statement of input in r is an assignment
+// 'name = x'
+func assignment(input string, r [2]int) (name string, at [2]int, ok bool) {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), r[1]-r[0])
+	s.Init(file, []byte(input[r[0]:r[1]]), nil, 0)
+	namePos, tok, name := s.Scan()
+	if tok != token.IDENT {
+		return "", at, false
+	}
+	assignPos, tok, _ := s.Scan()
+	if tok != token.ASSIGN {
+		return "", at, false
+	}
+	return name, [2]int{r[0] + file.Offset(namePos), r[0] + file.Offset(assignPos)}, true
+}
+
+// splitStatements returns the start and end offsets of the statements
+// of input separated by ';' outside of brackets, blank ones are skipped
+func splitStatements(input string) [][2]int {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(input))
+	s.Init(file, []byte(input), nil, 0)
+	var ranges [][2]int
+	add := func(start, end int) {
+		if strings.TrimSpace(input[start:end]) != "" {
+			ranges = append(ranges, [2]int{start, end})
+		}
+	}
+	depth, start := 0, 0
+	for {
+		pos, tok, lit := s.Scan()
+		switch tok {
+		case token.EOF:
+			add(start, len(input))
+			return ranges
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.SEMICOLON:
+			// semicolons inserted at newlines are no separators
+			if lit == ";" && depth == 0 {
+				offset := file.Offset(pos)
+				add(start, offset)
+				start = offset + 1
+			}
+		}
+	}
+}
+
+// blankOutside replaces all but the newlines of input outside of r
+// with spaces, so that the parser reports the positions in input
+func blankOutside(input string, r [2]int) string {
+	if r[0] == 0 && r[1] == len(input) {
+		return input
+	}
+	b := []byte(input)
+	for i := range b {
+		if (i < r[0] || i >= r[1]) && b[i] != '\n' {
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
 // Run returns the evaluated result or <nil> when nothing is wanted back
 func (e *Eval) Run() interface{} {
 	result := e.eval(e.exp)
 	return result
 }
 
+// RunErr is like Run but also returns the first error found while
+// running. Failed calls are reported as *Error with a cause like
+// ErrUnknownFunction or ErrArity, so a computed math.NaN() can be told
+// apart from a broken expression. The input is parsed when ParseExpr
+// was not called before, a parser error is returned as it is.
+func (e *Eval) RunErr() (interface{}, error) {
+	if e.exp == nil {
+		if err := e.ParseExpr(); err != nil {
+			return FloatError, err
+		}
+	}
+	e.err = nil
+	result := e.eval(e.exp)
+	return result, e.err
+}
+
 // eval is the recursive interpreter
 func (e *Eval) eval(exp ast.Expr) interface{} {
+	if e.environment != nil {
+		e.depth++
+		defer func() { e.depth-- }()
+		_, isCall := exp.(*ast.CallExpr)
+		if !e.environment.enter(e, isCall) {
+			return FloatError
+		}
+	}
+
 	switch exp := exp.(type) {
 	// e.g. -17
 	case *ast.UnaryExpr:
 		switch exp.Op {
 		case token.ADD:
-			x := e.eval(exp.X)
+			x := e.getArg(exp.X)
 			switch x.(type) {
 			case int:
 				return x.(int)
@@ -88,7 +578,7 @@ func (e *Eval) eval(exp ast.Expr) interface{} {
 			}
 			return FloatError
 		case token.SUB:
-			x := e.eval(exp.X)
+			x := e.getArg(exp.X)
 			switch x.(type) {
 			case int:
 				return -1 * x.(int)
@@ -96,71 +586,52 @@ func (e *Eval) eval(exp ast.Expr) interface{} {
 				return -1 * x.(float64)
 			}
 			return FloatError
+		// e.g. !isNaN(x)
+		case token.NOT:
+			if b, ok := e.condition(exp.X); ok {
+				return !b
+			}
+			return FloatError
 		}
 	// ( expr )
 	case *ast.ParenExpr:
 		return e.eval(exp.X)
-	// +, -, *, /
+	// +, -, *, /, %
 	case *ast.BinaryExpr:
 		return e.evalBinaryExpr(exp)
 	// token.INT, token.FLOAT, token.IMAG, token.CHAR, or token.STRING
 	case *ast.BasicLit:
 		switch exp.Kind {
+		// 255, 0xFF, 0o377, 0b1111_1111
 		case token.INT:
-			i, _ := strconv.Atoi(exp.Value)
-			return i
+			i, _ := strconv.ParseInt(exp.Value, 0, 64)
+			return int(i)
 		case token.FLOAT:
 			f, _ := strconv.ParseFloat(exp.Value, 64)
 			return f
+		// "abc" or `abc`
 		case token.STRING:
-			return exp.Value
+			return unquote(exp.Value)
 		}
 	// function calls
 	case *ast.CallExpr:
-		// alphabetically list of functions
-		name := e.evalFunctionName(exp.Fun)
-		switch name {
-		case "abs":
-			return e.abs(exp)
-		case "avg":
-			return e.avg(exp)
-		case "env":
-			return e.env(exp)
-		case "float64":
-			return e.float64(exp)
-		case "ifExpr":
-			return e.ifExpr(exp)
-		case "int":
-			return e.int(exp)
-		case "isBetween":
-			return e.isBetween(exp)
-		case "isNaN":
-			return e.isNaN(exp)
-		case "max":
-			return e.max(exp)
-		case "min":
-			return e.min(exp)
-		case "pow":
-			return e.pow(exp)
-		case "regexpMatch":
-			return e.regexpMatch(exp)
-		case "round":
-			return e.round(exp)
-		case "setVal":
-			return e.setVal(exp)
-		case "sqrt":
-			return e.sqrt(exp)
-		case "substr":
-			return e.substr(exp)
-		case "sprintf":
-			return e.sprintf(exp)
-		case "time":
-			return e.time(exp)
-		case "val":
-			return e.val(exp)
-		default:
-			return FloatError
+		if exp.Fun == sequence {
+			var result interface{}
+			for _, statement := range exp.Args {
+				result = e.eval(statement)
+			}
+			return result
 		}
+		return e.call(exp)
+	// e.g. samples[0] or sensor["temp"]
+	case *ast.IndexExpr:
+		return e.index(exp)
+	// e.g. sensor.temp.value
+	case *ast.SelectorExpr:
+		return e.selector(exp)
+	// already evaluated arguments, see chain()
+	case *value:
+		return exp.v
 	case *ast.Ident:
 		if exp.Name == "true" {
 			return true
@@ -168,14 +639,289 @@ func (e *Eval) eval(exp ast.Expr) interface{} {
 		if exp.Name == "false" {
 			return false
 		}
-		if val, ok := e.variables[exp.Name]; ok {
+		if val, ok := e.lookup(exp.Name); ok {
 			return val
 		}
+		e.undefined(exp.Name)
 	}
 
 	return FloatError
 }
 
+// call runs the function called in exp
+func (e *Eval) call(exp *ast.CallExpr) interface{} {
+	name := e.evalFunctionName(exp.Fun)
+	if exp.Ellipsis.IsValid() {
+		var ok bool
+		if exp, ok = e.spread(exp); !ok {
+			e.fail(&Error{Func: name, Err: errors.New("last argument is no slice")})
+			return FloatError
+		}
+	}
+	if e.environment != nil {
+		if result, ok := e.environment.call(e, name, exp); ok {
+			return result
+		}
+	}
+	if fn, ok := e.functions[name]; ok {
+		return e.callFunction(name, fn, exp)
+	}
+	if fn, ok := registeredFunction(name); ok {
+		return e.callFunction(name, fn, exp)
+	}
+	if _, ok := builtins[resolveName(name)]; ok && !e.permitted(resolveName(name)) {
+		e.fail(&Error{Func: name, Err: ErrNotAllowed})
+		return FloatError
+	}
+	if a, ok := builtins[resolveName(name)]; ok && !a.accepts(len(exp.Args)) {
+		e.fail(&Error{Func: name, Err: ErrArity})
+	}
+	// alphabetically list of functions, keep builtins in sync
+	switch resolveName(name) {
+	case "abs":
+		return e.abs(exp)
+	case "acos":
+		return e.acos(exp)
+	case "ageSeconds":
+		return e.ageSeconds(exp)
+	case "almostEqual":
+		return e.almostEqual(exp)
+	case "altitudeFromPressure":
+		return e.altitudeFromPressure(exp)
+	case "apparentTemp":
+		return e.apparentTemp(exp)
+	case "argMax":
+		return e.argMax(exp)
+	case "argMin":
+		return e.argMin(exp)
+	case "asin":
+		return e.asin(exp)
+	case "atan":
+		return e.atan(exp)
+	case "atan2":
+		return e.atan2(exp)
+	case "avg":
+		return e.avg(exp)
+	case "backoffDue":
+		return e.backoffDue(exp)
+	case "businessDaysBetween":
+		return e.businessDaysBetween(exp)
+	case "cache":
+		return e.cache(exp)
+	case "camelCase":
+		return e.camelCase(exp)
+	case "ceil":
+		return e.ceil(exp)
+	case "chain":
+		return e.chain(exp)
+	case "changed":
+		return e.changed(exp)
+	case "clamp":
+		return e.clamp(exp)
+	case "coalesce":
+		return e.coalesce(exp)
+	case "cos":
+		return e.cos(exp)
+	case "count":
+		return e.count(exp)
+	case "counterGet":
+		return e.counterGet(exp)
+	case "counterInc":
+		return e.counterInc(exp)
+	case "csvField":
+		return e.csvField(exp)
+	case "csvLine":
+		return e.csvLine(exp)
+	case "deg2rad":
+		return e.deg2rad(exp)
+	case "dewPoint":
+		return e.dewPoint(exp)
+	case "ellipsis":
+		return e.ellipsis(exp)
+	case "env":
+		return e.env(exp)
+	case "exists":
+		return e.exists(exp)
+	case "flapCount":
+		return e.flapCount(exp)
+	case "float64":
+		return e.float64(exp)
+	case "floor":
+		return e.floor(exp)
+	case "fuzzyMatch":
+		return e.fuzzyMatch(exp)
+	case "globMatch":
+		return e.globMatch(exp)
+	case "hashBucket":
+		return e.hashBucket(exp)
+	case "heatIndex":
+		return e.heatIndex(exp)
+	case "hmacSha256":
+		return e.hmacSha256(exp)
+	case "htmlEscape":
+		return e.htmlEscape(exp)
+	case "htmlUnescape":
+		return e.htmlUnescape(exp)
+	case "ifExpr":
+		return e.ifExpr(exp)
+	case "int":
+		return e.int(exp)
+	case "isBetween":
+		return e.isBetween(exp)
+	case "isEmail":
+		return e.isEmail(exp)
+	case "isNaN":
+		return e.isNaN(exp)
+	case "isURL":
+		return e.isURL(exp)
+	case "jsonType":
+		return e.jsonType(exp)
+	case "jsonValid":
+		return e.jsonValid(exp)
+	case "jwtClaim":
+		return e.jwtClaim(exp)
+	case "kebabCase":
+		return e.kebabCase(exp)
+	case "kvGet":
+		return e.kvGet(exp)
+	case "len":
+		return e.length(exp)
+	case "let":
+		return e.let(exp)
+	case "levenshtein":
+		return e.levenshtein(exp)
+	case "lineCount":
+		return e.lineCount(exp)
+	case "lookup":
+		return e.lookupValue(exp)
+	case "lookupTable":
+		return e.lookupTable(exp)
+	case "luhnValid":
+		return e.luhnValid(exp)
+	case "max":
+		return e.max(exp)
+	case "metaphone":
+		return e.metaphone(exp)
+	case "min":
+		return e.min(exp)
+	case "minMax":
+		return e.minMax(exp)
+	case "mod":
+		return e.mod(exp)
+	case "mod97Valid":
+		return e.mod97Valid(exp)
+	case "money":
+		return e.money(exp)
+	case "naturalCompare":
+		return e.naturalCompare(exp)
+	case "normalize":
+		return e.normalize(exp)
+	case "normalizeSpace":
+		return e.normalizeSpace(exp)
+	case "not":
+		return e.not(exp)
+	case "num":
+		return e.num(exp)
+	case "parseTime":
+		return e.parseTime(exp)
+	case "pctChange":
+		return e.pctChange(exp)
+	case "plural":
+		return e.plural(exp)
+	case "popScope":
+		return e.popScope(exp)
+	case "pow":
+		return e.pow(exp)
+	case "previous":
+		return e.previous(exp)
+	case "pushScope":
+		return e.pushScope(exp)
+	case "queryParam":
+		return e.queryParam(exp)
+	case "rad2deg":
+		return e.rad2deg(exp)
+	case "random":
+		return e.randomValue(exp)
+	case "regexpMatch":
+		return e.regexpMatch(exp)
+	case "result":
+		return e.result(exp)
+	case "rollingMax":
+		return e.rollingMax(exp)
+	case "rollingMin":
+		return e.rollingMin(exp)
+	case "round":
+		return e.round(exp)
+	case "score":
+		return e.score(exp)
+	case "seaLevelPressure":
+		return e.seaLevelPressure(exp)
+	case "setEnv":
+		return e.setEnv(exp)
+	case "setVal":
+		return e.setVal(exp)
+	case "sin":
+		return e.sin(exp)
+	case "snakeCase":
+		return e.snakeCase(exp)
+	case "soundex":
+		return e.soundex(exp)
+	case "sqrt":
+		return e.sqrt(exp)
+	case "startOfDay":
+		return e.startOfDay(exp)
+	case "startOfHour":
+		return e.startOfHour(exp)
+	case "startOfMonth":
+		return e.startOfMonth(exp)
+	case "stripAnsi":
+		return e.stripAnsi(exp)
+	case "stripControl":
+		return e.stripControl(exp)
+	case "substr":
+		return e.substr(exp)
+	case "sum":
+		return e.sum(exp)
+	case "switchExpr":
+		return e.switchExpr(exp)
+	case "tan":
+		return e.tan(exp)
+	case "tariff":
+		return e.tariff(exp)
+	case "template":
+		return e.template(exp)
+	case "sprintf":
+		return e.sprintf(exp)
+	case "throttle":
+		return e.throttle(exp)
+	case "time":
+		return e.time(exp)
+	case "titleCase":
+		return e.titleCase(exp)
+	case "translate":
+		return e.translate(exp)
+	case "trunc":
+		return e.trunc(exp)
+	case "uuid":
+		return e.uuid(exp)
+	case "val":
+		return e.val(exp)
+	case "valOr":
+		return e.valOr(exp)
+	case "wavg":
+		return e.wavg(exp)
+	case "windChill":
+		return e.windChill(exp)
+	case "wordCount":
+		return e.wordCount(exp)
+	case "xmlGet":
+		return e.xmlGet(exp)
+	default:
+		e.fail(&Error{Func: name, Err: ErrUnknownFunction})
+		return FloatError
+	}
+}
+
 // abs - implements the 'abs(x)' function and returns the absolute value of x.
 // Returns a float64 value or math.NaN() on error.
 func (e *Eval) abs(exp *ast.CallExpr) float64 {
@@ -189,7 +935,6 @@ func (e *Eval) abs(exp *ast.CallExpr) float64 {
 	case float64:
 		return math.Abs(val)
 	case string:
-		val = stringer(val)
 		float, err := strconv.ParseFloat(val, 64)
 		if err == nil {
 			return math.Abs(float)
@@ -198,606 +943,3218 @@ func (e *Eval) abs(exp *ast.CallExpr) float64 {
 	return FloatError
 }
 
-// avg - implements the 'avg(x,y,z,...)' function and returns the average of a range numbers
+// acos - implements 'acos(x)' which returns the arccosine of x in radians.
+// Returns a float64 value or math.NaN() on error, e.g. for |x| > 1.
+func (e *Eval) acos(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, math.Acos)
+}
+
+// ageSeconds - implements 'ageSeconds(t)' which returns the seconds passed
+// since t, e.g. for staleness checks 'ageSeconds(val("last")) > 300'. t is an
+// epoch in seconds or milliseconds or a timestamp string, see timeLayouts.
 // Returns a float64 value or math.NaN() on error.
-func (e *Eval) avg(exp *ast.CallExpr) float64 {
-	return e.avgMaxMin(exp, 3)
+func (e *Eval) ageSeconds(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	t, ok := toTime(e.getArg(exp.Args[0]))
+	if !ok {
+		return FloatError
+	}
+	return float64(e.now().Sub(t)) / float64(time.Second)
 }
 
-// env - implements the 'env("str")' function, reads the environment variable "str" and
-// returns it's content as string.
-func (e *Eval) env(exp *ast.CallExpr) string {
-	l := len(exp.Args)
-	if l < 1 {
-		return ""
+// almostEqual - implements 'almostEqual(a, b, epsilon)' which returns true
+// when the numbers a and b differ by epsilon at most, e.g. to compare the
+// results of float calculations which are rarely exactly equal.
+//
+// Example:
+//   almostEqual(0.1+0.2, 0.3, 1e-9) ... true
+//
+// Returns true or false, also false for math.NaN() or a negative epsilon.
+func (e *Eval) almostEqual(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 3 {
+		return false
 	}
-	s := e.eval(exp.Args[0])
-	var envResult string
-	switch val := s.(type) {
-	case string:
-		val = stringer(val)
-		envResult = os.Getenv(val)
-	default:
+	a := toNumber(e.getArg(exp.Args[0]))
+	b := toNumber(e.getArg(exp.Args[1]))
+	epsilon := toNumber(e.getArg(exp.Args[2]))
+	if math.IsNaN(epsilon) || epsilon < 0 {
+		return false
 	}
-	return envResult
+	return almostEqual(a, b, epsilon)
 }
 
-// float64 - implements the 'float64(x)' float64(x) function and converts x to float64
-// Returns a float64 value or math.NaN() on error.
-func (e *Eval) float64(exp *ast.CallExpr) float64 {
-	l := len(exp.Args)
-	if l < 1 {
+// almostEqual reports whether a and b differ by epsilon at most,
+// math.NaN() is never equal
+func almostEqual(a, b, epsilon float64) bool {
+	return a == b || math.Abs(a-b) <= epsilon
+}
+
+// altitudeFromPressure - implements 'altitudeFromPressure(hPa, seaLevelhPa)'
+// which returns the altitude in meters at the air pressure hPa using the
+// international barometric formula. seaLevelhPa is optional and defaults
+// to the standard atmosphere of 1013.25 hPa, pass the current sea level
+// pressure of a nearby weather station for a better estimate.
+// Returns a float64 value or math.NaN() on error, e.g. for pressures <= 0.
+func (e *Eval) altitudeFromPressure(exp *ast.CallExpr) float64 {
+	if len(exp.Args) < 1 || len(exp.Args) > 2 {
 		return FloatError
 	}
-	s := e.eval(exp.Args[0])
-	// Attention! Check all basic numeric types - they could be in variables!
-	switch val := s.(type) {
-	case bool:
-		if s.(bool) {
-			return 1.0
-		}
-		return 0.0
-	case int:
-		return float64(val)
-	case int8:
-		return float64(val)
-	case int16:
-		return float64(val)
-	case int32:
-		return float64(val)
-	case int64:
-		return float64(val)
-	case uint:
-		return float64(val)
-	case uint8:
-		return float64(val)
-	case uint16:
-		return float64(val)
-	case uint32:
-		return float64(val)
-	case uint64:
-		return float64(val)
-	case float32:
-		return float64(val)
-	case float64:
-		return val
-	case string:
-		val = stringer(val)
-		f, err := strconv.ParseFloat(val, 64)
-		if err == nil {
-			return f
-		}
-	default:
+	p := toNumber(e.getArg(exp.Args[0]))
+	p0 := standardPressure
+	if len(exp.Args) == 2 {
+		p0 = toNumber(e.getArg(exp.Args[1]))
 	}
-	return FloatError
+	if !(p > 0 && p0 > 0) {
+		return FloatError
+	}
+	return 44330 * (1 - math.Pow(p/p0, 1/5.255))
 }
 
-// ifExpr - implements 'if (<condition>,<true value>,<false value>)' which is
-// similar to an 'if' statement in a programming language.
-// Returns true/false or a math.NaN() on error.
-func (e *Eval) ifExpr(exp *ast.CallExpr) interface{} {
+// apparentTemp - implements 'apparentTemp(tempC, relHumidity, windKmh)'
+// which returns the temperature in °C felt by humans in the shade at the
+// temperature tempC in °C, the relative humidity in percent and the wind
+// speed in km/h using the formula of Steadman as used by the Australian
+// Bureau of Meteorology. Unlike heatIndex() and windChill() it is defined
+// for all temperatures.
+// Returns a float64 value or math.NaN() on error, e.g. for a humidity outside
+// of 0 <= relHumidity <= 100 or a negative wind speed.
+func (e *Eval) apparentTemp(exp *ast.CallExpr) float64 {
 	if len(exp.Args) != 3 {
 		return FloatError
 	}
-	condition := e.getArg(exp.Args[0])
-	trueValue := e.getArg(exp.Args[1])
-	falseValue := e.getArg(exp.Args[2])
-	switch condition.(type) {
-	case bool:
-		if condition.(bool) {
-			if strVal, ok := trueValue.(string); ok {
-				return stringer(strVal)
+	t := toNumber(e.getArg(exp.Args[0]))
+	rh := toNumber(e.getArg(exp.Args[1]))
+	v := toNumber(e.getArg(exp.Args[2]))
+	if math.IsNaN(t) || !(rh >= 0 && rh <= 100) || !(v >= 0) {
+		return FloatError
+	}
+	// water vapour pressure in hPa
+	vp := rh / 100 * 6.105 * math.Exp(17.27*t/(237.7+t))
+	return t + 0.33*vp - 0.70*v/3.6 - 4.00
+}
+
+// argMax - implements 'argMax(n1,n2,...)' which returns the 1-based position
+// of the largest number and 'argMax("name1",n1,"name2",n2,...)' which returns
+// the name of the largest number, e.g. the phase with the highest load.
+// Returns an int, a string or math.NaN() on error.
+func (e *Eval) argMax(exp *ast.CallExpr) interface{} {
+	return e.argMinMax(exp, func(a, b float64) bool { return a > b })
+}
+
+// argMin - implements 'argMin(n1,n2,...)' and 'argMin("name1",n1,...)' like
+// argMax() for the smallest number.
+// Returns an int, a string or math.NaN() on error.
+func (e *Eval) argMin(exp *ast.CallExpr) interface{} {
+	return e.argMinMax(exp, func(a, b float64) bool { return a < b })
+}
+
+// argMinMax returns the position or name of the first number which is
+// better than all others, invalid numbers are skipped
+func (e *Eval) argMinMax(exp *ast.CallExpr, better func(a, b float64) bool) interface{} {
+	// the positions of elements of slices are counted like arguments
+	var args []interface{}
+	for _, arg := range e.args(exp) {
+		if slice := reflect.ValueOf(arg); slice.Kind() == reflect.Slice || slice.Kind() == reflect.Array {
+			for i := 0; i < slice.Len(); i++ {
+				args = append(args, plainValue(slice.Index(i)))
+			}
+			continue
+		}
+		args = append(args, arg)
+	}
+	if len(args) == 0 {
+		return FloatError
+	}
+	// pairs of names and numbers when the first argument is no number
+	pairs := false
+	if s, ok := args[0].(string); ok && math.IsNaN(toNumber(s)) {
+		pairs = true
+		if len(args)%2 != 0 {
+			return FloatError
+		}
+	}
+	var result interface{} = FloatError
+	best := math.NaN()
+	for i := 0; i < len(args); i++ {
+		var name interface{} = i + 1
+		if pairs {
+			if _, ok := args[i].(string); !ok {
+				return FloatError
 			}
-			return trueValue
+			name = args[i]
+			i++
 		}
-		if strVal, ok := falseValue.(string); ok {
-			return stringer(strVal)
+		f := toNumber(args[i])
+		if math.IsNaN(f) {
+			continue
+		}
+		if math.IsNaN(best) || better(f, best) {
+			best, result = f, name
 		}
-		return falseValue
-	default:
 	}
-	return FloatError
+	return result
 }
 
-// isBetween - implements 'isBetween(<val>,from,to)' where <val> must be string or float64
-//
-// Example:
-//   isBetween(env("F"),49.0,51.0) ... checks if environment variable F >= 49.0 && F <= 51.0
-//
-// Returns true/false or a math.NaN() on error.
-func (e *Eval) isBetween(exp *ast.CallExpr) interface{} {
+// asin - implements 'asin(x)' which returns the arcsine of x in radians,
+// e.g. 'rad2deg(asin(sin(lat)*sin(decl) + cos(lat)*cos(decl)*cos(hourAngle)))'
+// is the elevation of the sun.
+// Returns a float64 value or math.NaN() on error, e.g. for |x| > 1.
+func (e *Eval) asin(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, math.Asin)
+}
 
-	if len(exp.Args) != 3 {
+// atan - implements 'atan(x)' which returns the arctangent of x in radians.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) atan(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, math.Atan)
+}
+
+// atan2 - implements 'atan2(y, x)' which returns the arctangent of y/x in
+// radians using the signs of both to determine the quadrant, e.g. the
+// azimuth of the sun or the direction of a wind vector.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) atan2(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	y := toNumber(e.getArg(exp.Args[0]))
+	x := toNumber(e.getArg(exp.Args[1]))
+	return math.Atan2(y, x)
+}
+
+// avg - implements the 'avg(x,y,z,...)' function and returns the average of a range numbers
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) avg(exp *ast.CallExpr) float64 {
+	return e.avgMaxMin(exp, 3)
+}
+
+// backoffDue - implements 'backoffDue(name, baseSeconds, factor, maxSeconds)'
+// which returns true when the next attempt of name is due. The first call is
+// due, then the delay starts at baseSeconds and is multiplied by factor after
+// each due attempt up to maxSeconds, e.g. 'alarm && backoffDue("disk", 60, 2,
+// 3600)' notifies after 0, 1, 3, 7, ... minutes and then every hour. The time
+// of the next attempt and the delay are kept in the StateStore.
+// Returns true or false, false on error.
+func (e *Eval) backoffDue(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 4 {
+		return false
+	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	base := toNumber(e.getArg(exp.Args[1]))
+	factor := toNumber(e.getArg(exp.Args[2]))
+	max := toNumber(e.getArg(exp.Args[3]))
+	if !ok || !(base > 0) || !(factor >= 1) || !(max >= base) {
+		return false
+	}
+	key := "backoffDue:" + name
+	t := float64(e.now().UnixNano()) / 1e9
+	state, _ := e.getState(key).(map[string]interface{})
+	next, found := state["next"].(float64)
+	delay, _ := state["delay"].(float64)
+	switch {
+	case !found:
+		delay = base
+	case t >= next:
+		delay = math.Min(delay*factor, max)
+	default:
 		return false
 	}
+	e.setState(key, map[string]interface{}{"next": t + delay, "delay": delay})
+	return true
+}
 
-	// f64Value converts theValue to float64
-	var f64Value = func(theValue interface{}) float64 {
-		switch v := theValue.(type) {
-		case int:
-			return float64(v)
-		case string:
-			s := stringer(v)
-			if s == "" {
-				return FloatError
-			}
-			if f, err := strconv.ParseFloat(s, 64); err == nil {
-				if math.IsNaN(f) || math.IsInf(f, 0) {
-					return FloatError
-				}
-				return f
-			}
+// businessDaysBetween - implements 'businessDaysBetween(epoch1, epoch2)' and
+// 'businessDaysBetween(epoch1, epoch2, calendar [, tz])' which counts the days
+// Monday to Friday from the day of epoch1 up to but excluding the day of
+// epoch2 in the time zone tz (default local). Public holidays of the calendar,
+// e.g. "AT", are excluded, see RegisterHolidayCalendar(). Spans of more
+// than 1000 years are an error.
+// Returns an int or math.NaN() on error.
+func (e *Eval) businessDaysBetween(exp *ast.CallExpr) interface{} {
+	l := len(exp.Args)
+	if l < 2 || l > 4 {
+		return FloatError
+	}
+	epoch1 := toNumber(e.getArg(exp.Args[0]))
+	epoch2 := toNumber(e.getArg(exp.Args[1]))
+	if math.IsNaN(epoch1) || math.IsNaN(epoch2) || math.IsInf(epoch1, 0) || math.IsInf(epoch2, 0) {
+		return FloatError
+	}
+	if math.Abs(epoch2-epoch1) > maxCalendarDays*86400 {
+		e.fail(errors.New("businessDaysBetween: span of more than 1000 years"))
+		return FloatError
+	}
+	var cal HolidayCalendar
+	if l > 2 {
+		name, ok := e.getArg(exp.Args[2]).(string)
+		if !ok {
 			return FloatError
-		case float64:
-			if math.IsNaN(v) || math.IsInf(v, 0) {
-				return FloatError
-			}
-			return v
-		default:
+		}
+		if cal, ok = holidayCalendar(name); !ok {
+			e.fail(fmt.Errorf("businessDaysBetween: unknown calendar %q", name))
 			return FloatError
 		}
 	}
+	loc := time.Local
+	if l > 3 {
+		tz, ok := e.getArg(exp.Args[3]).(string)
+		if !ok {
+			return FloatError
+		}
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			e.fail(err)
+			return FloatError
+		}
+	}
+	from := time.Unix(int64(epoch1), 0).In(loc)
+	to := time.Unix(int64(epoch2), 0).In(loc)
+	return businessDays(from, to, cal)
+}
 
-	var f64, from, to float64
+// cache - implements 'cache(name, ttlSeconds, value)' which evaluates and
+// returns value and serves this copy in following runs until ttlSeconds
+// are over. value is not evaluated while cached, e.g. an expensive function.
+// Errors (FloatError) are not cached.
+// Returns the value or FloatError on error.
+func (e *Eval) cache(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 3 {
+		return FloatError
+	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	ttl := toNumber(e.getArg(exp.Args[1]))
+	if !ok || math.IsNaN(ttl) {
+		return FloatError
+	}
+	key := "cache:" + name
+	t := float64(e.now().UnixNano()) / 1e9
+	entry, _ := e.getState(key).(map[string]interface{})
+	if expires, ok := entry["expires"].(float64); ok && t < expires {
+		return entry["value"]
+	}
+	value := e.getArg(exp.Args[2])
+	if f, ok := value.(float64); ok && math.IsNaN(f) {
+		return value
+	}
+	e.setState(key, map[string]interface{}{"value": value, "expires": t + ttl})
+	return value
+}
 
-	theValue := e.getArg(exp.Args[0])
-	fromValue := e.getArg(exp.Args[1])
-	toValue := e.getArg(exp.Args[2])
+// camelCase - implements 'camelCase(s)' which converts s to "camelCase".
+// Words are separated by anything but letters and digits and by changes from
+// lower to upper case, e.g. "disk usage %" becomes "diskUsage".
+// Returns a string or an empty string on error.
+func (e *Eval) camelCase(exp *ast.CallExpr) string {
+	return e.caseStyle(exp, "", func(i int, w string) string {
+		if i == 0 {
+			return strings.ToLower(w)
+		}
+		return capitalize(w)
+	})
+}
 
-	f64 = f64Value(theValue)
-	from = f64Value(fromValue)
-	to = f64Value(toValue)
+// caseStyle splits the argument of exp into words, converts each
+// word with f and joins them with sep
+func (e *Eval) caseStyle(exp *ast.CallExpr, sep string, f func(i int, w string) string) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	words := splitWords(s)
+	for i, w := range words {
+		words[i] = f(i, w)
+	}
+	return strings.Join(words, sep)
+}
 
-	return f64 >= from && f64 <= to
+// ceil - implements the 'ceil (x[,y])' function which
+// rounds x up to y decimal places, 0 by default.
+//
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) ceil(exp *ast.CallExpr) float64 {
+	return e.roundWith(exp, math.Ceil)
 }
 
-// isNaN - implements 'isNaN(<val>)' where <val> could be a valid float.
-// This function is usable for error handling.
-// Returns true or false.
-func (e *Eval) isNaN(exp *ast.CallExpr) bool {
-	if len(exp.Args) != 1 {
-		return true
+// chain - implements 'chain(value,"fn1",args...,"fn2",args...)' which applies
+// functions from left to right. The result of each step is passed as first
+// argument to the next function followed by the step's own arguments. A string
+// which names a function always starts a new step.
+//
+// Example:
+//   chain(env("X"),"float64","round",2) ... same as round(float64(env("X")),2)
+//
+// Returns the result of the last function or math.NaN() on error.
+func (e *Eval) chain(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) < 2 {
+		return FloatError
+	}
+	result := e.getArg(exp.Args[0])
+	var args []interface{}
+	for _, arg := range exp.Args[1:] {
+		args = append(args, e.getArg(arg))
+	}
+	for len(args) > 0 {
+		name, ok := args[0].(string)
+		if !ok || !e.isFunction(name) {
+			e.fail(fmt.Errorf("chain: %v is not a function", args[0]))
+			return FloatError
+		}
+		call := &ast.CallExpr{Fun: ast.NewIdent(name), Args: []ast.Expr{&value{v: result}}}
+		for args = args[1:]; len(args) > 0; args = args[1:] {
+			if s, ok := args[0].(string); ok && e.isFunction(s) {
+				break
+			}
+			call.Args = append(call.Args, &value{v: args[0]})
+		}
+		result = e.getArg(call)
 	}
+	return result
+}
 
-	s := e.eval(exp.Args[0])
-	// Attention! Check all basic numeric types - they could be in variables!
-	switch val := s.(type) {
-	case bool:
+// changed - implements 'changed(name, value)' which returns true when value
+// differs from the value of name in the previous run, e.g. 'changed("state",
+// operStatus)' for alerts on state changes. The first run is no change. The
+// value is kept in the StateStore, see previous(). math.NaN() and ±Inf
+// are errors and no values, they are not kept and are no change.
+// Returns true or false, false on error.
+func (e *Eval) changed(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 2 {
 		return false
-	case int:
-		return math.IsNaN(float64(val))
-	case int8:
-		return math.IsNaN(float64(val))
-	case int16:
-		return math.IsNaN(float64(val))
-	case int32:
-		return math.IsNaN(float64(val))
-	case int64:
-		return math.IsNaN(float64(val))
-	case uint:
-		return math.IsNaN(float64(val))
-	case uint8:
-		return math.IsNaN(float64(val))
-	case uint16:
-		return math.IsNaN(float64(val))
-	case uint32:
-		return math.IsNaN(float64(val))
-	case uint64:
-		return math.IsNaN(float64(val))
-	case float32:
-		return math.IsNaN(float64(val))
-	case float64:
-		return math.IsNaN(val)
-	case string:
-		val = stringer(val)
-		f, err := strconv.ParseFloat(val, 64)
-		if err != nil {
-			return true
+	}
+	args := e.args(exp)
+	name, ok := args[0].(string)
+	if !ok {
+		return false
+	}
+	if f, ok := args[1].(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return false
+	}
+	key := "changed:" + name
+	state, _ := e.getState(key).(map[string]interface{})
+	last, found := state["value"]
+	e.setState(key, map[string]interface{}{"value": args[1], "previous": last})
+	return found && !sameValue(last, args[1])
+}
+
+// clamp - implements 'clamp(x,lo,hi)' which returns x bounded into lo..hi,
+// e.g. 'clamp(100*used/size, 0, 100)' instead of 'min(max(...), 100)'.
+// Numbers in strings are accepted like in the other math functions.
+//
+// Example:
+//   clamp(120,0,100) ... 100
+//   clamp("-5",0,100) ... 0
+//
+// Returns a float64 value or math.NaN() on error, e.g. for lo > hi.
+func (e *Eval) clamp(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 3 {
+		return FloatError
+	}
+	x := toNumber(e.getArg(exp.Args[0]))
+	lo := toNumber(e.getArg(exp.Args[1]))
+	hi := toNumber(e.getArg(exp.Args[2]))
+	if math.IsNaN(x) || math.IsNaN(lo) || math.IsNaN(hi) || lo > hi {
+		return FloatError
+	}
+	return math.Max(lo, math.Min(hi, x))
+}
+
+// coalesce - implements 'coalesce(a, b, ...)' which returns the first
+// argument which is no empty string, no math.NaN() and no undefined
+// variable, e.g. 'coalesce(tempSensor1, tempSensor2, 20)' for sensors which
+// may be offline. The arguments after it are not evaluated, undefined
+// variables are no error in strict mode.
+// Returns the value or math.NaN() when all arguments are missing.
+func (e *Eval) coalesce(exp *ast.CallExpr) interface{} {
+	for _, arg := range exp.Args {
+		var v interface{}
+		if ident, ok := arg.(*ast.Ident); ok && ident.Name != "true" && ident.Name != "false" {
+			if v, ok = e.lookup(ident.Name); !ok {
+				continue
+			}
+		} else {
+			v = e.eval(arg)
+		}
+		if !missing(v) {
+			return v
 		}
-		return math.IsNaN(f)
-	default:
-		//
 	}
-	return true
+	return FloatError
 }
 
-// max returns the maximum of a range of numbers
-// Returns float64 or a math.NaN() on error.
-func (e *Eval) max(exp *ast.CallExpr) float64 {
-	return e.avgMaxMin(exp, 2)
+// cos - implements 'cos(x)' which returns the cosine of x radians.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) cos(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, math.Cos)
 }
 
-// min returns the minimum of a range of numbers
-// Returns float64 or a math.NaN() on error.
-func (e *Eval) min(exp *ast.CallExpr) float64 {
-	return e.avgMaxMin(exp, 1)
+// count - implements 'count(x,y,z,...)' which returns how many numbers the
+// arguments contain, the elements of slices included, e.g. count(readings)
+// before avg(readings). Strings which are no numbers and math.NaN() are not
+// counted.
+// Returns an int.
+func (e *Eval) count(exp *ast.CallExpr) int {
+	n := 0
+	for _, f := range e.floatArgs(exp) {
+		if !math.IsNaN(f) {
+			n++
+		}
+	}
+	return n
 }
 
-func (e *Eval) avgMaxMin(exp *ast.CallExpr, flag int) float64 {
-	if len(exp.Args) == 0 {
+// counterGet - implements 'counterGet(name)' which returns the value of the
+// counter name, see counterInc(). Unknown counters are 0.
+// Returns a float64 or FloatError on error.
+func (e *Eval) counterGet(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 1 {
 		return FloatError
 	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return FloatError
+	}
+	n, _ := e.getState("counter:" + name).(float64)
+	return n
+}
 
-	var floats []float64
+// counterInc - implements 'counterInc(name)' and 'counterInc(name, delta)'
+// which adds delta (default 1) to the counter name. Counters are kept between
+// runs of the Eval or the Environment, e.g. to count events.
+// Returns the new value or FloatError on error.
+func (e *Eval) counterInc(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 1 && len(exp.Args) != 2 {
+		return FloatError
+	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	delta := 1.0
+	if len(exp.Args) == 2 {
+		delta = toNumber(e.getArg(exp.Args[1]))
+	}
+	if !ok || math.IsNaN(delta) {
+		return FloatError
+	}
+	n, _ := e.getState("counter:" + name).(float64)
+	n += delta
+	e.setState("counter:"+name, n)
+	return n
+}
 
-	for _, x := range exp.Args {
-		f := e.getArg(x)
-		switch val := f.(type) {
-		case int:
-			floats = append(floats, float64(val))
+// csvField - implements 'csvField(line,index,"sep")' which returns the field at
+// index of the CSV formatted line. Quoted fields may contain the separator and
+// doubled quotes. index starts at 0, negative values count from the end. The
+// separator is optional and defaults to ",".
+//
+// Example:
+//   csvField(line,1) ... "Vienna, AT" when line is srv1,"Vienna, AT",up
+//
+// Returns a string or an empty string on error.
+func (e *Eval) csvField(exp *ast.CallExpr) string {
+	l := len(exp.Args)
+	if l < 2 || l > 3 {
+		return ""
+	}
+	line, ok := e.getArg(exp.Args[0]).(string)
+	index := toNumber(e.getArg(exp.Args[1]))
+	if !ok || math.IsNaN(index) {
+		return ""
+	}
+	r := csv.NewReader(strings.NewReader(line))
+	r.LazyQuotes = true
+	if l == 3 {
+		sep, ok := e.getArg(exp.Args[2]).(string)
+		if !ok || utf8.RuneCountInString(sep) != 1 {
+			return ""
+		}
+		r.Comma, _ = utf8.DecodeRuneInString(sep)
+	}
+	fields, err := r.Read()
+	if err != nil {
+		return ""
+	}
+	i := int(index)
+	if i < 0 {
+		i += len(fields)
+	}
+	if i < 0 || i >= len(fields) {
+		return ""
+	}
+	return fields[i]
+}
+
+// csvLine - implements 'csvLine(v1,v2,...)' which returns the values as CSV
+// record separated by ",". Fields containing the separator, quotes or line
+// breaks are quoted with doubled quotes inside, math.NaN() and values which
+// are no numbers, strings or bools are empty fields.
+//
+// Example:
+//   csvLine("srv1","Vienna, AT",97.5) ... srv1,"Vienna, AT",97.5
+//
+// Returns a string without line break or an empty string on error.
+func (e *Eval) csvLine(exp *ast.CallExpr) string {
+	if len(exp.Args) < 1 {
+		return ""
+	}
+	fields := make([]string, len(exp.Args))
+	for i, arg := range exp.Args {
+		switch v := e.getArg(arg).(type) {
 		case float64:
-			floats = append(floats, val)
-		case string:
-			val = stringer(val)
-			f := toFloat(val)
-			if !math.IsNaN(f) { // skip invalid strings
-				floats = append(floats, f)
+			if !math.IsNaN(v) {
+				fields[i] = fmt.Sprint(v)
 			}
+		default:
+			fields[i] = fmt.Sprint(v)
 		}
 	}
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	if err := w.Write(fields); err != nil {
+		return ""
+	}
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
 
-	if len(floats) < 1 {
+// deg2rad - implements 'deg2rad(x)' which converts x degrees to radians,
+// e.g. 'sin(deg2rad(30))' is 0.5.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) deg2rad(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, func(x float64) float64 { return x * math.Pi / 180 })
+}
+
+// dewPoint - implements 'dewPoint(tempC, relHumidity)' which returns the dew
+// point in °C of air with the temperature tempC in °C and the relative
+// humidity in percent using the Magnus formula, e.g. 'tempC - dewPoint(tempC,
+// rh) < 2' warns of condensation.
+// Returns a float64 value or math.NaN() on error, e.g. for a humidity outside
+// of 0 < relHumidity <= 100.
+func (e *Eval) dewPoint(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	t := toNumber(e.getArg(exp.Args[0]))
+	rh := toNumber(e.getArg(exp.Args[1]))
+	if math.IsNaN(t) || !(rh > 0 && rh <= 100) {
 		return FloatError
 	}
+	const a, b = 17.62, 243.12
+	gamma := math.Log(rh/100) + a*t/(b+t)
+	return b * gamma / (a - gamma)
+}
 
-	var val float64
+// ellipsis - implements 'ellipsis(s, maxRunes)' which shortens s to at most
+// maxRunes characters for channels with length limits like SMS. When s is
+// cut, the last character is replaced by "…".
+// Returns a string or an empty string on error.
+func (e *Eval) ellipsis(exp *ast.CallExpr) string {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	n := toNumber(e.getArg(exp.Args[1]))
+	if !ok || math.IsNaN(n) || n < 1 {
+		return ""
+	}
+	max := int(n)
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
 
-	switch flag {
-	case 1:
-		val = floats[0]
-		for i := 1; i < len(floats); i++ {
-			val = math.Min(val, floats[i])
-		}
-	case 2:
-		val = floats[0]
-		for i := 1; i < len(floats); i++ {
-			val = math.Max(val, floats[i])
-		}
+// env - implements the 'env("str")' function, reads the environment variable "str" and
+// returns it's content as string.
+func (e *Eval) env(exp *ast.CallExpr) string {
+	l := len(exp.Args)
+	if l < 1 {
+		return ""
+	}
+	s := e.eval(exp.Args[0])
+	var envResult string
+	switch val := s.(type) {
+	case string:
+		envResult = e.getenv(val)
+	default:
+	}
+	return envResult
+}
+
+// exists - implements 'exists("name")' and reports whether the variable
+// name is set, also when it holds an empty string or math.NaN(). Unlike
+// val() a missing variable is no error in strict mode.
+// Returns a bool value, false on error.
+func (e *Eval) exists(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return false
+	}
+	name, ok := e.eval(exp.Args[0]).(string)
+	if !ok {
+		return false
+	}
+	_, ok = e.lookup(name)
+	return ok
+}
+
+// flapCount - implements 'flapCount(name, boolValue, windowSeconds)' which
+// counts the changes of boolValue between the runs of the last windowSeconds,
+// e.g. 'down && flapCount("web", down, 600) < 3' suppresses alerts of a
+// flapping service. The last value and the times of the changes are kept in
+// the StateStore, the first run is no change.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) flapCount(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 3 {
+		return FloatError
+	}
+	name, ok1 := e.getArg(exp.Args[0]).(string)
+	value, ok2 := e.getArg(exp.Args[1]).(bool)
+	window := toNumber(e.getArg(exp.Args[2]))
+	if !ok1 || !ok2 || math.IsNaN(window) {
+		return FloatError
+	}
+	key := "flapCount:" + name
+	t := float64(e.now().UnixNano()) / 1e9
+	state, _ := e.getState(key).(map[string]interface{})
+	var kept []float64
+	for _, change := range floatSlice(state["t"]) {
+		if change > t-window {
+			kept = append(kept, change)
+		}
+	}
+	if last, found := state["last"].(bool); found && last != value {
+		kept = append(kept, t)
+	}
+	e.setState(key, map[string]interface{}{"t": kept, "last": value})
+	return float64(len(kept))
+}
+
+// float64 - implements the 'float64(x)' float64(x) function and converts x to float64
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) float64(exp *ast.CallExpr) float64 {
+	l := len(exp.Args)
+	if l < 1 {
+		return FloatError
+	}
+	s := e.eval(exp.Args[0])
+	// Attention! Check all basic numeric types - they could be in variables!
+	switch val := s.(type) {
+	case bool:
+		if s.(bool) {
+			return 1.0
+		}
+		return 0.0
+	case int:
+		return float64(val)
+	case int8:
+		return float64(val)
+	case int16:
+		return float64(val)
+	case int32:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint:
+		return float64(val)
+	case uint8:
+		return float64(val)
+	case uint16:
+		return float64(val)
+	case uint32:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case float32:
+		return float64(val)
+	case float64:
+		return val
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err == nil {
+			return f
+		}
+	default:
+	}
+	return FloatError
+}
+
+// floor - implements the 'floor (x[,y])' function which
+// rounds x down to y decimal places, 0 by default.
+//
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) floor(exp *ast.CallExpr) float64 {
+	return e.roundWith(exp, math.Floor)
+}
+
+// fuzzyMatch - implements 'fuzzyMatch(a,b,threshold)' which returns true when
+// the similarity of a and b is at least threshold. The similarity is 1 minus
+// the Levenshtein distance divided by the length of the longer string, so 1.0
+// means equal and 0.0 completely different.
+//
+// Example:
+//   fuzzyMatch("srv-web01","srv-web1",0.8) ... true
+//
+// Returns true or false.
+func (e *Eval) fuzzyMatch(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 3 {
+		return false
+	}
+	a, ok1 := e.getArg(exp.Args[0]).(string)
+	b, ok2 := e.getArg(exp.Args[1]).(string)
+	threshold := toNumber(e.getArg(exp.Args[2]))
+	if !ok1 || !ok2 || math.IsNaN(threshold) {
+		return false
+	}
+	n := len([]rune(a))
+	if m := len([]rune(b)); m > n {
+		n = m
+	}
+	if n == 0 {
+		return true
+	}
+	return 1-float64(levenshtein(a, b))/float64(n) >= threshold
+}
+
+// globMatch - implements 'globMatch("<pattern>","string")' which returns true
+// when string matches the shell pattern. '*' matches any sequence of characters
+// except '/', '?' a single character and [a-z] a character class, see path.Match.
+//
+// Example:
+//   globMatch("eth*",val("ifName")) ... true for eth0, eth1, ...
+//
+// Returns true or false.
+func (e *Eval) globMatch(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 2 {
+		return false
+	}
+	pattern, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return false
+	}
+	var s string
+	switch v := e.getArg(exp.Args[1]).(type) {
+	case string:
+		s = v
+	case int:
+		s = strconv.Itoa(v)
+	default:
+		return false
+	}
+	matched, err := path.Match(pattern, s)
+	return err == nil && matched
+}
+
+// hashBucket - implements 'hashBucket(s, n)' which maps s to a stable bucket
+// 0..n-1 using the FNV-1a hash of s, e.g. for canary rollouts like
+// 'hashBucket(host, 10) == 0' to select 10% of the hosts.
+// Returns an int or FloatError on error.
+func (e *Eval) hashBucket(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	n := toNumber(e.getArg(exp.Args[1]))
+	if !ok || math.IsNaN(n) || n < 1 || n > math.MaxUint32 {
+		return FloatError
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return int(h.Sum32() % uint32(n))
+}
+
+// heatIndex - implements 'heatIndex(tempC, relHumidity)' which returns the
+// temperature in °C felt by humans at the temperature tempC in °C and the
+// relative humidity in percent using the regression of the US National
+// Weather Service.
+// Returns a float64 value or math.NaN() on error, e.g. for a humidity outside
+// of 0 <= relHumidity <= 100.
+func (e *Eval) heatIndex(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	t := toNumber(e.getArg(exp.Args[0]))
+	rh := toNumber(e.getArg(exp.Args[1]))
+	if math.IsNaN(t) || !(rh >= 0 && rh <= 100) {
+		return FloatError
+	}
+	f := t*9/5 + 32
+	hi := 0.5 * (f + 61 + (f-68)*1.2 + rh*0.094)
+	if (hi+f)/2 >= 80 {
+		hi = -42.379 + 2.04901523*f + 10.14333127*rh - 0.22475541*f*rh -
+			0.00683783*f*f - 0.05481717*rh*rh + 0.00122874*f*f*rh +
+			0.00085282*f*rh*rh - 0.00000199*f*f*rh*rh
+		switch {
+		case rh < 13 && f >= 80 && f <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(f-95))/17)
+		case rh > 85 && f >= 80 && f <= 87:
+			hi += (rh - 85) / 10 * (87 - f) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9
+}
+
+// hmacSha256 - implements 'hmacSha256(key, message)' which signs message
+// with HMAC-SHA256, e.g. for webhook payloads.
+// Returns the signature as lower case hex string or an empty string on error.
+func (e *Eval) hmacSha256(exp *ast.CallExpr) string {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+	key, ok1 := e.getArg(exp.Args[0]).(string)
+	msg, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// htmlEscape - implements 'htmlEscape(s)' which escapes <, >, &, ' and " so
+// s can be embedded into HTML mails or dashboards.
+// Returns a string or an empty string on error.
+func (e *Eval) htmlEscape(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return html.EscapeString(s)
+}
+
+// htmlUnescape - implements 'htmlUnescape(s)' which converts entities like
+// "&lt;" or "&#228;" back to their characters.
+// Returns a string or an empty string on error.
+func (e *Eval) htmlUnescape(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return html.UnescapeString(s)
+}
+
+// ifExpr - implements 'if (<condition>,<true value>,<false value>)' which is
+// similar to an 'if' statement in a programming language. Only the value
+// selected by the condition is evaluated, e.g. setVal() in the other one
+// is not run.
+// Returns true/false or a math.NaN() on error.
+func (e *Eval) ifExpr(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 3 {
+		return FloatError
+	}
+	condition, ok := e.condition(exp.Args[0])
+	if !ok {
+		return FloatError
+	}
+	selected := exp.Args[2]
+	if condition {
+		selected = exp.Args[1]
+	}
+	// e.g. a Result of result()
+	return e.value(selected)
+}
+
+// isBetween - implements 'isBetween(<val>,from,to)' where <val> must be string or float64
+// and 'isBetween(<val>,from,to,mode)' where mode "[]", "()", "[)" or "(]" selects
+// inclusive '[]' or exclusive '()' bounds, the default is "[]".
+//
+// Example:
+//   isBetween(env("F"),49.0,51.0) ... checks if environment variable F >= 49.0 && F <= 51.0
+//   isBetween(env("F"),49.0,51.0,"[)") ... checks if F >= 49.0 && F < 51.0
+//
+// Returns true/false or a math.NaN() on error.
+func (e *Eval) isBetween(exp *ast.CallExpr) interface{} {
+
+	if len(exp.Args) != 3 && len(exp.Args) != 4 {
+		return false
+	}
+
+	mode := "[]"
+	if len(exp.Args) == 4 {
+		m, ok := e.getArg(exp.Args[3]).(string)
+		if !ok {
+			return false
+		}
+		mode = m
+	}
+	if len(mode) != 2 || !strings.ContainsRune("[(", rune(mode[0])) || !strings.ContainsRune("])", rune(mode[1])) {
+		return false
+	}
+
+	// f64Value converts theValue to float64
+	var f64Value = func(theValue interface{}) float64 {
+		switch v := theValue.(type) {
+		case int:
+			return float64(v)
+		case string:
+			s := v
+			if s == "" {
+				return FloatError
+			}
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				if math.IsNaN(f) || math.IsInf(f, 0) {
+					return FloatError
+				}
+				return f
+			}
+			return FloatError
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return FloatError
+			}
+			return v
+		default:
+			return FloatError
+		}
+	}
+
+	var f64, from, to float64
+
+	theValue := e.getArg(exp.Args[0])
+	fromValue := e.getArg(exp.Args[1])
+	toValue := e.getArg(exp.Args[2])
+
+	f64 = f64Value(theValue)
+	from = f64Value(fromValue)
+	to = f64Value(toValue)
+
+	lower := f64 >= from
+	if mode[0] == '(' {
+		lower = f64 > from
+	}
+	upper := f64 <= to
+	if mode[1] == ')' {
+		upper = f64 < to
+	}
+	return lower && upper
+}
+
+// isEmail - implements 'isEmail(s)' which checks if s is a syntactically valid
+// e-mail address like "john@example.com" (RFC 5322 without display name).
+// Returns true or false.
+func (e *Eval) isEmail(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return false
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// isNaN - implements 'isNaN(<val>)' where <val> could be a valid float.
+// This function is usable for error handling.
+// Returns true or false.
+func (e *Eval) isNaN(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return true
+	}
+
+	s := e.eval(exp.Args[0])
+	// Attention! Check all basic numeric types - they could be in variables!
+	switch val := s.(type) {
+	case bool:
+		return false
+	case int:
+		return math.IsNaN(float64(val))
+	case int8:
+		return math.IsNaN(float64(val))
+	case int16:
+		return math.IsNaN(float64(val))
+	case int32:
+		return math.IsNaN(float64(val))
+	case int64:
+		return math.IsNaN(float64(val))
+	case uint:
+		return math.IsNaN(float64(val))
+	case uint8:
+		return math.IsNaN(float64(val))
+	case uint16:
+		return math.IsNaN(float64(val))
+	case uint32:
+		return math.IsNaN(float64(val))
+	case uint64:
+		return math.IsNaN(float64(val))
+	case float32:
+		return math.IsNaN(float64(val))
+	case float64:
+		return math.IsNaN(val)
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return true
+		}
+		return math.IsNaN(f)
+	default:
+		//
+	}
+	return true
+}
+
+// jsonType - implements 'jsonType("<json>","<path>")' which returns the type of
+// the element at path. Path elements are separated by '/', numbers select array
+// elements and an empty path selects the whole document.
+//
+// Example:
+//   jsonType(payload,"device/temp") ... "number"
+//
+// Returns "object", "array", "string", "number", "bool", "null" or an empty
+// string when the JSON is invalid or path is not found.
+func (e *Eval) jsonType(exp *ast.CallExpr) string {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+	text, ok1 := e.getArg(exp.Args[0]).(string)
+	path, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return ""
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(text), &doc); err != nil {
+		return ""
+	}
+	x, ok := jsonPath(doc, path)
+	if !ok {
+		return ""
+	}
+	switch x.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	}
+	return "null"
+}
+
+// jsonValid - implements 'jsonValid("<json>")' which checks if the
+// string is well-formed JSON.
+// Returns true or false.
+func (e *Eval) jsonValid(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return false
+	}
+	text, ok := e.getArg(exp.Args[0]).(string)
+	return ok && json.Valid([]byte(text))
+}
+
+// jwtClaim - implements 'jwtClaim(token, claim)' and 'jwtClaim(token, claim, key)'
+// which decodes the payload of the JSON web token and returns the claim, e.g.
+// "exp" to monitor token expiry. Nested claims are separated by '/'. Without
+// key the token is not verified, with key the HS256 signature must match.
+// Returns the claim (objects and arrays as JSON text) or FloatError on error.
+func (e *Eval) jwtClaim(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 && len(exp.Args) != 3 {
+		return FloatError
+	}
+	token, ok1 := e.getArg(exp.Args[0]).(string)
+	claim, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return FloatError
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return FloatError
+	}
+	if len(exp.Args) == 3 {
+		key, ok := e.getArg(exp.Args[2]).(string)
+		if !ok || !jwtVerify(parts, key) {
+			return FloatError
+		}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return FloatError
+	}
+	var doc interface{}
+	if json.Unmarshal(payload, &doc) != nil {
+		return FloatError
+	}
+	v, _ := jsonPath(doc, claim)
+	switch v.(type) {
+	case string, float64, bool:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	// missing claim or null
+	return FloatError
+}
+
+// kebabCase - implements 'kebabCase(s)' which converts s to "kebab-case",
+// see camelCase() for the word separation.
+// Returns a string or an empty string on error.
+func (e *Eval) kebabCase(exp *ast.CallExpr) string {
+	return e.caseStyle(exp, "-", func(i int, w string) string {
+		return strings.ToLower(w)
+	})
+}
+
+// kvGet - implements 'kvGet("<text>","<key>")' which parses key=value pairs
+// separated by ';', ',' or newlines as often returned by devices and agents
+// and returns the value of key. Spaces around keys and values are removed.
+//
+// Example:
+//   kvGet("a=1;b=two;c=3","b")          ... "two"
+//   float64(kvGet("temp=21.5,hum=40","temp")) ... 21.5
+//
+// Returns a string or an empty string when key is not found.
+func (e *Eval) kvGet(exp *ast.CallExpr) string {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+	text, ok1 := e.getArg(exp.Args[0]).(string)
+	key, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return ""
+	}
+	pairs := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ';' || r == ',' || r == '\n'
+	})
+	for _, pair := range pairs {
+		k, v, found := strings.Cut(pair, "=")
+		if found && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// length - implements 'len(x)' which returns the number of elements of the
+// slice x or the number of characters of the string x, e.g. len(samples).
+// Returns an int or FloatError on error.
+func (e *Eval) length(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	x := e.eval(exp.Args[0])
+	if s, ok := x.(string); ok {
+		return utf8.RuneCountInString(s)
+	}
+	switch v := reflect.ValueOf(x); v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len()
+	}
+	return FloatError
+}
+
+// let - implements 'let("<name>",<value>,...,<body>)' which binds one or more
+// variables to values and evaluates body with them. The variables are only
+// visible inside body and each value is calculated only once.
+//
+// Example:
+//   let("x",pow(val("v"),2),ifExpr(x>100,100,x)) ... caps v² at 100
+//
+// Returns the result of body or math.NaN() on error.
+func (e *Eval) let(exp *ast.CallExpr) interface{} {
+	l := len(exp.Args)
+	if l < 3 || l%2 == 0 {
+		return FloatError
+	}
+	e.PushScope()
+	defer func() { _ = e.PopScope() }()
+	for i := 0; i < l-1; i += 2 {
+		name, ok := e.getArg(exp.Args[i]).(string)
+		if !ok || name == "" {
+			return FloatError
+		}
+		e.setVariable(name, e.value(exp.Args[i+1]))
+	}
+	return e.value(exp.Args[l-1])
+}
+
+// levenshtein - implements 'levenshtein(a,b)' which returns the number of
+// single character edits (insert, delete, substitute) needed to change a into b.
+// Returns an int or math.NaN() on error.
+func (e *Eval) levenshtein(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	a, ok1 := e.getArg(exp.Args[0]).(string)
+	b, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return FloatError
+	}
+	return levenshtein(a, b)
+}
+
+// lineCount - implements 'lineCount(s)' which counts the lines of s, e.g.
+// of captured command output. A final line break does not start a new line.
+// Returns an int or FloatError on error.
+func (e *Eval) lineCount(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return FloatError
+	}
+	if s == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(s, "\n"), "\n") + 1
+}
+
+// lookupValue - implements 'lookup(x, key1, value1, key2, value2, ..., default)'
+// which returns the value of the first key matching x, e.g.
+// 'lookup(status, "0", "OK", "1", "Degraded", "2", "Failed", "unknown")'.
+// Numbers match keys with the same value, 2.0 matches "2". The default is
+// optional.
+// Returns the value, the default or math.NaN() when no key matches.
+func (e *Eval) lookupValue(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) < 3 {
+		return FloatError
+	}
+	args := e.args(exp)
+	x, ok := lookupKey(args[0])
+	if !ok {
+		return FloatError
+	}
+	pairs := args[1:]
+	for ; len(pairs) >= 2; pairs = pairs[2:] {
+		if key, ok := lookupKey(pairs[0]); ok && key == x {
+			return pairs[1]
+		}
+	}
+	if len(pairs) == 1 {
+		return pairs[0]
+	}
+	return FloatError
+}
+
+// lookupTable - implements 'lookupTable(name, x)' and 'lookupTable(name, x,
+// default)' which returns the value of x in the table registered as name with
+// RegisterLookupTable(), e.g. 'lookupTable("oper-status", ifOperStatus)'.
+// Numbers match keys with the same value like in lookup().
+// Returns the value, the default or math.NaN() when x is not found.
+func (e *Eval) lookupTable(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 && len(exp.Args) != 3 {
+		return FloatError
+	}
+	args := e.args(exp)
+	name, ok := args[0].(string)
+	if !ok {
+		return FloatError
+	}
+	table, found := lookupTableByName(name)
+	if !found {
+		e.fail(&Error{Func: "lookupTable", Err: fmt.Errorf("unknown table %q", name)})
+		return FloatError
+	}
+	if x, ok := lookupKey(args[1]); ok {
+		if v, ok := table[x]; ok {
+			return v
+		}
+	}
+	if len(args) == 3 {
+		return args[2]
+	}
+	return FloatError
+}
+
+// luhnValid - implements 'luhnValid(s)' which checks the Luhn check digit of s,
+// e.g. of credit card numbers or IMEIs. Spaces and dashes are ignored.
+// Returns true or false.
+func (e *Eval) luhnValid(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return false
+	}
+	s, ok := e.checkDigitArg(exp.Args[0])
+	if !ok || len(s) < 2 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+		d := int(s[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isURL - implements 'isURL(s)' which checks if s is an absolute URL with
+// scheme and host like "https://example.com/path".
+// Returns true or false.
+func (e *Eval) isURL(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return false
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok || strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// max returns the maximum of a range of numbers
+// Returns float64 or a math.NaN() on error.
+func (e *Eval) max(exp *ast.CallExpr) float64 {
+	return e.avgMaxMin(exp, 2)
+}
+
+// metaphone - implements 'metaphone(s)' which returns the Metaphone key of s.
+// Names which sound alike in English get the same key.
+// Returns a string or an empty string on error.
+func (e *Eval) metaphone(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return metaphone(s)
+}
+
+// min returns the minimum of a range of numbers
+// Returns float64 or a math.NaN() on error.
+func (e *Eval) min(exp *ast.CallExpr) float64 {
+	return e.avgMaxMin(exp, 1)
+}
+
+func (e *Eval) avgMaxMin(exp *ast.CallExpr, flag int) float64 {
+	floats := e.floatArgs(exp)
+	if len(floats) < 1 {
+		return FloatError
+	}
+
+	var val float64
+
+	switch flag {
+	case 1:
+		val = floats[0]
+		for i := 1; i < len(floats); i++ {
+			val = math.Min(val, floats[i])
+		}
+	case 2:
+		val = floats[0]
+		for i := 1; i < len(floats); i++ {
+			val = math.Max(val, floats[i])
+		}
 	case 3:
 		for _, f := range floats {
 			val = val + f
 		}
-		val = val / float64(len(floats))
+		val = val / float64(len(floats))
+	case 4:
+		for _, f := range floats {
+			val = val + f
+		}
+	}
+
+	return val
+}
+
+// floatArgs returns the numeric arguments of exp, the elements of slices
+// like []float64 included, invalid strings are skipped
+func (e *Eval) floatArgs(exp *ast.CallExpr) []float64 {
+	var floats []float64
+	add := func(f interface{}) {
+		switch val := f.(type) {
+		case int:
+			floats = append(floats, float64(val))
+		case float64:
+			floats = append(floats, val)
+		case string:
+			f := toFloat(val)
+			if !math.IsNaN(f) { // skip invalid strings
+				floats = append(floats, f)
+			}
+		}
+	}
+
+	for _, x := range exp.Args {
+		v := e.eval(x)
+		if slice := reflect.ValueOf(v); slice.Kind() == reflect.Slice || slice.Kind() == reflect.Array {
+			for i := 0; i < slice.Len(); i++ {
+				add(argValue(plainValue(slice.Index(i))))
+			}
+			continue
+		}
+		add(argValue(v))
+	}
+	return floats
+}
+
+// minMax - implements 'minMax(n1,n2,...)' which returns the minimum and
+// the maximum of a range of numbers at once, see min() and max(). Use
+// setVal to assign both: 'setVal("lo","hi", minMax(a,b,c))'.
+// Returns Values with 2 float64 values or math.NaN() on error.
+func (e *Eval) minMax(exp *ast.CallExpr) interface{} {
+	floats := e.floatArgs(exp)
+	if len(floats) < 1 {
+		return FloatError
+	}
+	lo, hi := floats[0], floats[0]
+	for _, f := range floats[1:] {
+		lo = math.Min(lo, f)
+		hi = math.Max(hi, f)
+	}
+	return Values{lo, hi}
+}
+
+// mod - implements 'mod(x, y)' which is the same as 'x % y', e.g.
+// 'mod(n, 2) == 0' for even numbers.
+// Returns an int for two ints, a float64 value with the sign of x
+// otherwise or math.NaN() on error, e.g. for y == 0.
+func (e *Eval) mod(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	x, y := e.eval(exp.Args[0]), e.eval(exp.Args[1])
+	if r, ok := uintRemainder(x, y); ok {
+		return r
+	}
+	return remainder(argValue(x), argValue(y))
+}
+
+// money - implements 'money(x, "<currency>", "<locale>")' which rounds x to
+// the minor units of the ISO 4217 currency, e.g. 2 for EUR and 0 for JPY,
+// and formats it with the currency symbol. locale is optional and defaults
+// to "en".
+//
+// Example:
+//   money(1234.567, "EUR")        ... "€1,234.57"
+//   money(1234.567, "EUR", "de")  ... "1.234,57 €"
+//   money(1234.5, "JPY")          ... "¥1,235"
+//
+// Returns a string or an empty string on error, e.g. for unknown currencies
+// or locales.
+func (e *Eval) money(exp *ast.CallExpr) string {
+	if len(exp.Args) < 2 || len(exp.Args) > 3 {
+		return ""
+	}
+	x := toNumber(e.getArg(exp.Args[0]))
+	code, ok := e.getArg(exp.Args[1]).(string)
+	if !ok {
+		return ""
+	}
+	locale := "en"
+	if len(exp.Args) == 3 {
+		if locale, ok = e.getArg(exp.Args[2]).(string); !ok {
+			return ""
+		}
+	}
+	s, _ := formatMoney(x, code, locale)
+	return s
+}
+
+// naturalCompare - implements 'naturalCompare(a,b)' which compares the strings
+// a and b in natural order where embedded numbers are compared by value,
+// e.g. "eth2" is before "eth10". Numbers with leading zeros are before
+// the same number without, "a01" is before "a1".
+// Returns -1, 0 or 1 as int or math.NaN() on error.
+func (e *Eval) naturalCompare(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	a, ok1 := e.getArg(exp.Args[0]).(string)
+	b, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return FloatError
+	}
+	return naturalCompare(a, b)
+}
+
+// normalize - implements 'normalize(x, min, max)' which maps x from the range
+// min..max to 0..1, values outside are clamped, e.g. 'normalize(rtt, 0.2, 0.01)'
+// is 1 for a fast and 0 for a slow round trip. min may be larger than max to
+// invert the range.
+// Returns a float64 value or math.NaN() on error, e.g. when min equals max.
+func (e *Eval) normalize(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 3 {
+		return FloatError
+	}
+	x := toNumber(e.getArg(exp.Args[0]))
+	min := toNumber(e.getArg(exp.Args[1]))
+	max := toNumber(e.getArg(exp.Args[2]))
+	if math.IsNaN(x) || math.IsNaN(min) || math.IsNaN(max) || min == max {
+		return FloatError
+	}
+	return math.Max(0, math.Min(1, (x-min)/(max-min)))
+}
+
+// normalizeSpace - implements 'normalizeSpace(s)' which collapses all runs of
+// white space including newlines to a single space and trims both ends.
+// Returns a string or an empty string on error.
+func (e *Eval) normalizeSpace(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// not - implements 'not(x)' which negates the bool x like '!x', e.g.
+// 'not(regexpMatch("^eth", name))'.
+// Returns true/false or math.NaN() on error, e.g. for numbers.
+func (e *Eval) not(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	if b, ok := e.condition(exp.Args[0]); ok {
+		return !b
+	}
+	return FloatError
+}
+
+// num - implements 'num(x)' which converts x to a float64 value for
+// arithmetic. Numbers and numeric strings with surrounding white space are
+// converted, everything else including "" of a missing env() or val() is
+// math.NaN(), so that 'num(env("X")) * 2' is NaN and not an error.
+// Returns a float64 value or math.NaN().
+func (e *Eval) num(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	x := e.getArg(exp.Args[0])
+	if s, ok := x.(string); ok {
+		x = strings.TrimSpace(s)
+	}
+	return toNumber(x)
+}
+
+// parseTime - implements 'parseTime(s)' and 'parseTime(s, layout)' which
+// returns the epoch of the timestamp s. Without layout s is parsed like
+// in ageSeconds(), see timeLayouts, otherwise with the Go reference
+// layout like "02.01.2006 15:04". Timestamps without time zone are local
+// time.
+//
+// Example:
+//   parseTime("2024-06-15T12:30:00Z") ... 1718454600
+//
+// Returns the epoch as float64 value or math.NaN() on error.
+func (e *Eval) parseTime(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 1 && len(exp.Args) != 2 {
+		return FloatError
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return FloatError
+	}
+	var t time.Time
+	if len(exp.Args) == 1 {
+		if t, ok = toTime(s); !ok {
+			return FloatError
+		}
+	} else {
+		layout, ok := e.getArg(exp.Args[1]).(string)
+		if !ok {
+			return FloatError
+		}
+		var err error
+		if t, err = time.ParseInLocation(layout, strings.TrimSpace(s), time.Local); err != nil {
+			return FloatError
+		}
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// pctChange - implements 'pctChange(old, new)' and 'pctChange(old, new,
+// fallback)' which returns the change from old to new in percent of old, e.g.
+// 'pctChange(100, 120)' is 20. A negative old value keeps the direction, from
+// -100 to -50 is +50. No change from 0 to 0 is 0, any other change from 0 or
+// with NaN is undefined and returns fallback, which defaults to math.NaN(),
+// but never ±Inf.
+// Returns a float64 value, fallback or math.NaN() on error.
+func (e *Eval) pctChange(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 && len(exp.Args) != 3 {
+		return FloatError
+	}
+	old := toNumber(e.getArg(exp.Args[0]))
+	new := toNumber(e.getArg(exp.Args[1]))
+	fallback := FloatError
+	if len(exp.Args) == 3 {
+		fallback = toNumber(e.getArg(exp.Args[2]))
+	}
+	switch {
+	case math.IsNaN(old) || math.IsNaN(new) || math.IsInf(old, 0) || math.IsInf(new, 0):
+		return fallback
+	case old == 0 && new == 0:
+		return 0
+	case old == 0:
+		return fallback
+	}
+	return (new - old) / math.Abs(old) * 100
+}
+
+// plural - implements 'plural(n,"singular","plural")' which returns singular
+// when n is 1 and plural otherwise. The text is translated when a message
+// catalog is set.
+//
+// Example:
+//   sprintf("%d %s down",n,plural(n,"host","hosts")) ... "1 host down"
+//
+// Returns a string or an empty string on error.
+func (e *Eval) plural(exp *ast.CallExpr) string {
+	if len(exp.Args) != 3 {
+		return ""
+	}
+	n := toNumber(e.getArg(exp.Args[0]))
+	singular, ok1 := e.getArg(exp.Args[1]).(string)
+	plural, ok2 := e.getArg(exp.Args[2]).(string)
+	if math.IsNaN(n) || !ok1 || !ok2 {
+		return ""
+	}
+	if n == 1 {
+		return e.translateText(singular)
+	}
+	return e.translateText(plural)
+}
+
+// popScope - implements 'popScope()' and removes the innermost scope
+// created by pushScope() together with all its variables.
+// Returns nil.
+func (e *Eval) popScope(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 0 {
+		return FloatError
+	}
+	if err := e.PopScope(); err != nil {
+		e.fail(err)
+	}
+	return nil
+}
+
+// previous - implements 'previous(name)' which returns the value of name
+// before the last call of changed(), e.g. 'changed("temp", t) && t - previous("temp")
+// > 5' for a rise of more than 5 degrees.
+// Returns the value or math.NaN() when there is none.
+func (e *Eval) previous(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return FloatError
+	}
+	state, _ := e.getState("changed:" + name).(map[string]interface{})
+	if prev, ok := state["previous"]; ok && prev != nil {
+		return prev
+	}
+	return FloatError
+}
+
+// pushScope - implements 'pushScope()' and opens a new scope. Variables
+// set with setVal are stored in this scope until popScope() is called.
+// Returns nil.
+func (e *Eval) pushScope(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 0 {
+		return FloatError
+	}
+	e.PushScope()
+	return nil
+}
+
+// mod97Valid - implements 'mod97Valid(s)' which checks ISO 7064 MOD 97-10
+// check digits as used by IBANs. Spaces and dashes are ignored, letters
+// count as 10 to 35.
+// Returns true or false.
+func (e *Eval) mod97Valid(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 1 {
+		return false
+	}
+	s, ok := e.checkDigitArg(exp.Args[0])
+	if !ok || len(s) < 5 {
+		return false
+	}
+	s = strings.ToUpper(s[4:] + s[:4])
+	remainder := 0
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// checkDigitArg returns the argument of luhnValid() and mod97Valid()
+// as string without spaces and dashes
+func (e *Eval) checkDigitArg(arg ast.Expr) (string, bool) {
+	var s string
+	switch v := e.getArg(arg).(type) {
+	case string:
+		s = v
+	case int:
+		s = strconv.Itoa(v)
+	default:
+		return "", false
+	}
+	return strings.NewReplacer(" ", "", "-", "").Replace(s), true
+}
+
+// pow - implements 'pow(<base x>,<exponent y>)' and returns x**y, the base-x exponential of y.
+// Returns a float64 value or a math.NaN() on error.
+func (e *Eval) pow(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+
+	fa := toNumber(e.getArg(exp.Args[0]))
+	fb := toNumber(e.getArg(exp.Args[1]))
+	// math.Pow(NaN, 0) is 1, missing input must stay NaN
+	if math.IsNaN(fa) || math.IsNaN(fb) {
+		return FloatError
+	}
+
+	return math.Pow(fa, fb)
+}
+
+// queryParam - implements 'queryParam("<query>","<name>")' which decodes an URL
+// query string and returns the first value of parameter name. Everything up
+// to a '?' is skipped, so complete URLs work as well. Malformed parameters
+// like "a=%zz" are skipped, the others are still found.
+//
+// Example:
+//   queryParam("a=1&msg=disk%20full","msg") ... "disk full"
+//
+// Returns a string or an empty string when name is not found.
+func (e *Eval) queryParam(exp *ast.CallExpr) string {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+	query, ok1 := e.getArg(exp.Args[0]).(string)
+	name, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 {
+		return ""
+	}
+	if i := strings.IndexByte(query, '?'); i >= 0 {
+		query = query[i+1:]
+	}
+	// ParseQuery returns the valid parameters with the first error
+	values, _ := url.ParseQuery(query)
+	return values.Get(name)
+}
+
+// rad2deg - implements 'rad2deg(x)' which converts x radians to degrees,
+// e.g. 'rad2deg(asin(0.5))' is 30.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) rad2deg(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, func(x float64) float64 { return x * 180 / math.Pi })
+}
+
+// random - implements 'random()' which returns a random float64 in [0, 1) and
+// 'random(n)' which returns a random int in [0, n), e.g. to sample events.
+// The numbers are read from crypto/rand unless a generator is set with Rand().
+// Returns a float64 or an int, math.NaN() on error.
+func (e *Eval) randomValue(exp *ast.CallExpr) interface{} {
+	switch len(exp.Args) {
+	case 0:
+		return e.randomFloat()
+	case 1:
+		n, ok := e.getArg(exp.Args[0]).(int)
+		if !ok || n < 1 {
+			return FloatError
+		}
+		return e.randomInt(n)
+	}
+	return FloatError
+}
+
+// regexpMatch - implements 'regexpMatch ("<regex>","string")' and returns true when the
+// string matches
+func (e *Eval) regexpMatch(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 2 {
+		return false
+	}
+	var tmp interface{}
+	var regexPattern string
+	var regexString string
+	tmp = e.getArg(exp.Args[0])
+	switch val := tmp.(type) {
+	case string:
+		regexPattern = val
+	default:
+		return false
+	}
+
+	tmp = e.getArg(exp.Args[1])
+	switch val := tmp.(type) {
+	case string:
+		regexString = val
+	case int:
+		regexString = fmt.Sprintf("%d", val)
+	case bool:
+		if tmp.(bool) {
+			regexString = "true"
+		} else {
+			regexString = "false"
+		}
+	case float64:
+		regexString = strconv.FormatFloat(tmp.(float64), 'f', -1, 64)
+	default:
+		return false
+	}
+
+	r, err := regexp.Compile(regexPattern)
+	if err != nil {
+		return false
+	}
+	b := r.MatchString(regexString)
+	return b
+}
+
+// result - implements 'result(value,"unit",state,"text")' which returns a
+// Result of a check instead of encoding everything into one string. state
+// is 0..3 or one of "ok", "warning", "critical" and "unknown", the default
+// is "ok". unit, state and text are optional.
+//
+// Example:
+//   result(usage, "%", ifExpr(usage > 90, "critical", "ok"), "disk /var")
+//
+// Returns a Result or math.NaN() on error.
+func (e *Eval) result(exp *ast.CallExpr) interface{} {
+	l := len(exp.Args)
+	if l < 1 || l > 4 {
+		return FloatError
+	}
+	r := Result{Value: e.getArg(exp.Args[0])}
+	if l > 1 {
+		unit, ok := e.getArg(exp.Args[1]).(string)
+		if !ok {
+			return FloatError
+		}
+		r.Unit = unit
+	}
+	if l > 2 {
+		state, ok := parseState(e.getArg(exp.Args[2]))
+		if !ok {
+			return FloatError
+		}
+		r.State = state
+	}
+	if l > 3 {
+		text, ok := e.getArg(exp.Args[3]).(string)
+		if !ok {
+			return FloatError
+		}
+		r.Text = text
+	}
+	return r
+}
+
+// rollingMax - implements 'rollingMax(name, value, windowSeconds)' which adds
+// value to the samples of name and returns the largest sample of the last
+// windowSeconds, e.g. 'rollingMax("cpu", cpu, 300) > 95' for the maximum of
+// the last 5 minutes. The samples are kept in the StateStore between runs,
+// invalid values are not added.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) rollingMax(exp *ast.CallExpr) float64 {
+	return e.rolling(exp, "rollingMax:", math.Max)
+}
+
+// rollingMin - implements 'rollingMin(name, value, windowSeconds)' like
+// rollingMax() for the smallest sample.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) rollingMin(exp *ast.CallExpr) float64 {
+	return e.rolling(exp, "rollingMin:", math.Min)
+}
+
+// rolling keeps the samples of the last window seconds in the
+// StateStore and returns them reduced by pick
+func (e *Eval) rolling(exp *ast.CallExpr, prefix string, pick func(a, b float64) float64) float64 {
+	if len(exp.Args) != 3 {
+		return FloatError
+	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	value := toNumber(e.getArg(exp.Args[1]))
+	window := toNumber(e.getArg(exp.Args[2]))
+	if !ok || math.IsNaN(window) {
+		return FloatError
+	}
+	key := prefix + name
+	t := float64(e.now().UnixNano()) / 1e9
+	// samples are stored as times and values of the same length
+	state, _ := e.getState(key).(map[string]interface{})
+	times, values := floatSlice(state["t"]), floatSlice(state["v"])
+	var keptTimes, keptValues []float64
+	for i := range times {
+		if i < len(values) && times[i] > t-window {
+			keptTimes = append(keptTimes, times[i])
+			keptValues = append(keptValues, values[i])
+		}
+	}
+	if !math.IsNaN(value) {
+		keptTimes = append(keptTimes, t)
+		keptValues = append(keptValues, value)
+	}
+	e.setState(key, map[string]interface{}{"t": keptTimes, "v": keptValues})
+	if len(keptValues) == 0 {
+		return FloatError
+	}
+	result := keptValues[0]
+	for _, v := range keptValues[1:] {
+		result = pick(result, v)
+	}
+	return result
+}
+
+// round - implements the 'round (x,y)' function which
+// rounds x to y decimal places.
+//
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) round(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+
+	fa := toNumber(e.getArg(exp.Args[0]))
+	fb := toNumber(e.getArg(exp.Args[1]))
+	if math.IsNaN(fb) {
+		return FloatError
+	}
+
+	x := math.Pow10(int(fb))
+
+	return math.Round(fa*x) / x
+}
+
+// ulp returns the distance of x to the next float64 away from zero
+func ulp(x float64) float64 {
+	x = math.Abs(x)
+	return math.Nextafter(x, math.Inf(1)) - x
+}
+
+// roundWith rounds the first argument of exp with fn to the decimal
+// places of the optional second argument like round() does.
+func (e *Eval) roundWith(exp *ast.CallExpr, fn func(float64) float64) float64 {
+	if len(exp.Args) < 1 || len(exp.Args) > 2 {
+		return FloatError
+	}
+
+	fa := toNumber(e.getArg(exp.Args[0]))
+	fb := 0.0
+	if len(exp.Args) == 2 {
+		fb = toNumber(e.getArg(exp.Args[1]))
+		if math.IsNaN(fb) {
+			return FloatError
+		}
+	}
+
+	x := math.Pow10(int(fb))
+	scaled := fa * x
+	// e.g. 1.1*10 is 11.000000000000002 which must not be ceiled to 12,
+	// only such rounding errors of a few ULPs are snapped to the integer
+	if r := math.Round(scaled); math.Abs(scaled-r) <= 4*ulp(r) {
+		scaled = r
+	}
+
+	return fn(scaled) / x
+}
+
+// score - implements 'score(weight1, value1, weight2, value2, ...)' which
+// returns the health score as weighted average of the values clamped to
+// 0..100, e.g. 'score(2, 100*normalize(rtt, 0.2, 0.01), 1, availability)'.
+// NaN values are treated per the NaNPolicy of the Eval or Environment.
+// Returns a float64 value in 0..100 or math.NaN() on error.
+func (e *Eval) score(exp *ast.CallExpr) float64 {
+	if len(exp.Args) < 2 || len(exp.Args)%2 != 0 {
+		return FloatError
+	}
+	policy := e.policy()
+	var sum, total float64
+	for i := 0; i < len(exp.Args); i += 2 {
+		weight := toNumber(e.getArg(exp.Args[i]))
+		value := toNumber(e.getArg(exp.Args[i+1]))
+		if math.IsNaN(weight) || weight < 0 {
+			return FloatError
+		}
+		if math.IsNaN(value) {
+			switch policy {
+			case NaNSkip:
+				continue
+			case NaNZero:
+				value = 0
+			default:
+				return FloatError
+			}
+		}
+		sum += weight * math.Max(0, math.Min(100, value))
+		total += weight
+	}
+	if total == 0 {
+		return FloatError
+	}
+	return sum / total
+}
+
+// seaLevelPressure - implements 'seaLevelPressure(hPa, altitude)' which
+// reduces the air pressure hPa measured at the altitude in meters to sea
+// level using the international barometric formula, the inverse of
+// altitudeFromPressure(). Weather services report this pressure so that
+// sensors at different altitudes can be compared.
+// Returns a float64 value or math.NaN() on error, e.g. for pressures <= 0
+// or altitudes of 44330 meters and above.
+func (e *Eval) seaLevelPressure(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	p := toNumber(e.getArg(exp.Args[0]))
+	h := toNumber(e.getArg(exp.Args[1]))
+	if !(p > 0) || !(h < 44330) {
+		return FloatError
+	}
+	return p / math.Pow(1-h/44330, 5.255)
+}
+
+// setEnv - implements 'setEnv("KEY", "value")' which sets the environment
+// variable KEY of the process, e.g. for check scripts executed afterwards.
+// setEnv changes the process and must be enabled with AllowSetEnv(true).
+// Returns true or false on error.
+func (e *Eval) setEnv(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 2 {
+		return false
+	}
+	if !e.allowSetEnv && (e.environment == nil || !e.environment.allowSetEnv) {
+		e.fail(&Error{Func: "setEnv", Err: ErrNotAllowed})
+		return false
+	}
+	key, ok := e.getArg(exp.Args[0]).(string)
+	if !ok || key == "" {
+		return false
+	}
+	var value string
+	switch v := e.getArg(exp.Args[1]).(type) {
+	case string:
+		value = v
+	case int, float64, bool:
+		value = fmt.Sprint(v)
+	default:
+		return false
+	}
+	if e.record(EffectEnv, key, value) {
+		return true
+	}
+	if err := e.setenv(key, value); err != nil {
+		e.fail(&Error{Func: "setEnv", Err: err})
+		return false
+	}
+	return true
+}
+
+// setVal - implements the 'setVal(a,b,c,d,...)' function which
+// sets variables in pairs of 2, a pair sees the variables set
+// before. When at least 2 string literals are followed by an argument
+// returning Values, the literals are the names of the variables to
+// assign them to, e.g. 'setVal("lo","hi", minMax(a,b,c))'.
+// Returns nil or a golang error.
+func (e *Eval) setVal(exp *ast.CallExpr) error {
+	l := len(exp.Args)
+	var last interface{}
+	var evaluated bool
+	if l > 2 {
+		if names, ok := e.names(exp.Args[:l-1]); ok {
+			// the last argument is evaluated once only
+			last, evaluated = e.eval(exp.Args[l-1]), true
+			if values, ok := last.(Values); ok {
+				return e.setValues(names, values)
+			}
+		}
+	}
+	arg := func(i int) interface{} {
+		if i == l-1 && evaluated {
+			return last
+		}
+		return e.eval(exp.Args[i])
+	}
+	for i := 0; i < l; i++ {
+		x := argValue(arg(i))
+		if i+1 < l {
+			var name string
+			var ok bool
+			// name holds the variable name
+			if name, ok = x.(string); !ok {
+				continue
+			}
+			if name == "" {
+				continue
+			}
+			// value holds the variable value
+			value := arg(i + 1)
+			i += 1
+			switch v := value.(type) {
+			case string, bool, int, int64, uint64, float64:
+				e.setVariable(name, v)
+			default:
+				// e.g. a slice to index or spread later
+				if compound(v) {
+					e.setVariable(name, v)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// setValues assigns values to the variables names, see setVal()
+func (e *Eval) setValues(names []string, values Values) error {
+	if len(names) != len(values) {
+		err := &Error{Func: "setVal", Err: fmt.Errorf("%d names for %d values", len(names), len(values))}
+		e.fail(err)
+		return err
+	}
+	for i, name := range names {
+		if name == "" {
+			err := &Error{Func: "setVal", Err: fmt.Errorf("invalid name %q", name)}
+			e.fail(err)
+			return err
+		}
+		e.setVariable(name, values[i])
+	}
+	return nil
+}
+
+// names returns the strings of args when all of them are string
+// literals like "lo", "hi"
+func (e *Eval) names(args []ast.Expr) ([]string, bool) {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		lit, ok := arg.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return nil, false
+		}
+		if names[i], ok = e.getArg(lit).(string); !ok {
+			return nil, false
+		}
+	}
+	return names, true
+}
+
+// sin - implements 'sin(x)' which returns the sine of x radians.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) sin(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, math.Sin)
+}
+
+// snakeCase - implements 'snakeCase(s)' which converts s to "snake_case",
+// e.g. for metric names. See camelCase() for the word separation.
+// Returns a string or an empty string on error.
+func (e *Eval) snakeCase(exp *ast.CallExpr) string {
+	return e.caseStyle(exp, "_", func(i int, w string) string {
+		return strings.ToLower(w)
+	})
+}
+
+// soundex - implements 'soundex(s)' which returns the American Soundex code
+// of s. Names which sound alike in English get the same code.
+// Returns a string or an empty string on error.
+func (e *Eval) soundex(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return soundex(s)
+}
+
+// sqrt - implements 'sqrt(x)' which returns the square root of x.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) sqrt(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	x := e.getArg(exp.Args[0])
+	switch f := x.(type) {
+	case int:
+		return math.Sqrt(float64(f))
+	case float64:
+		return math.Sqrt(f)
+	case string:
+		return math.Sqrt(toFloat(f))
+	default:
+		return FloatError
+	}
+}
+
+// startOfDay - implements 'startOfDay(epoch)' and 'startOfDay(epoch, tz)' which
+// returns the epoch of midnight of the day of epoch in the time zone tz like
+// "Europe/Vienna", default is the local time zone.
+//
+// Example:
+//   now - startOfDay(now, "Europe/Vienna") ... seconds since midnight in Vienna
+//
+// Returns the epoch as float64 value or math.NaN() on error.
+func (e *Eval) startOfDay(exp *ast.CallExpr) float64 {
+	return e.startOf(exp, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	})
+}
+
+// startOfHour - implements 'startOfHour(epoch)' and 'startOfHour(epoch, tz)'
+// like startOfDay() for the full hour.
+// Returns the epoch as float64 value or math.NaN() on error.
+func (e *Eval) startOfHour(exp *ast.CallExpr) float64 {
+	return e.startOf(exp, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	})
+}
+
+// startOfMonth - implements 'startOfMonth(epoch)' and 'startOfMonth(epoch, tz)'
+// like startOfDay() for the first day of the month.
+// Returns the epoch as float64 value or math.NaN() on error.
+func (e *Eval) startOfMonth(exp *ast.CallExpr) float64 {
+	return e.startOf(exp, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	})
+}
+
+// startOf converts the epoch argument of exp to a time in the optional
+// time zone argument, truncates it and returns the epoch
+func (e *Eval) startOf(exp *ast.CallExpr, truncate func(t time.Time) time.Time) float64 {
+	if len(exp.Args) != 1 && len(exp.Args) != 2 {
+		return FloatError
+	}
+	epoch := toNumber(e.getArg(exp.Args[0]))
+	if math.IsNaN(epoch) || math.IsInf(epoch, 0) {
+		return FloatError
+	}
+	loc := time.Local
+	if len(exp.Args) == 2 {
+		tz, ok := e.getArg(exp.Args[1]).(string)
+		if !ok {
+			return FloatError
+		}
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			e.fail(err)
+			return FloatError
+		}
+	}
+	sec, frac := math.Modf(epoch)
+	t := time.Unix(int64(sec), int64(frac*1e9)).In(loc)
+	return float64(truncate(t).Unix())
+}
+
+// stripAnsi - implements 'stripAnsi(s)' which removes ANSI escape sequences like
+// colors or cursor movements, e.g. from captured command output.
+// Returns a string or an empty string on error.
+func (e *Eval) stripAnsi(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return ansiRegexp.ReplaceAllString(s, "")
+}
+
+// ansiRegexp matches CSI and OSC sequences and other two byte escapes
+var ansiRegexp = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// stripControl - implements 'stripControl(s)' which removes control characters
+// and invalid UTF-8 except newlines and tabs.
+// Returns a string or an empty string on error.
+func (e *Eval) stripControl(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || (unicode.IsControl(r) && r != '\n' && r != '\t') {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// substr - implements 'substr (string,start,size)' to get a piece of a string
+//
+// Examples:
+//   substr("MyNameIsJohn",0,2)   ... "My"
+//   substr("MyNameIsJohn",2,-1)  ... returns "NameIsJohn"
+//   substr("MyNameIsJohn",-2,-1) ... returns "hn"
+//   substr("MyNameIsJohn",-4,1)  ... returns "J"
+//
+// Returns a string or an empty string on error.
+func (e *Eval) substr(exp *ast.CallExpr) string {
+	const StringError = ""
+	if len(exp.Args) != 3 {
+		return StringError
+	}
+	theString := e.getArg(exp.Args[0])
+	startPos := e.getArg(exp.Args[1])
+	cutLen := e.getArg(exp.Args[2])
+	switch theString.(type) {
+	case string:
+		s := theString.(string)
+		if s == "" {
+			return ""
+		}
+		var startP int
+		var cutL int
+		switch sp := startPos.(type) {
+		case int:
+			startP = sp
+		case float64:
+			startP = int(sp)
+		}
+		switch cutLen.(type) {
+		case int:
+			cutL = cutLen.(int)
+		case float64:
+			cutL = int(cutLen.(float64))
+		}
+		if cutL == 0 {
+			return ""
+		}
+		if cutL > len(s) {
+			cutL = len(s)
+		}
+		if math.Abs(float64(startP)) >= float64(len(s)) {
+			return StringError
+		}
+		if startP >= 0 && cutL == -1 {
+			return s[startP:]
+		}
+		l := len(s)
+		if startP < 0 {
+			if cutL == -1 {
+				// e.g. last3 := s[len(s)-3:]
+				return s[l+startP:]
+			}
+			x := l + startP
+			if x+cutL >= l {
+				cutL = l - x
+			}
+			return s[x : x+cutL]
+		}
+		if startP+cutL < startP {
+			return StringError
+		}
+		if startP+cutL >= l {
+			cutL = l - startP
+		}
+		return s[startP : startP+cutL]
+	default:
+	}
+	return StringError
+}
+
+// sum - implements 'sum(x,y,z,...)' which returns the sum of a range of
+// numbers like avg(), e.g. sum(readings) of a []float64 variable.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) sum(exp *ast.CallExpr) float64 {
+	return e.avgMaxMin(exp, 4)
+}
+
+// switchExpr - implements 'switchExpr(x, case1, result1, case2, result2, ...,
+// default)' which returns the result of the first case equal to x, e.g.
+// 'switchExpr(severity, 1, "info", 2, "warning", 3, "critical", "unknown")'.
+// Like ifExpr the cases are evaluated in order until one matches and only
+// the matching result is evaluated. Numbers are equal when their values are,
+// 2 matches 2.0. The default is optional.
+// Returns the result, the default or math.NaN() when no case matches.
+func (e *Eval) switchExpr(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) < 3 {
+		return FloatError
 	}
+	x := e.getArg(exp.Args[0])
+	pairs := exp.Args[1:]
+	for ; len(pairs) >= 2; pairs = pairs[2:] {
+		if sameValue(x, e.getArg(pairs[0])) {
+			return e.value(pairs[1])
+		}
+	}
+	if len(pairs) == 1 {
+		return e.value(pairs[0])
+	}
+	return FloatError
+}
+
+// tan - implements 'tan(x)' which returns the tangent of x radians.
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) tan(exp *ast.CallExpr) float64 {
+	return e.unaryMath(exp, math.Tan)
+}
+
+// tariff - implements 'tariff(kwh, "<bands>")' which returns the price of kwh
+// with tiered pricing. bands is a comma separated list of 'from-to:price'
+// and 'from+:price' with the price per unit in the band, each band is
+// charged for the units between from and to only.
+//
+// Example:
+//   tariff(1500, "0-1000:0.25,1000+:0.30")  ... 1000*0.25 + 500*0.30 = 400
+//   tariff(800, "0-1000:0.25,1000+:0.30")   ... 200
+//
+// Returns a float64 value or math.NaN() on error, e.g. for an invalid
+// bands spec, negative units or units not covered by the bands.
+func (e *Eval) tariff(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	units := toNumber(e.getArg(exp.Args[0]))
+	spec, ok := e.getArg(exp.Args[1]).(string)
+	bands, valid := parseTariff(spec)
+	if !ok || !valid || !(units >= 0) {
+		return FloatError
+	}
+	price, charged := 0.0, 0.0
+	for _, b := range bands {
+		if units <= b.from {
+			continue
+		}
+		n := math.Min(units, b.to) - b.from
+		price += n * b.price
+		charged += n
+	}
+	// gaps or overlapping bands
+	if math.Abs(charged-units) > 1e-9 {
+		return FloatError
+	}
+	return price
+}
+
+// template - implements 'template("<text>")' and 'template("<text>",<map>)'
+// which replaces each {name} in text by the value of variable name. With
+// a second argument the values are taken from this map[string]interface{},
+// e.g. a variable holding decoded JSON. Unknown names are left as they are.
+//
+// Example:
+//   template("Host {host} is at {load}%") ... "Host srv1 is at 97.5%"
+//
+// Returns a string or an empty string on error.
+func (e *Eval) template(exp *ast.CallExpr) string {
+	l := len(exp.Args)
+	if l < 1 || l > 2 {
+		return ""
+	}
+	text, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	lookup := e.lookup
+	if l == 2 {
+		m, ok := e.eval(exp.Args[1]).(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		lookup = func(name string) (interface{}, bool) {
+			val, ok := m[name]
+			return val, ok
+		}
+	}
+	return templateRegexp.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if val, ok := lookup(placeholder[1 : len(placeholder)-1]); ok {
+			return fmt.Sprint(val)
+		}
+		return placeholder
+	})
+}
+
+// templateRegexp matches the {name} placeholders of template()
+var templateRegexp = regexp.MustCompile(`\{[^{}\s]+\}`)
+
+// throttle - implements 'throttle(name, maxEvents, windowSeconds)' which
+// returns true when less than maxEvents calls of throttle with the same
+// name returned true within the last windowSeconds, e.g. to limit
+// notifications: 'ifExpr(cpu > 90 && throttle("cpu", 3, 3600), ...)'.
+// The events are kept between runs of the Eval or the Environment.
+// Returns true or false, false on error.
+func (e *Eval) throttle(exp *ast.CallExpr) bool {
+	if len(exp.Args) != 3 {
+		return false
+	}
+	name, ok := e.getArg(exp.Args[0]).(string)
+	max := toNumber(e.getArg(exp.Args[1]))
+	window := toNumber(e.getArg(exp.Args[2]))
+	if !ok || math.IsNaN(max) || math.IsNaN(window) {
+		return false
+	}
+	key := "throttle:" + name
+	t := float64(e.now().UnixNano()) / 1e9
+	// keep the events within the window only, sorted by time
+	var kept []float64
+	for _, ev := range floatSlice(e.getState(key)) {
+		if ev > t-window {
+			kept = append(kept, ev)
+		}
+	}
+	allowed := float64(len(kept)) < max
+	if allowed {
+		kept = append(kept, t)
+	}
+	e.setState(key, kept)
+	return allowed
+}
+
+// time - implements 'time ("<action>","<format>")' to get a time as int64 or string
+// Returns an int64 value or a string.
+func (e *Eval) time(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+
+	a := e.getArg(exp.Args[0])
+	b := e.getArg(exp.Args[1])
+
+	switch left := a.(type) {
+	case string:
+		switch left {
+		case "", "now":
+			switch right := b.(type) {
+			case string:
+				switch right {
+				case "", "epoch":
+					return e.now().Unix()
+				case "rfc3339", "RFC3339":
+					return e.now().Format(time.RFC3339)
+				}
+			}
+		case "starttime":
+			var t time.Time
+			// global.X.Lock()
+			// t = global.X.ProgramStartTime
+			// global.X.Unlock()
+			switch right := b.(type) {
+			case string:
+				switch right {
+				case "", "epoch":
+					return t.Unix()
+				case "rfc3339", "RFC3339":
+					return t.Format(time.RFC3339)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// titleCase - implements 'titleCase(s)' which converts s to "Title Case",
+// see camelCase() for the word separation.
+// Returns a string or an empty string on error.
+func (e *Eval) titleCase(exp *ast.CallExpr) string {
+	return e.caseStyle(exp, " ", func(i int, w string) string {
+		return capitalize(w)
+	})
+}
+
+// translate - implements 'translate("<text>")' which looks up text in the
+// message catalog. Without catalog or translation text is returned as it is.
+//
+// Returns a string or an empty string on error.
+func (e *Eval) translate(exp *ast.CallExpr) string {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	text, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return ""
+	}
+	return e.translateText(text)
+}
+
+// translateText translates text with the catalog of the Eval
+// or its Environment
+func (e *Eval) translateText(text string) string {
+	catalog := e.catalog
+	if catalog == nil && e.environment != nil {
+		catalog = e.environment.catalog
+	}
+	if catalog != nil {
+		if translation, ok := catalog(text); ok {
+			return translation
+		}
+	}
+	return text
+}
+
+// trunc - implements the 'trunc (x[,y])' function which
+// rounds x toward zero to y decimal places, 0 by default.
+//
+// Returns a float64 value or math.NaN() on error.
+func (e *Eval) trunc(exp *ast.CallExpr) float64 {
+	return e.roundWith(exp, math.Trunc)
+}
+
+// uuid - implements 'uuid()' which returns a random UUID version 4 like
+// "2d7f4a1c-9b3e-4f6a-8c21-5e0d7b9a3f14", e.g. as id of a notification.
+// The bytes are read from crypto/rand unless a generator is set with Rand().
+// Returns a string.
+func (e *Eval) uuid(exp *ast.CallExpr) string {
+	var b [16]byte
+	e.randomBytes(b[:])
+	return uuidString(b)
+}
+
+// val - implements 'val("<name>")' to get the content of a variable. It returns
+// an empty string when the variable is not found unless another MissingPolicy
+// is set. Stored internally in the e.Variables(map[string]interface{}) map.
+//
+// Returns the value of the variable or an empty string on error.
+func (e *Eval) val(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 1 {
+		return ""
+	}
+	s := e.eval(exp.Args[0])
+	if name, ok := s.(string); ok {
+		if f, ok := e.lookup(name); ok {
+			return f
+		}
+		e.undefined(name)
+		switch e.onMissing() {
+		case MissingNaN:
+			return FloatError
+		case MissingError:
+			e.fail(fmt.Errorf("%w %q", ErrUndefinedVariable, name))
+			return FloatError
+		}
+	}
+	return ""
+}
 
-	return val
+// PushScope opens a new scope for variables. Until PopScope is called
+// setVal writes into this scope and hides variables with the same name.
+func (e *Eval) PushScope() *Eval {
+	e.scopes = append(e.scopes, make(map[string]interface{}))
+	return e
 }
 
-// pow - implements 'pow(<base x>,<exponent y>)' and returns x**y, the base-x exponential of y.
-// Returns a float64 value or a math.NaN() on error.
-func (e *Eval) pow(exp *ast.CallExpr) float64 {
-	if len(exp.Args) != 2 {
-		return FloatError
+// PopScope removes the innermost scope together with its variables.
+// It returns an error when there is no scope left.
+func (e *Eval) PopScope() error {
+	// the scope of a dry run is kept, see runDry()
+	if len(e.scopes) == 0 || (e.dry != nil && len(e.scopes) <= e.dry.scopes) {
+		return errors.New("popScope without pushScope")
 	}
+	e.scopes = e.scopes[:len(e.scopes)-1]
+	return nil
+}
 
-	a := e.getArg(exp.Args[0])
-	b := e.getArg(exp.Args[1])
+// stateStore returns the StateStore of stateful functions like cache(),
+// the one of the Environment when running in one
+func (e *Eval) stateStore() StateStore {
+	if e.environment != nil {
+		if e.environment.state == nil {
+			e.environment.state = NewMemoryStore()
+		}
+		return e.environment.state
+	}
+	if e.state == nil {
+		e.state = NewMemoryStore()
+		e.ownState = true
+	}
+	return e.state
+}
 
-	var fa, fb float64
+// getState returns the value of key in the StateStore or nil
+func (e *Eval) getState(key string) interface{} {
+	if e.dry != nil {
+		if value, ok := e.dry.state[key]; ok {
+			return value
+		}
+	}
+	value, _ := e.stateStore().Get(key)
+	return value
+}
 
-	switch v := a.(type) {
-	case int:
-		fa = float64(v)
-	case float64:
-		fa = v
-	case string:
-		v = stringer(v)
-		fa = toFloat(v)
-	default:
-		fa = FloatError
+// setState sets key in the StateStore, errors like a failed
+// write of a FileStore are recorded. In dry-run mode the value
+// is kept for the run only.
+func (e *Eval) setState(key string, value interface{}) {
+	if e.record(EffectState, key, value) {
+		e.dry.state[key] = value
+		return
 	}
-	switch v := b.(type) {
-	case int:
-		fb = float64(v)
-	case float64:
-		fb = v
-	case string:
-		v = stringer(v)
-		fb = toFloat(v)
-	default:
-		fb = FloatError
+	if err := e.stateStore().Set(key, value); err != nil {
+		e.fail(fmt.Errorf("state %q: %w", key, err))
 	}
+}
 
-	return math.Pow(fa, fb)
+// setVariable stores a variable in the innermost scope
+func (e *Eval) setVariable(name string, value interface{}) {
+	// temporary variables of let() or pushScope() are no effects
+	if e.dry != nil && len(e.scopes) == e.dry.scopes {
+		e.record(EffectVariable, name, value)
+	}
+	if n := len(e.scopes); n > 0 {
+		e.scopes[n-1][name] = value
+		return
+	}
+	if e.copyVariables {
+		variables := make(map[string]interface{}, len(e.variables)+1)
+		for k, v := range e.variables {
+			variables[k] = v
+		}
+		e.variables = variables
+		e.copyVariables = false
+		e.ownVariables = true
+	}
+	if e.variables == nil {
+		e.variables = make(map[string]interface{})
+		e.ownVariables = true
+	}
+	e.variables[name] = value
 }
 
-// regexpMatch - implements 'regexpMatch ("<regex>","string")' and returns true when the
-// string matches
-func (e *Eval) regexpMatch(exp *ast.CallExpr) bool {
-	if len(exp.Args) != 2 {
-		return false
+// lookup returns the value of variable name, inner scopes first. A name
+// like "sensor/temp/value" which is not set itself is resolved as path
+// of the nested maps or slices of variable "sensor", e.g. of a decoded
+// JSON payload.
+func (e *Eval) lookup(name string) (interface{}, bool) {
+	if val, ok := e.lookupName(name); ok {
+		return val, true
 	}
-	var tmp interface{}
-	var regexPattern string
-	var regexString string
-	tmp = e.getArg(exp.Args[0])
-	switch val := tmp.(type) {
-	case string:
-		regexPattern = val
-	default:
-		return false
+	// the longest prefix which is a variable, e.g. "$SYS/b" of "$SYS/b/x"
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name[:i], "/") {
+		val, ok := e.lookupName(name[:i])
+		if !ok {
+			continue
+		}
+		for _, key := range strings.Split(name[i+1:], "/") {
+			if val, ok = member(val, key); !ok {
+				return nil, false
+			}
+		}
+		return val, true
 	}
+	return nil, false
+}
 
-	tmp = e.getArg(exp.Args[1])
-	switch val := tmp.(type) {
-	case string:
-		regexString = val
-	case int:
-		regexString = fmt.Sprintf("%d", val)
-	case bool:
-		if tmp.(bool) {
-			regexString = "true"
-		} else {
-			regexString = "false"
+// lookupName returns the value of variable name without resolving paths
+func (e *Eval) lookupName(name string) (interface{}, bool) {
+	for i := len(e.scopes) - 1; i >= 0; i-- {
+		if val, ok := e.scopes[i][name]; ok {
+			return val, true
 		}
-	case float64:
-		regexString = strconv.FormatFloat(tmp.(float64), 'f', -1, 64)
-	default:
-		return false
 	}
+	if val, ok := e.variables[name]; ok {
+		return val, true
+	}
+	if e.environment != nil {
+		return e.environment.provide(name)
+	}
+	return nil, false
+}
 
-	r, err := regexp.Compile(regexPattern)
-	if err != nil {
-		return false
+// args evaluates all arguments of a function call
+func (e *Eval) args(exp *ast.CallExpr) []interface{} {
+	args := make([]interface{}, len(exp.Args))
+	for i, arg := range exp.Args {
+		args[i] = e.eval(arg)
 	}
-	b := r.MatchString(regexString)
-	return b
+	return args
 }
 
-// round - implements the 'round (x,y)' function which
-// rounds x to y decimal places.
-//
-// Returns a float64 value or math.NaN() on error.
-func (e *Eval) round(exp *ast.CallExpr) float64 {
-	if len(exp.Args) != 2 {
-		return FloatError
+// permitted reports whether the builtin name may be called
+func (e *Eval) permitted(name string) bool {
+	if e.environment != nil && !e.environment.filter.permits(name) {
+		return false
 	}
+	return e.filter.permits(name)
+}
 
-	a := e.getArg(exp.Args[0])
-	b := e.getArg(exp.Args[1])
+// policy returns the NaNPolicy of the Environment when it
+// is set or of the Eval otherwise
+func (e *Eval) policy() NaNPolicy {
+	if e.environment != nil && e.environment.nanPolicy != NaNPropagate {
+		return e.environment.nanPolicy
+	}
+	return e.nanPolicy
+}
 
-	var fa, fb float64
+// unaryMath returns fn of the single numeric argument of exp
+func (e *Eval) unaryMath(exp *ast.CallExpr, fn func(float64) float64) float64 {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	return fn(toNumber(e.getArg(exp.Args[0])))
+}
 
-	switch v := a.(type) {
-	case int:
-		fa = float64(v)
-	case float64:
-		fa = v
-	case string:
-		fa = toFloat(v)
-	default:
-		fa = FloatError
+// tolerance returns the Epsilon of the Environment when
+// it is set or of the Eval otherwise
+func (e *Eval) tolerance() float64 {
+	if e.environment != nil && e.environment.epsilon != 0 {
+		return e.environment.epsilon
 	}
-	switch v := b.(type) {
-	case int:
-		fb = float64(v)
-	case float64:
-		fb = v
-	case string:
-		fb = toFloat(v)
-	default:
-		fb = FloatError
+	return e.epsilon
+}
+
+// onMissing returns the MissingPolicy of the Environment
+// when it is set or of the Eval otherwise
+func (e *Eval) onMissing() MissingPolicy {
+	if e.environment != nil && e.environment.missingPolicy != MissingEmpty {
+		return e.environment.missingPolicy
 	}
+	return e.missingPolicy
+}
 
-	x := math.Pow10(int(fb))
+// undefined records the reference of the undefined variable
+// name as error in strict mode
+func (e *Eval) undefined(name string) {
+	if e.strict || (e.environment != nil && e.environment.strict) {
+		e.fail(fmt.Errorf("%w %q", ErrUndefinedVariable, name))
+	}
+}
 
-	return math.Round(fa*x) / x
+// tariffBand is a band of tariff(), to is +Inf for 'from+:price'
+type tariffBand struct {
+	from, to, price float64
 }
 
-// setVal - implements the 'setVal(a,b,c,d,...)' function which
-// sets variables in pairs of 2.
-// Returns nil or a golang error.
-func (e *Eval) setVal(exp *ast.CallExpr) error {
-	l := len(exp.Args)
-	for i := 0; i < l; i++ {
-		x := e.getArg(exp.Args[i])
-		if i+1 < l {
-			var name string
-			var ok bool
-			// name holds the variable name
-			if name, ok = x.(string); !ok {
-				continue
-			}
-			if e.variables == nil {
-				e.variables = make(map[string]interface{})
-			}
-			name = stringer(name)
-			if name == "" {
-				continue
-			}
-			// value holds the variable value
-			value := e.getArg(exp.Args[i+1])
-			i += 1
-			switch v := value.(type) {
-			case string:
-				v = stringer(v)
-				e.variables[name] = v
-			case bool, int, float64:
-				e.variables[name] = v
-			}
+// parseTariff parses the bands of tariff() like "0-1000:0.25,1000+:0.30",
+// ok is false on syntax errors and for bands with from >= to
+func parseTariff(spec string) (bands []tariffBand, ok bool) {
+	for _, field := range strings.Split(spec, ",") {
+		rng, price, found := strings.Cut(field, ":")
+		if !found {
+			return nil, false
+		}
+		b := tariffBand{to: math.Inf(1), price: toFloat(strings.TrimSpace(price))}
+		rng = strings.TrimSpace(rng)
+		if strings.HasSuffix(rng, "+") {
+			b.from = toFloat(strings.TrimSpace(strings.TrimSuffix(rng, "+")))
+		} else if from, to, found := strings.Cut(rng, "-"); found {
+			b.from, b.to = toFloat(strings.TrimSpace(from)), toFloat(strings.TrimSpace(to))
+		} else {
+			return nil, false
+		}
+		if math.IsNaN(b.price) || !(b.from >= 0 && b.from < b.to) {
+			return nil, false
 		}
+		bands = append(bands, b)
 	}
-	return nil
+	return bands, true
 }
 
-// sqrt - implements 'sqrt(x)' which returns the square root of x.
-// Returns a float64 value or math.NaN() on error.
-func (e *Eval) sqrt(exp *ast.CallExpr) float64 {
-	if len(exp.Args) != 1 {
-		return FloatError
-	}
-	x := e.getArg(exp.Args[0])
-	switch f := x.(type) {
-	case int:
-		return math.Sqrt(float64(f))
-	case float64:
-		return math.Sqrt(f)
+// missing reports whether v is no value for coalesce() and valOr()
+func missing(v interface{}) bool {
+	switch x := v.(type) {
+	case nil:
+		return true
 	case string:
-		f = stringer(f)
-		return math.Sqrt(toFloat(f))
-	default:
-		return FloatError
+		return x == ""
+	case float64:
+		return math.IsNaN(x)
 	}
+	return false
 }
 
-// substr - implements 'substr (string,start,size)' to get a piece of a string
-//
-// Examples:
-//   substr("MyNameIsJohn",0,2)   ... "My"
-//   substr("MyNameIsJohn",2,-1)  ... returns "NameIsJohn"
-//   substr("MyNameIsJohn",-2,-1) ... returns "hn"
-//   substr("MyNameIsJohn",-4,1)  ... returns "J"
-//
-// Returns a string or an empty string on error.
-func (e *Eval) substr(exp *ast.CallExpr) string {
-	const StringError = ""
-	if len(exp.Args) != 3 {
-		return StringError
-	}
-	theString := e.getArg(exp.Args[0])
-	startPos := e.getArg(exp.Args[1])
-	cutLen := e.getArg(exp.Args[2])
-	switch theString.(type) {
-	case string:
-		s := theString.(string)
-		if s == "" {
-			return ""
+// uintRemainder returns x % y when x or y is an uint64 above
+// math.MaxInt64 which would lose precision as float64. ok is false for
+// all other values which are handled by remainder().
+func uintRemainder(x, y interface{}) (interface{}, bool) {
+	l, lbig := x.(uint64)
+	lbig = lbig && l > math.MaxInt64
+	r, rbig := y.(uint64)
+	rbig = rbig && r > math.MaxInt64
+	switch {
+	case lbig:
+		if !rbig {
+			v, ok := argValue(y).(int)
+			if !ok {
+				return nil, false
+			}
+			if v < 0 {
+				r = uint64(-(v + 1)) + 1
+			} else {
+				r = uint64(v)
+			}
 		}
-		var startP int
-		var cutL int
-		switch sp := startPos.(type) {
-		case int:
-			startP = sp
-		case float64:
-			startP = int(sp)
+		if r == 0 {
+			return FloatError, true
 		}
-		switch cutLen.(type) {
-		case int:
-			cutL = cutLen.(int)
-		case float64:
-			cutL = int(cutLen.(float64))
+		m := l % r
+		if m > math.MaxInt64 {
+			return m, true
 		}
-		if cutL == 0 {
-			return ""
+		return int(m), true
+	case rbig:
+		// |x| is always below y
+		if v, ok := argValue(x).(int); ok {
+			return v, true
 		}
-		if cutL > len(s) {
-			cutL = len(s)
+	}
+	return nil, false
+}
+
+// remainder returns x % y of the ints and float64 values x and y, an
+// int for two ints and a float64 with the sign of x like math.Mod
+// otherwise. A divisor of 0 returns math.NaN().
+func remainder(x, y interface{}) interface{} {
+	switch l := x.(type) {
+	case int:
+		switch r := y.(type) {
+		case int: // 7 % 2
+			if r == 0 {
+				return FloatError
+			}
+			return l % r
+		case float64: // 7 % 2.5
+			return math.Mod(float64(l), r)
 		}
-		if math.Abs(float64(startP)) >= float64(len(s)) {
-			return StringError
+	case float64:
+		switch r := y.(type) {
+		case int: // 7.5 % 2
+			return math.Mod(l, float64(r))
+		case float64: // 7.5 % 2.5
+			return math.Mod(l, r)
 		}
-		if startP >= 0 && cutL == -1 {
-			return s[startP:]
+	}
+	return FloatError
+}
+
+// evalLogical evaluates && and || of bools, the right operand only
+// when the left one doesn't decide the result, e.g. 'n > 0 && x/n > 1'
+func (e *Eval) evalLogical(exp *ast.BinaryExpr) interface{} {
+	left, ok := e.condition(exp.X)
+	if !ok {
+		return FloatError
+	}
+	if exp.Op == token.LAND && !left {
+		return false
+	}
+	if exp.Op == token.LOR && left {
+		return true
+	}
+	right, ok := e.condition(exp.Y)
+	if !ok {
+		return FloatError
+	}
+	return right
+}
+
+// condition evaluates exp as bool. With Truthy(true) numbers other
+// than 0 are true, ok is false for all other values.
+func (e *Eval) condition(exp ast.Expr) (b bool, ok bool) {
+	switch x := e.getArg(exp).(type) {
+	case bool:
+		return x, true
+	case int:
+		if e.truthy || (e.environment != nil && e.environment.truthy) {
+			return x != 0, true
 		}
-		l := len(s)
-		if startP < 0 {
-			if cutL == -1 {
-				// e.g. last3 := s[len(s)-3:]
-				return s[l+startP:]
-			}
-			x := l + startP
-			if x+cutL >= l {
-				cutL = l - x
-			}
-			return s[x : x+cutL]
+	case float64:
+		if e.truthy || (e.environment != nil && e.environment.truthy) {
+			return x != 0, !math.IsNaN(x)
 		}
-		if startP+cutL < startP {
-			return StringError
+	}
+	return false, false
+}
+
+// spread returns the call 'f(a, values...)' with the elements of the
+// slice values as arguments like 'f(a, v1, v2, ...)', ok is false when
+// values is no slice
+func (e *Eval) spread(exp *ast.CallExpr) (*ast.CallExpr, bool) {
+	last := len(exp.Args) - 1
+	slice := reflect.ValueOf(e.eval(exp.Args[last]))
+	if slice.Kind() != reflect.Slice {
+		return nil, false
+	}
+	args := make([]ast.Expr, last, last+slice.Len())
+	copy(args, exp.Args[:last])
+	for i := 0; i < slice.Len(); i++ {
+		args = append(args, &value{v: slice.Index(i).Interface()})
+	}
+	return &ast.CallExpr{Fun: exp.Fun, Lparen: exp.Lparen, Args: args, Rparen: exp.Rparen}, true
+}
+
+// index returns the element of 'x[i]' of the slice variable x, e.g. of
+// []float64 or []interface{}, or of 'x["key"]' of the map variable x.
+// It returns FloatError when there is no such element.
+func (e *Eval) index(exp *ast.IndexExpr) interface{} {
+	x := e.eval(exp.X)
+	var key string
+	switch val := e.getArg(exp.Index).(type) {
+	case int:
+		key = strconv.Itoa(val)
+	case float64:
+		// e.g. indexes of JSON documents
+		if val != math.Trunc(val) {
+			return FloatError
 		}
-		if startP+cutL >= l {
-			cutL = l - startP
+		key = strconv.Itoa(int(val))
+	case string:
+		if reflect.ValueOf(x).Kind() != reflect.Map {
+			return FloatError
 		}
-		return s[startP : startP+cutL]
+		key = val
 	default:
+		return FloatError
 	}
-	return StringError
-}
-
-// time - implements 'time ("<action>","<format>")' to get a time as int64 or string
-// Returns an int64 value or a string.
-func (e *Eval) time(exp *ast.CallExpr) interface{} {
-	if len(exp.Args) != 2 {
-		return ""
+	if val, ok := member(x, key); ok {
+		return val
 	}
+	return FloatError
+}
 
-	a := e.getArg(exp.Args[0])
-	b := e.getArg(exp.Args[1])
+// selector returns the element of 'x.key' of the map variable x, e.g. of
+// sensor.temp.value. A missing element is an undefined variable.
+func (e *Eval) selector(exp *ast.SelectorExpr) interface{} {
+	if val, ok := member(e.eval(exp.X), exp.Sel.Name); ok {
+		return val
+	}
+	var b strings.Builder
+	formatExpr(&b, exp)
+	e.undefined(b.String())
+	return FloatError
+}
 
-	switch left := a.(type) {
-	case string:
-		switch stringer(left) {
-		case "", "now":
-			switch right := b.(type) {
-			case string:
-				switch stringer(right) {
-				case "", "epoch":
-					return time.Now().Unix()
-				case "rfc3339", "RFC3339":
-					return time.Now().Format(time.RFC3339)
-				}
-			}
-		case "starttime":
-			var t time.Time
-			// global.X.Lock()
-			// t = global.X.ProgramStartTime
-			// global.X.Unlock()
-			switch right := b.(type) {
-			case string:
-				switch stringer(right) {
-				case "", "epoch":
-					return t.Unix()
-				case "rfc3339", "RFC3339":
-					return t.Format(time.RFC3339)
-				}
-			}
+// member returns the element key of the map x with string keys, the
+// element of the slice x at index key like "0" or the exported field key
+// of the struct x, ok is false when there is no such element
+func member(x interface{}, key string) (interface{}, bool) {
+	v := reflect.ValueOf(x)
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		elem := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !elem.IsValid() {
+			return nil, false
 		}
+		return plainValue(elem), true
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= v.Len() {
+			return nil, false
+		}
+		return plainValue(v.Index(i)), true
+	case reflect.Struct:
+		return structField(v, key)
 	}
-	return ""
+	return nil, false
 }
 
-// val - implements 'val("<name>")' to get the content of a variable. It returns
-// an empty string when the variable is not found. Stored internally in the
-// e.Variables(map[string]interface{}) map.
-//
-// Returns the value of the variable or an empty string on error.
-func (e *Eval) val(exp *ast.CallExpr) interface{} {
-	if len(exp.Args) != 1 || e.variables == nil {
-		return ""
+// callFunction runs the Go function fn registered as name
+// with the evaluated arguments of exp
+func (e *Eval) callFunction(name string, fn Function, exp *ast.CallExpr) interface{} {
+	result, err := fn(e.args(exp)...)
+	if err != nil {
+		e.fail(&Error{Func: name, Err: err})
+		return FloatError
 	}
-	s := e.eval(exp.Args[0])
-	if name, ok := s.(string); ok {
-		key := stringer(name)
-		if f, ok := e.variables[key]; ok {
-			return f
-		}
+	return result
+}
+
+// fail remembers the first error which occurs while running
+func (e *Eval) fail(err error) {
+	if e.err == nil {
+		e.err = err
 	}
-	return ""
 }
 
 func (e *Eval) getArg(exp ast.Expr) interface{} {
-	x := e.eval(exp)
+	return argValue(e.eval(exp))
+}
+
+// argValue returns x as bool, int, float64 or string like getArg(),
+// other types are math.NaN()
+func argValue(x interface{}) interface{} {
 	switch val := x.(type) {
 	case bool:
 		return val
 	case int:
 		return val
+	// e.g. time("now","epoch") or variables, calculated as int
+	case int64:
+		return int(val)
+	case uint64:
+		if val > math.MaxInt64 {
+			return float64(val)
+		}
+		return int(val)
 	case float64:
 		return val
 	case string:
-		return stringer(val)
+		return val
 	default:
 	}
 	return math.NaN()
 }
 
+// value returns the result of exp like getArg but keeps slices, maps and
+// structs which getArg turns into math.NaN(), e.g. to assign them
+func (e *Eval) value(exp ast.Expr) interface{} {
+	x := e.eval(exp)
+	if compound(x) {
+		return x
+	}
+	return argValue(x)
+}
+
+// compound reports whether x is a slice, array, map or struct or a
+// pointer to one
+func compound(x interface{}) bool {
+	v := reflect.ValueOf(x)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return true
+	}
+	return false
+}
+
 func (e *Eval) evalFunctionName(exp ast.Expr) string {
-	return exp.(*ast.Ident).Name
+	return functionName(exp)
+}
+
+// functionName returns the name of the called function,
+// namespaced names like "math.sqrt" included
+func functionName(exp ast.Expr) string {
+	switch exp := exp.(type) {
+	case *ast.Ident:
+		return exp.Name
+	case *ast.SelectorExpr:
+		if ns, ok := exp.X.(*ast.Ident); ok {
+			return ns.Name + "." + exp.Sel.Name
+		}
+	}
+	return ""
 }
 
 func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
+	switch exp.Op {
+	case token.LAND, token.LOR:
+		return e.evalLogical(exp)
+	}
 
-	left := e.getArg(exp.X)
-	right := e.getArg(exp.Y)
+	x, y := e.eval(exp.X), e.eval(exp.Y)
+	left, right := argValue(x), argValue(y)
 
 	switch exp.Op {
 	case token.ADD:
@@ -881,6 +4238,11 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 				return l / r
 			}
 		}
+	case token.REM:
+		if r, ok := uintRemainder(x, y); ok {
+			return r
+		}
+		return remainder(left, right)
 	case token.EQL:
 		switch l := left.(type) {
 		case bool:
@@ -893,14 +4255,14 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 			case int: // 1 / 2
 				return l == r
 			case float64: // 1 / 3.141
-				return float64(l) == r
+				return almostEqual(float64(l), r, e.tolerance())
 			}
 		case float64:
 			switch r := right.(type) {
 			case int: // 3.141 / 1
-				return l == float64(r)
+				return almostEqual(l, float64(r), e.tolerance())
 			case float64: // 3.141 / 3.141
-				return l == r
+				return almostEqual(l, r, e.tolerance())
 			}
 		case string:
 			switch r := right.(type) {
@@ -924,6 +4286,13 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 			case float64: // 3.141 < 3.141
 				return l < r
 			}
+		case string:
+			switch r := right.(type) {
+			case string: // "eth2" < "eth10" with NaturalOrder(true)
+				if e.naturalOrder {
+					return naturalCompare(l, r) < 0
+				}
+			}
 		}
 	case token.GTR:
 		switch l := left.(type) {
@@ -941,6 +4310,13 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 			case float64: // 3.141 > 3.141
 				return l > r
 			}
+		case string:
+			switch r := right.(type) {
+			case string: // "eth2" > "eth10" with NaturalOrder(true)
+				if e.naturalOrder {
+					return naturalCompare(l, r) > 0
+				}
+			}
 		}
 	case token.NEQ:
 		switch l := left.(type) {
@@ -954,14 +4330,14 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 			case int: // 1 != 2
 				return l != r
 			case float64: // 1 != 3.141
-				return float64(l) != r
+				return !almostEqual(float64(l), r, e.tolerance())
 			}
 		case float64:
 			switch r := right.(type) {
 			case int: // 3.141 != 1
-				return l == float64(r)
+				return !almostEqual(l, float64(r), e.tolerance())
 			case float64: // 3.141 != 3.141
-				return l != r
+				return !almostEqual(l, r, e.tolerance())
 			}
 		case string:
 			switch r := right.(type) {
@@ -985,6 +4361,13 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 			case float64: // 3.141 <= 3.141
 				return l <= r
 			}
+		case string:
+			switch r := right.(type) {
+			case string: // "eth2" <= "eth10" with NaturalOrder(true)
+				if e.naturalOrder {
+					return naturalCompare(l, r) <= 0
+				}
+			}
 		}
 	case token.GEQ:
 		switch l := left.(type) {
@@ -1002,60 +4385,13 @@ func (e *Eval) evalBinaryExpr(exp *ast.BinaryExpr) interface{} {
 			case float64: // 3.141 >= 3.141
 				return l >= r
 			}
-		}
-	case token.LAND:
-		switch l := left.(type) {
-		case bool:
-			switch r := right.(type) {
-			case bool: // true && false
-				return l && r
-			}
-			//case int:
-			//	switch r := right.(type) {
-			//	case int: // 1 && 2
-			//		return l && r
-			//	case float64: // 1 && 3.141
-			//		return float64(l) && r
-			//	}
-			//case float64:
-			//	switch r := right.(type) {
-			//	case int: // 3.141 && 1
-			//		return l == float64(r)
-			//	case float64: // 3.141 && 3.141
-			//		return l && r
-			//	}
-			//case string:
-			//	switch r := right.(type) {
-			//	case string: // "strA" && "strB"
-			//		return l && r
-			//	}
-		}
-	case token.LOR:
-		switch l := left.(type) {
-		case bool:
+		case string:
 			switch r := right.(type) {
-			case bool: // true || true
-				return l || r
+			case string: // "eth2" >= "eth10" with NaturalOrder(true)
+				if e.naturalOrder {
+					return naturalCompare(l, r) >= 0
+				}
 			}
-			//case int:
-			//	switch r := right.(type) {
-			//	case int: // 1 || 2
-			//		return l || r
-			//	case float64: // 1 / 3.141
-			//		return float64(l) || r
-			//	}
-			//case float64:
-			//	switch r := right.(type) {
-			//	case int: // 3.141 || 1
-			//		return l || float64(r)
-			//		//case float64: // 3.141 || 3.141
-			//		//	return l || r
-			//	case string:
-			//		switch r := right.(type) {
-			//		case string: // "strA" || "strB"
-			//			return l || r
-			//		}
-			//	}
 		}
 	case token.OR:
 		switch l := left.(type) {
@@ -1136,6 +4472,119 @@ func (e *Eval) sprintf(exp *ast.CallExpr) interface{} {
 	return FloatError
 }
 
+// valOr - implements 'valOr("<name>", default)' which returns the content of
+// the variable name like val() or default when the variable is undefined,
+// an empty string or math.NaN(). default is only evaluated when needed,
+// an undefined variable is no error in strict mode.
+// Returns the value of the variable or default.
+func (e *Eval) valOr(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	if name, ok := e.getArg(exp.Args[0]).(string); ok {
+		if v, ok := e.lookup(name); ok && !missing(v) {
+			return v
+		}
+	}
+	return e.eval(exp.Args[1])
+}
+
+// wavg - implements 'wavg(v1,w1, v2,w2, ...)' which returns the average of
+// the values v weighted by w, e.g. 'wavg(rttEU, 3, rttUS, 1)'. With two
+// slices of the same length 'wavg(values, weights)' takes the pairs from the
+// slices.
+// Returns a float64 value or math.NaN() on error, e.g. when the weights sum
+// up to 0.
+func (e *Eval) wavg(exp *ast.CallExpr) float64 {
+	args := e.args(exp)
+	if len(args) < 2 || len(args)%2 != 0 {
+		return FloatError
+	}
+	var values, weights []float64
+	if v, ok := numberSlice(args[0]); ok && len(args) == 2 {
+		w, ok := numberSlice(args[1])
+		if !ok || len(v) != len(w) {
+			return FloatError
+		}
+		values, weights = v, w
+	} else {
+		for i := 0; i < len(args); i += 2 {
+			values = append(values, toNumber(args[i]))
+			weights = append(weights, toNumber(args[i+1]))
+		}
+	}
+	var sum, total float64
+	for i, v := range values {
+		sum += v * weights[i]
+		total += weights[i]
+	}
+	if total == 0 {
+		return FloatError
+	}
+	return sum / total
+}
+
+// windChill - implements 'windChill(tempC, windKmh)' which returns the
+// temperature in °C felt on exposed skin at the temperature tempC in °C
+// and the wind speed in km/h 10 m above ground using the formula of the
+// US National Weather Service and Environment Canada. It is defined for
+// temperatures up to 10 °C and wind speeds above 4.8 km/h, tempC is
+// returned otherwise.
+// Returns a float64 value or math.NaN() on error, e.g. for a negative wind
+// speed.
+func (e *Eval) windChill(exp *ast.CallExpr) float64 {
+	if len(exp.Args) != 2 {
+		return FloatError
+	}
+	t := toNumber(e.getArg(exp.Args[0]))
+	v := toNumber(e.getArg(exp.Args[1]))
+	if math.IsNaN(t) || !(v >= 0) {
+		return FloatError
+	}
+	if t > 10 || v <= 4.8 {
+		return t
+	}
+	v16 := math.Pow(v, 0.16)
+	return 13.12 + 0.6215*t - 11.37*v16 + 0.3965*t*v16
+}
+
+// wordCount - implements 'wordCount(s)' which counts the words of s
+// separated by white space.
+// Returns an int or FloatError on error.
+func (e *Eval) wordCount(exp *ast.CallExpr) interface{} {
+	if len(exp.Args) != 1 {
+		return FloatError
+	}
+	s, ok := e.getArg(exp.Args[0]).(string)
+	if !ok {
+		return FloatError
+	}
+	return len(strings.Fields(s))
+}
+
+// xmlGet - implements 'xmlGet("<xml>","<path>")' which returns the text of the
+// first element at path. Path elements are separated by '/' and start with the
+// root element, a last element "@name" selects an attribute. Namespaces are
+// ignored.
+//
+// Example:
+//   xmlGet(status,"root/device/serial")  ... "A123" with <root><device id="7"><serial>A123</serial>...
+//   xmlGet(status,"root/device/@id")     ... "7"
+//
+// Returns a string or an empty string when path is not found.
+func (e *Eval) xmlGet(exp *ast.CallExpr) string {
+	if len(exp.Args) != 2 {
+		return ""
+	}
+	text, ok1 := e.getArg(exp.Args[0]).(string)
+	path, ok2 := e.getArg(exp.Args[1]).(string)
+	if !ok1 || !ok2 || path == "" {
+		return ""
+	}
+	result, _ := xmlPath(text, strings.Split(path, "/"))
+	return result
+}
+
 // int converts input to an integer
 func (e *Eval) int(exp *ast.CallExpr) interface{} {
 	l := len(exp.Args)
@@ -1175,7 +4624,6 @@ func (e *Eval) int(exp *ast.CallExpr) interface{} {
 	case float64:
 		return int(val)
 	case string:
-		val = stringer(val)
 		i, err := strconv.Atoi(val) // first try -> integer
 		if err == nil {
 			return i
@@ -1189,15 +4637,337 @@ func (e *Eval) int(exp *ast.CallExpr) interface{} {
 	return FloatError
 }
 
-// stringer removes "" from a string at the beginning and at the end
-func stringer(s string) string {
-	if len(s) < 1 {
-		return ""
+// unquote returns the value of the string literal lit. Literals with
+// escapes unknown to Go like "^\d+$" keep their backslashes.
+func unquote(lit string) string {
+	if s, err := strconv.Unquote(lit); err == nil {
+		return s
 	}
-	if s[0:1] == `"` && s[len(s)-1:] == `"` {
-		return strings.Trim(s, `"`)
+	return lit[1 : len(lit)-1]
+}
+
+// jsonPath returns the element of a decoded JSON document at path,
+// see jsonType()
+func jsonPath(doc interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return doc, true
 	}
-	return s
+	for _, key := range strings.Split(path, "/") {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if doc, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// xmlPath streams through the XML document and returns the text or attribute
+// of the first element matching path, see xmlGet()
+func xmlPath(text string, path []string) (string, bool) {
+	attr := ""
+	if last := path[len(path)-1]; strings.HasPrefix(last, "@") {
+		attr = last[1:]
+		path = path[:len(path)-1]
+	}
+	d := xml.NewDecoder(strings.NewReader(text))
+	d.Strict = false
+	depth := 0   // depth of the current element
+	matched := 0 // number of path elements matched by open elements
+	var content strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", false
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if matched == depth-1 && matched < len(path) && t.Name.Local == path[matched] {
+				matched++
+				if matched == len(path) && attr != "" {
+					for _, a := range t.Attr {
+						if a.Name.Local == attr {
+							return a.Value, true
+						}
+					}
+					return "", false
+				}
+			}
+		case xml.CharData:
+			if matched == len(path) && depth == matched {
+				content.Write(t)
+			}
+		case xml.EndElement:
+			if matched == len(path) && depth == matched {
+				return strings.TrimSpace(content.String()), true
+			}
+			if matched == depth {
+				matched--
+			}
+			depth--
+		}
+	}
+}
+
+// jwtVerify checks the HS256 signature of the token parts with key,
+// see jwtClaim()
+func jwtVerify(parts []string, key string) bool {
+	header, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+	if err != nil {
+		return false
+	}
+	var h struct {
+		Alg string `json:"alg"`
+	}
+	if json.Unmarshal(header, &h) != nil || h.Alg != "HS256" {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// levenshtein returns the edit distance of a and b counted in runes
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			next := row[j-1] + 1
+			if row[j]+1 < next {
+				next = row[j] + 1
+			}
+			if prev+cost < next {
+				next = prev + cost
+			}
+			prev, row[j] = row[j], next
+		}
+	}
+	return row[len(t)]
+}
+
+// naturalCompare compares a and b in natural order and returns -1, 0 or 1.
+// Runs of digits are compared by their numeric value, all other characters
+// byte by byte. Ties like "a01" and "a1" are broken lexically, so 0 is
+// returned for equal strings only.
+func naturalCompare(a, b string) int {
+	isDigit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			// compare the numbers without leading zeros by length first
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x := strings.TrimLeft(a[si:i], "0")
+			y := strings.TrimLeft(b[sj:j], "0")
+			if len(x) != len(y) {
+				if len(x) < len(y) {
+					return -1
+				}
+				return 1
+			}
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			if a[i] < b[j] {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+	switch {
+	case len(a)-i < len(b)-j:
+		return -1
+	case len(a)-i > len(b)-j:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// splitWords splits s into words at all characters which are neither
+// letters nor digits and where lower case changes to upper case, e.g.
+// "HTTPServer up-time" results in "HTTP", "Server", "up" and "time".
+func splitWords(s string) []string {
+	var words []string
+	r := []rune(s)
+	start := -1
+	for i := 0; i <= len(r); i++ {
+		if i == len(r) || !(unicode.IsLetter(r[i]) || unicode.IsDigit(r[i])) {
+			if start >= 0 {
+				words = append(words, string(r[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+			continue
+		}
+		// "diskUsage" or "HTTPServer"
+		if unicode.IsUpper(r[i]) && (unicode.IsLower(r[i-1]) ||
+			(unicode.IsUpper(r[i-1]) && i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			words = append(words, string(r[start:i]))
+			start = i
+		}
+	}
+	return words
+}
+
+// capitalize returns w with an upper case first letter
+// and the rest in lower case
+func capitalize(w string) string {
+	r := []rune(strings.ToLower(w))
+	if len(r) > 0 {
+		r[0] = unicode.ToUpper(r[0])
+	}
+	return string(r)
+}
+
+// timeLayouts are the layouts of timestamp strings understood by toTime,
+// timestamps without time zone are local time
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+	time.UnixDate,
+	time.ANSIC,
+}
+
+// toTime converts an epoch in seconds or milliseconds or a timestamp
+// string to a time
+func toTime(x interface{}) (time.Time, bool) {
+	if s, ok := x.(string); ok {
+		s = strings.TrimSpace(s)
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, true
+			}
+		}
+		x = s
+	}
+	epoch := toNumber(x)
+	if math.IsNaN(epoch) || math.IsInf(epoch, 0) {
+		return time.Time{}, false
+	}
+	// epochs in milliseconds, 1e12 seconds are in the year 33658
+	if math.Abs(epoch) >= 1e12 {
+		epoch /= 1000
+	}
+	sec, frac := math.Modf(epoch)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// numberSlice converts a slice to float64 values, elements which are no
+// numbers are math.NaN(). ok is false when x is no slice.
+func numberSlice(x interface{}) (floats []float64, ok bool) {
+	switch v := x.(type) {
+	case []float64:
+		return v, true
+	case []int:
+		floats = make([]float64, len(v))
+		for i, n := range v {
+			floats[i] = float64(n)
+		}
+		return floats, true
+	case []interface{}:
+		floats = make([]float64, len(v))
+		for i, n := range v {
+			floats[i] = toNumber(n)
+		}
+		return floats, true
+	case Values:
+		return numberSlice([]interface{}(v))
+	}
+	return nil, false
+}
+
+// sameValue compares values of any type, numbers are equal
+// when their values are, e.g. 1 and 1.0
+func sameValue(a, b interface{}) bool {
+	x, y := toNumber(a), toNumber(b)
+	_, aString := a.(string)
+	_, bString := b.(string)
+	if !aString && !bString && !math.IsNaN(x) && !math.IsNaN(y) {
+		return x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// floatSlice returns the numbers of a state value, a StateStore
+// decoding JSON returns []interface{} instead of []float64
+func floatSlice(x interface{}) []float64 {
+	switch v := x.(type) {
+	case []float64:
+		return v
+	case []interface{}:
+		floats := make([]float64, 0, len(v))
+		for _, f := range v {
+			if f, ok := f.(float64); ok {
+				floats = append(floats, f)
+			}
+		}
+		return floats
+	}
+	return nil
+}
+
+// toNumber converts numbers and numeric strings to a float64 value.
+// It returns FloatError for all other values.
+func toNumber(x interface{}) float64 {
+	switch v := x.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float64:
+		return v
+	case string:
+		return toFloat(v)
+	}
+	return FloatError
 }
 
 // toFloat takes string s and converts it to a float64 value. It
@@ -1,9 +1,13 @@
 package eval
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"math"
 	"os"
-	"strings"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -37,7 +41,7 @@ func TestBit(t *testing.T) {
 	for k := range falseInput {
 		e := New(k)
 		if e.ParseExpr() != nil {
-			t.Errorf("ParseExpr %s leads to error %s", k, e)
+			t.Errorf("ParseExpr %s leads to error %s", k, e.ParseExpr())
 		}
 		r := e.Run()
 		var f float64
@@ -235,11 +239,16 @@ func TestCompare(t *testing.T) {
 		"\"a\" == \"a\" && 2 > 0": true,
 		"\"a\" != \"a\" && 2 > 0": false,
 		`(val("Rtt")>=0.03)`:      true,
+		// float64 != int compared == before
+		`val("pi") != 3`: true,
+		`val("f") != 2`:  false,
+		`2.0 != 2`:       false,
+		`2 != val("pi")`: true,
 	}
 
 	for s, r := range ok {
 		e := New(s)
-		e.Variables(map[string]interface{}{"i": 2, "pi": 3.141, "Rtt": 0.046})
+		e.Variables(map[string]interface{}{"i": 2, "pi": 3.141, "Rtt": 0.046, "f": 2.0})
 		if e.ParseExpr() != nil {
 			t.Errorf("Input %s leads to an error", s)
 		}
@@ -634,6 +643,118 @@ func TestRound(t *testing.T) {
 	}
 }
 
+// floor, ceil and trunc
+func TestFloorCeilTrunc(t *testing.T) {
+
+	var ok = map[string]float64{
+		`floor(3.94159)`:         3,
+		`floor(3.14159,2)`:       3.14,
+		`floor(-3.14159,1)`:      -3.2,
+		`floor(2.675,2)`:         2.67,
+		`floor(1234,-2)`:         1200,
+		`ceil(3.14159)`:          4,
+		`ceil(3.14159,2)`:        3.15,
+		`ceil(-3.14159,1)`:       -3.1,
+		`ceil(1.1,1)`:            1.1,
+		`ceil("3.001",2)`:        3.01,
+		`trunc(3.94159)`:         3,
+		`trunc(-3.94159)`:        -3,
+		`trunc(3.14159,3)`:       3.141,
+		`trunc(-3.14159,3)`:      -3.141,
+		`math.floor(7.5)`:        7,
+		`math.ceil(7.5)`:         8,
+		`math.trunc(-7.5)`:       -7,
+		`trunc(0.1+0.2, 1)`:      0.3,
+		`floor(2.9999999999)`:    2,
+		`floor(2.9999999999,0)`:  2,
+		`trunc(-2.9999999999,0)`: -2,
+		`floor(0.9999999999,2)`:  0.99,
+		`ceil(3.0000000001)`:     4,
+		`ceil(3.0000000001,0)`:   4,
+		`floor(4.35,2)`:          4.35,
+	}
+
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if result != r {
+			t.Errorf("Expected %f from %s as output but got %v", r, s, result)
+		}
+	}
+
+	for _, s := range []string{`floor("x")`, `ceil(1.5,"x")`, `trunc(x)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s as output but got %v", s, result)
+		}
+	}
+}
+
+// clamp
+func TestClamp(t *testing.T) {
+	var ok = map[string]float64{
+		`clamp(120,0,100)`:           100,
+		`clamp(-5,0,100)`:            0,
+		`clamp(42.5,0,100)`:          42.5,
+		`clamp("-5",0,100)`:          0,
+		`clamp(x,"0.5",y)`:           0.5,
+		`clamp(7,7,7)`:               7,
+		`math.clamp(-1e9,-1,1)`:      -1,
+		`clamp(used/size*100,0,100)`: 100,
+	}
+	for s, r := range ok {
+		result, err := New(s).Variables(map[string]interface{}{
+			"x": int64(0), "y": 1, "used": 110, "size": 100.0,
+		}).RunErr()
+		if err != nil || result != r {
+			t.Errorf("Expected %v from %s as output but got %v, %v", r, s, result, err)
+		}
+	}
+
+	for _, s := range []string{`clamp(1,10,0)`, `clamp("x",0,1)`, `clamp(1,0,z)`} {
+		result, _ := New(s).RunErr()
+		if f, ok := result.(float64); !ok || !math.IsNaN(f) {
+			t.Errorf("Expected NaN from %s as output but got %v", s, result)
+		}
+	}
+}
+
+// sin, cos, tan, asin, acos, atan, atan2, deg2rad and rad2deg
+func TestTrigonometry(t *testing.T) {
+	variables := map[string]interface{}{"lat": 48.2, "decl": 23.44, "h": 0.0}
+	var ok = map[string]float64{
+		`sin(0)`:                      0,
+		`round(sin(deg2rad(30)),9)`:   0.5,
+		`cos(0)`:                      1,
+		`round(cos(deg2rad(60)),9)`:   0.5,
+		`round(tan(deg2rad(45)),9)`:   1,
+		`round(rad2deg(asin(0.5)),9)`: 30,
+		`round(rad2deg(acos(0.5)),9)`: 60,
+		`rad2deg(atan(1))`:            45,
+		`rad2deg(atan2(1, -1))`:       135,
+		`rad2deg(atan2(-1, -1))`:      -135,
+		`deg2rad(180)`:                math.Pi,
+		`rad2deg(math.asin(1))`:       90,
+		`math.cos(deg2rad("180"))`:    -1,
+		`round(rad2deg(asin(sin(deg2rad(lat))*sin(deg2rad(decl)) + cos(deg2rad(lat))*cos(deg2rad(decl))*cos(deg2rad(h)))),2)`: 65.24,
+	}
+	for s, r := range ok {
+		result, err := New(s).Variables(variables).RunErr()
+		if err != nil || result != r {
+			t.Errorf("Expected %v from %s as output but got %v, %v", r, s, result, err)
+		}
+	}
+
+	for _, s := range []string{`asin(2)`, `acos(-1.5)`, `sin("x")`, `atan2(1, x)`, `deg2rad(x)`} {
+		result, _ := New(s).RunErr()
+		if f, ok := result.(float64); !ok || !math.IsNaN(f) {
+			t.Errorf("Expected NaN from %s as output but got %v", s, result)
+		}
+	}
+}
+
 // time ("","")
 func TestTime(t *testing.T) {
 
@@ -711,45 +832,120 @@ func TestVal(t *testing.T) {
 func TestSetVal(t *testing.T) {
 
 	var ok = map[string]interface{}{
-		`setVal("a",true) ; val("a")`:                                  true,
-		`setVal("a",false) ; val("a")`:                                 false,
-		`setVal("a",0) ; val("a")`:                                     0,
-		`setVal("n",10) ; setVal("n",val("n")+3*4) ; val("n")`:         22,
-		`setVal("a",int(-3.141)) ; a)`:                                 -3,
-		`setVal("a",-3.141) ; val("a")`:                                -3.141,
-		`setVal("s","str") ; val("s")`:                                 "str",
-		`setVal("s","") ; val("s")`:                                    "",
-		`setVal("a",10,"$SYS/b",20) ; val("$SYS/b")`:                   20,
-		`setVal("a",10,"$SYS/b",20) ; val("a")`:                        10,
-		`setVal("a","1","$SYS/b","20") ; val("$SYS/b")`:                "20",
-		`setVal("a","1","$SYS/b","20") ; val("a")`:                     "1",
-		`setVal("Text",sprintf("x %.2f y",100/3) ; val("Text")`:        "x 33.33 y",
-		`setVal("Text",sprintf("x %.2f y",3/100) ; val("Text")`:        "x 0.03 y",
-		`setVal("Text",sprintf("x %.2f y",1000*0.00333) ; Text)`:       "x 3.33 y",
-		`setVal("Text",sprintf("x %.2f y",0.00333*1000) ; val("Text")`: "x 3.33 y",
-		`setVal("Text",sprintf("x %.2f y",0.0333+1000) ; val("Text")`:  "x 1000.03 y",
-		`setVal("Text",sprintf("x %.2f y",1000+0.0333) ; val("Text")`:  "x 1000.03 y",
-		`setVal("Text",sprintf("x %.2f y",0.0333-1000) ; val("Text")`:  "x -999.97 y",
-		`setVal("Text",sprintf("x %.2f y",1000-0.0333) ; val("Text")`:  "x 999.97 y",
+		`setVal("a",true) ; val("a")`:                                   true,
+		`setVal("a",false) ; val("a")`:                                  false,
+		`setVal("a",0) ; val("a")`:                                      0,
+		`setVal("n",10) ; setVal("n",val("n")+3*4) ; val("n")`:          22,
+		`setVal("a",int(-3.141)) ; a`:                                   -3,
+		`setVal("a",-3.141) ; val("a")`:                                 -3.141,
+		`setVal("s","str") ; val("s")`:                                  "str",
+		`setVal("s","") ; val("s")`:                                     "",
+		`setVal("a",10,"$SYS/b",20) ; val("$SYS/b")`:                    20,
+		`setVal("a",10,"$SYS/b",20) ; val("a")`:                         10,
+		`setVal("a","1","$SYS/b","20") ; val("$SYS/b")`:                 "20",
+		`setVal("a","1","$SYS/b","20") ; val("a")`:                      "1",
+		`setVal("Text",sprintf("x %.2f y",100/3)) ; val("Text")`:        "x 33.33 y",
+		`setVal("Text",sprintf("x %.2f y",3/100)) ; val("Text")`:        "x 0.03 y",
+		`setVal("Text",sprintf("x %.2f y",1000*0.00333)) ; Text`:        "x 3.33 y",
+		`setVal("Text",sprintf("x %.2f y",0.00333*1000)) ; val("Text")`: "x 3.33 y",
+		`setVal("Text",sprintf("x %.2f y",0.0333+1000)) ; val("Text")`:  "x 1000.03 y",
+		`setVal("Text",sprintf("x %.2f y",1000+0.0333)) ; val("Text")`:  "x 1000.03 y",
+		`setVal("Text",sprintf("x %.2f y",0.0333-1000)) ; val("Text")`:  "x -999.97 y",
+		`setVal("Text",sprintf("x %.2f y",1000-0.0333)) ; val("Text")`:  "x 999.97 y",
 	}
 
 	for k, v := range ok {
-		fields := strings.Split(k, " ; ")
-		e := New("")
-		for _, x := range fields {
-			e.SetInput(x)
-			_ = e.ParseExpr()
-			vRet := e.Run()
-			if vRet == nil {
-				continue
-			}
-			if vRet != v {
-				t.Errorf("%s failed expected %v and got %v", k, v, vRet)
-			}
+		e := New(k)
+		if err := e.ParseExpr(); err != nil {
+			t.Errorf("%s: %v", k, err)
+			continue
+		}
+		if vRet := e.Run(); vRet != v {
+			t.Errorf("%s failed expected %v and got %v", k, v, vRet)
+		}
+	}
+
+}
+
+func TestLet(t *testing.T) {
+	var ok = map[string]interface{}{
+		`let("x",pow(3,2),ifExpr(x>5,x,0))`: 9.0,
+		`let("a",2,"b",a*10,a+b)`:           22,
+		`let("s","abc",substr(s,1,1))`:      "b",
+		`let("v",1,let("v",2,v)+v)`:         3,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+		if _, found := e.lookup("x"); found {
+			t.Errorf("%s leaks its variables", s)
+		}
+	}
+
+	var wrong = []string{`let()`, `let("x",1)`, `let(1,2,3)`}
+	for _, s := range wrong {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s as output but got %v", s, result)
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	_ = os.Setenv("x", "3.14159")
+	var ok = map[string]interface{}{
+		`chain(env("x"),"float64","round",2)`: 3.14,
+		`chain(-2,"abs","pow",3)`:             8.0,
+		`chain(16,"sqrt")`:                    4.0,
+		`chain("MyNameIsJohn","substr",2,4)`:  "Name",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
 
+	var wrong = []string{`chain(1)`, `chain(1,"unknown")`, `chain(1,2)`}
+	for _, s := range wrong {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s as output but got %v", s, result)
 		}
 	}
+}
+
+// Reset must drop variables set by setVal but never touch external maps
+func TestReset(t *testing.T) {
+	e := New(`setVal("a",1)`)
+	_ = e.ParseExpr()
+	e.Run()
+	e.Reset(`val("a")`)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != "" {
+		t.Errorf("Expected empty string after Reset but got %v", result)
+	}
 
+	vars := map[string]interface{}{"x": 1}
+	e = New(`setVal("y",2)`).Variables(vars)
+	_ = e.ParseExpr()
+	e.Run()
+	e.Reset(`val("x")`)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != "" {
+		t.Errorf("Expected empty string after Reset but got %v", result)
+	}
+	if len(vars) != 2 {
+		t.Errorf("Reset must not modify external variables, got %v", vars)
+	}
 }
 
 // val -> an unknown variable must be math.NaN !
@@ -847,7 +1043,8 @@ func TestSprintf(t *testing.T) {
 	}
 	var ok = map[string]string{
 		`sprintf("")`:            "",
-		`sprintf("a","b")`:       "a%!(EXTRA string=\"b\")",
+		`sprintf("a","b")`:       "a%!(EXTRA string=b)",
+		`sprintf("%s!","hi")`:    "hi!",
 		`sprintf("%.2f",1/(9/3)`: "0.33",
 		`sprintf("%s,%d,%.3f,%t",val("h"),val("n"),val("pi"),b)`: "srv.demo.at,-15,3.141,true",
 		`sprintf("%s,%d,%.3f,%t",h,n,pi,b)`:                      "srv.demo.at,-15,3.141,true",
@@ -863,6 +1060,2167 @@ func TestSprintf(t *testing.T) {
 	}
 }
 
+func TestTemplate(t *testing.T) {
+	var vars = map[string]interface{}{
+		"host":    "srv1",
+		"load":    97.5,
+		"$SYS/n":  3,
+		"payload": map[string]interface{}{"a": 1, "b": "two"},
+	}
+	var ok = map[string]string{
+		`template("Host {host} is at {load}%")`: "Host srv1 is at 97.5%",
+		`template("{$SYS/n} {unknown} {}")`:     "3 {unknown} {}",
+		`template("{a}/{b} {host}",payload)`:    "1/two {host}",
+		`template("")`:                          "",
+		`template("{host}",host)`:               "",
+		`template()`:                            "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(vars)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestPlural(t *testing.T) {
+	german := map[string]string{"host": "Host", "hosts": "Hosts", "down": "ausgefallen"}
+	catalog := func(text string) (string, bool) {
+		translation, ok := german[text]
+		return translation, ok
+	}
+
+	var ok = map[string][2]string{
+		`plural(1,"host","hosts")`:                    {"host", "Host"},
+		`plural(0,"host","hosts")`:                    {"hosts", "Hosts"},
+		`plural("2.0","host","hosts")`:                {"hosts", "Hosts"},
+		`sprintf("%d %s",n,plural(n,"host","hosts"))`: {"3 hosts", "3 Hosts"},
+		`translate("down")`:                           {"down", "ausgefallen"},
+		`translate("unknown")`:                        {"unknown", "unknown"},
+		`plural("x","host","hosts")`:                  {"", ""},
+		`plural(1,"host")`:                            {"", ""},
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{"n": 3})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r[0] {
+			t.Errorf("Expected %s from %s as output but got %v", r[0], s, result)
+		}
+		e.Catalog(catalog)
+		if result := e.Run(); result != r[1] {
+			t.Errorf("Expected %s from %s as output but got %v", r[1], s, result)
+		}
+	}
+}
+
+func TestCheckDigits(t *testing.T) {
+	var ok = map[string]bool{
+		`luhnValid("4111 1111 1111 1111")`:          true,
+		`luhnValid("4111-1111-1111-1112")`:          false,
+		`luhnValid(79927398713)`:                    true,
+		`luhnValid(79927398710)`:                    false,
+		`luhnValid("49015420323751")`:               true,
+		`luhnValid("0")`:                            false,
+		`luhnValid("abc")`:                          false,
+		`luhnValid(1.5)`:                            false,
+		`mod97Valid("AT61 1904 3002 3457 3201")`:    true,
+		`mod97Valid("at611904300234573201")`:        true,
+		`mod97Valid("AT61 1904 3002 3457 3202")`:    false,
+		`mod97Valid("DE89370400440532013000")`:      true,
+		`mod97Valid("GB82 WEST 1234 5698 7654 32")`: true,
+		`mod97Valid("AT61")`:                        false,
+		`mod97Valid("AT61 1904 3002 3457 32_1")`:    false,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestIsEmailIsURL(t *testing.T) {
+	var ok = map[string]bool{
+		`isEmail("john@example.com")`:             true,
+		`isEmail("john.doe+tag@mail.example.at")`: true,
+		`isEmail("John <john@example.com>")`:      false,
+		`isEmail("john.example.com")`:             false,
+		`isEmail("john@")`:                        false,
+		`isEmail(5)`:                              false,
+		`isURL("https://example.com/status?x=1")`: true,
+		`isURL("ftp://10.0.0.1:21")`:              true,
+		`isURL("example.com")`:                    false,
+		`isURL("/relative/path")`:                 false,
+		`isURL("http://exa mple.com")`:            false,
+		`isURL(true)`:                             false,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	var ok = map[string]interface{}{
+		`naturalCompare("eth2","eth10")`: -1,
+		`naturalCompare("srv10","srv9")`: 1,
+		`naturalCompare("a01","a1")`:     -1,
+		`naturalCompare("a1","a01")`:     1,
+		`naturalCompare("a1b2","a01b1")`: 1,
+		`naturalCompare("abc","abc")`:    0,
+		`naturalCompare("abc","abd")`:    -1,
+		`naturalCompare("abc1","abc")`:   1,
+		`naturalCompare("1.10","1.9")`:   1,
+		`naturalCompare("x",1)`:          math.NaN(),
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, isFloat := r.(float64); isFloat && math.IsNaN(f) {
+			if f, _ := result.(float64); math.IsNaN(f) {
+				continue
+			}
+		}
+		if result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+
+	var natural = map[string]bool{
+		`"eth2" < "eth10"`:  true,
+		`"eth2" > "eth10"`:  false,
+		`"eth10" >= "eth9"`: true,
+		`"eth9" <= "eth9"`:  true,
+		`"a01" <= "a1"`:     true,
+		`"a01" >= "a1"`:     false,
+	}
+	for s, r := range natural {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s without NaturalOrder but got %v", s, result)
+		}
+		if result := e.NaturalOrder(true).Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+
+	// == and != agree with the order
+	e := New(`"a01" == "a1" || "a01" <= "a1" && "a01" >= "a1"`).NaturalOrder(true)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != false {
+		t.Errorf("Expected false but got %v", result)
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	var ok = map[string]interface{}{
+		`levenshtein("kitten","sitting")`:        3,
+		`levenshtein("srv1","srv1")`:             0,
+		`levenshtein("","abc")`:                  3,
+		`levenshtein("Grüße","Grüsse")`:          2,
+		`fuzzyMatch("srv-web01","srv-web1",0.8)`: true,
+		`fuzzyMatch("srv-web01","db-02",0.8)`:    false,
+		`fuzzyMatch("","",1)`:                    true,
+		`fuzzyMatch("a","b","x")`:                false,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestPhonetic(t *testing.T) {
+	var ok = map[string]string{
+		`soundex("Robert")`:    "R163",
+		`soundex("Rupert")`:    "R163",
+		`soundex("Tymczak")`:   "T522",
+		`soundex("Pfister")`:   "P236",
+		`soundex("Ashcraft")`:  "A261",
+		`soundex("Lee")`:       "L000",
+		`soundex("123")`:       "",
+		`soundex(1)`:           "",
+		`metaphone("Knight")`:  "NT",
+		`metaphone("Wright")`:  "RT",
+		`metaphone("Smith")`:   "SM0",
+		`metaphone("Smyth")`:   "SM0",
+		`metaphone("Phone")`:   "FN",
+		`metaphone("Xavier")`:  "SFR",
+		`metaphone("Thumb")`:   "0M",
+		`metaphone("School")`:  "SKL",
+		`metaphone("Nation")`:  "NXN",
+		`metaphone("Judge")`:   "JJ",
+		`metaphone("Science")`: "SNS",
+		`metaphone("")`:        "",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	var ok = map[string]bool{
+		`globMatch("eth*","eth0")`:                           true,
+		`globMatch("eth*",ifName)`:                           true,
+		`globMatch("eth?","eth10")`:                          false,
+		`globMatch("srv-??.example.at","srv-01.example.at")`: true,
+		`globMatch("Gi[0-3]/*","Gi1/0")`:                     true,
+		`globMatch("Gi[0-3]/*","Gi1/0/24")`:                  false,
+		`globMatch("1*",123)`:                                true,
+		`globMatch("[","x")`:                                 false,
+		`globMatch(1,"1")`:                                   false,
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{"ifName": "eth12"})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestCsvField(t *testing.T) {
+	var ok = map[string]string{
+		`csvField(line,1)`:         "Vienna, AT",
+		`csvField(line,2)`:         "up",
+		`csvField("a;b;c",-1,";")`: "c",
+		`csvField("a;b;c",0,";")`:  "a",
+		`csvField(quoted,1)`:       `say "hi"`,
+		`csvField("a,b",2)`:        "",
+		`csvField("a,b",-3)`:       "",
+		`csvField("a,b","x")`:      "",
+		`csvField("a,b",0,";;")`:   "",
+		`csvField("a",0,1,2)`:      "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{
+			"line":   `srv1,"Vienna, AT",up`,
+			"quoted": `a,"say ""hi""",c`,
+		})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestCsvLine(t *testing.T) {
+	var ok = map[string]string{
+		`csvLine("srv1","Vienna, AT",97.5)`:        `srv1,"Vienna, AT",97.5`,
+		`csvLine(host,quote,up)`:                   `srv1,"say ""hi""",true`,
+		`csvLine(samples...)`:                      `1.5,2.5,4`,
+		`csvLine("a\nb", 1, 10/0.0)`:               "\"a\nb\",1,+Inf",
+		`csvLine(1, missing, "x")`:                 `1,,x`,
+		`csvLine("")`:                              ``,
+		`csvLine(" lead")`:                         `" lead"`,
+		`csvField(csvLine(host,"a,b",up),1)`:       "a,b",
+		`str.csvLine(int(7), float64("2.50"), "")`: `7,2.5,`,
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{
+			"host":    "srv1",
+			"quote":   `say "hi"`,
+			"up":      true,
+			"samples": []float64{1.5, 2.5, 4},
+		})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestKvGet(t *testing.T) {
+	var ok = map[string]interface{}{
+		`kvGet("a=1;b=two;c=3","b")`:                 "two",
+		`kvGet("a=1;b=two;c=3","a")`:                 "1",
+		`kvGet("a=1;b=two;c=3","d")`:                 "",
+		`kvGet("url=http://x/?q=1","url")`:           "http://x/?q=1",
+		`kvGet(status,"state")`:                      "up",
+		`float64(kvGet("temp=21.5, hum=40","temp"))`: 21.5,
+		`float64(kvGet("temp=21.5, hum=40"," hum"))`: math.NaN(),
+		`kvGet("a=1",1)`:                             "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{"status": "load = 0.5\nstate = up\n"})
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, isFloat := r.(float64); isFloat && math.IsNaN(f) {
+			if f, _ := result.(float64); math.IsNaN(f) {
+				continue
+			}
+		}
+		if result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestQueryParam(t *testing.T) {
+	var ok = map[string]string{
+		`queryParam("a=1&msg=disk%20full","msg")`:        "disk full",
+		`queryParam("a=1&b=2","b")`:                      "2",
+		`queryParam("a=1&b=2","c")`:                      "",
+		`queryParam("https://x.at/hook?id=7&id=8","id")`: "7",
+		`queryParam("q=a+b%26c","q")`:                    "a b&c",
+		`queryParam("a=%zz","a")`:                        "",
+		`queryParam("a=%zz&b=2","b")`:                    "2",
+		`queryParam("b=2&c=1;2&a=%zz","b")`:              "2",
+		`queryParam("a=1",1)`:                            "",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestJson(t *testing.T) {
+	var ok = map[string]interface{}{
+		`jsonValid(payload)`:                true,
+		`jsonValid("[1,2]")`:                true,
+		`jsonValid("{")`:                    false,
+		`jsonValid(1)`:                      false,
+		`jsonType(payload,"")`:              "object",
+		`jsonType(payload,"device")`:        "object",
+		`jsonType(payload,"device/temp")`:   "number",
+		`jsonType(payload,"device/tags")`:   "array",
+		`jsonType(payload,"device/tags/0")`: "string",
+		`jsonType(payload,"device/tags/1")`: "",
+		`jsonType(payload,"device/ok")`:     "bool",
+		`jsonType(payload,"device/serial")`: "null",
+		`jsonType(payload,"device/x")`:      "",
+		`jsonType(payload,"device/temp/x")`: "",
+		`jsonType("{","")`:                  "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{
+			"payload": `{"device":{"temp":21.5,"tags":["a"],"ok":true,"serial":null}}`,
+		})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestXmlGet(t *testing.T) {
+	const status = `<?xml version="1.0"?>
+<root xmlns:x="urn:x">
+  <info>skip <serial>wrong</serial></info>
+  <device id="7" x:type="ups">
+    <serial> A123 </serial>
+    <load unit="%">42</load>
+  </device>
+  <device id="8"><serial>B456</serial></device>
+</root>`
+	var ok = map[string]string{
+		`xmlGet(status,"root/device/serial")`: "A123",
+		`xmlGet(status,"root/device/@id")`:    "7",
+		`xmlGet(status,"root/device/@type")`:  "ups",
+		`xmlGet(status,"root/device/load")`:   "42",
+		`xmlGet(status,"root/device/@x")`:     "",
+		`xmlGet(status,"root/serial")`:        "",
+		`xmlGet(status,"device/serial")`:      "",
+		`xmlGet(status,"root/info")`:          "skip",
+		`xmlGet("<a>","a")`:                   "",
+		`xmlGet(status,"")`:                   "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{"status": status})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestHtmlEscape(t *testing.T) {
+	var ok = map[string]string{
+		`htmlEscape("load > 90% & rising")`:           "load &gt; 90% &amp; rising",
+		`htmlEscape("<b>")`:                           "&lt;b&gt;",
+		`htmlEscape(quoted)`:                          "&#39;a&#39; &#34;b&#34;",
+		`htmlEscape(1)`:                               "",
+		`htmlUnescape("Gr&#252;&szlig;e &amp; mehr")`: "Grüße & mehr",
+		`htmlUnescape(htmlEscape(quoted))`:            `'a' "b"`,
+		`htmlUnescape(true)`:                          "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{"quoted": `'a' "b"`})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	vars := map[string]interface{}{
+		"colored": "\x1b[1;32mOK\x1b[0m done\x1b]0;title\x07\x1b[2K\x1bM",
+		"control": "a\x00b\rc\x7f\td\ne\xff",
+	}
+	var ok = map[string]string{
+		`stripAnsi(colored)`:    "OK done",
+		`stripAnsi("plain")`:    "plain",
+		`stripAnsi(1)`:          "",
+		`stripControl(control)`: "abc\td\ne",
+		`stripControl("plain")`: "plain",
+		`stripControl(1)`:       "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(vars)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %q from %s as output but got %q", r, s, result)
+		}
+	}
+}
+
+func TestNormalizeSpace(t *testing.T) {
+	var ok = map[string]interface{}{
+		`normalizeSpace(output)`:                            "status: up since 3 days",
+		`normalizeSpace(output)=="status: up since 3 days"`: true,
+		`normalizeSpace("a b")`:                             "a b",
+		`normalizeSpace("   ")`:                             "",
+		`normalizeSpace(1)`:                                 "",
+	}
+	for s, r := range ok {
+		e := New(s).Variables(map[string]interface{}{"output": "  status:\n\tup  since\r\n3 days \n"})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestCaseStyles(t *testing.T) {
+	var ok = map[string]string{
+		`camelCase("disk usage percent")`:   "diskUsagePercent",
+		`camelCase("HTTP server")`:          "httpServer",
+		`camelCase("HTTPServer up-time")`:   "httpServerUpTime",
+		`kebabCase("Disk Usage %")`:         "disk-usage",
+		`snakeCase("Disk Usage (Percent)")`: "disk_usage_percent",
+		`snakeCase("ifInOctets")`:           "if_in_octets",
+		`snakeCase("eth0 rx bytes")`:        "eth0_rx_bytes",
+		`titleCase("disk_usage_percent")`:   "Disk Usage Percent",
+		`titleCase("größe ändern")`:         "Größe Ändern",
+		`titleCase("")`:                     "",
+		`snakeCase(1)`:                      "",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestEllipsis(t *testing.T) {
+	var ok = map[string]string{
+		`ellipsis("disk usage critical", 10)`: "disk usag…",
+		`ellipsis("größe ändern", 6)`:         "größe…",
+		`ellipsis("größe", 5)`:                "größe",
+		`ellipsis("abc", 1)`:                  "…",
+		`ellipsis("abc", 0)`:                  "",
+		`ellipsis("abc", "x")`:                "",
+		`ellipsis("abc")`:                     "",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestWordLineCount(t *testing.T) {
+	vars := map[string]interface{}{
+		"log":   "backup started\ncopy 12 files\nbackup finished\n",
+		"multi": "a\n\nb",
+		"crlf":  "a\r\nb\r\n",
+	}
+	var ok = map[string]interface{}{
+		`lineCount(log)`:                   3,
+		`lineCount(multi)`:                 3,
+		`lineCount(crlf)`:                  2,
+		`lineCount("")`:                    0,
+		`lineCount("one")`:                 1,
+		`wordCount(log)`:                   7,
+		`wordCount("backup  finished ok")`: 3,
+		`wordCount("")`:                    0,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Variables(vars).Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`lineCount(1)`, `wordCount()`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestHashBucket(t *testing.T) {
+	var ok = map[string]interface{}{
+		`hashBucket("", 10)`:       1,
+		`hashBucket("a", 1000)`:    220,
+		`hashBucket("host1", 1)`:   0,
+		`hashBucket("host1", 2.5)`: 0,
+		`hashBucket("host2", 100)`: 27,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`hashBucket("a", 0)`, `hashBucket(1, 10)`, `hashBucket("a")`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestHmacSha256(t *testing.T) {
+	var ok = map[string]string{
+		`hmacSha256("key", "The quick brown fox jumps over the lazy dog")`: "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		`hmacSha256("", "")`:   "b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad",
+		`hmacSha256("key", 1)`: "",
+		`hmacSha256("key")`:    "",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %s from %s as output but got %v", r, s, result)
+		}
+	}
+}
+
+func TestJwtClaim(t *testing.T) {
+	sign := func(header, payload, key string) string {
+		enc := base64.RawURLEncoding
+		s := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(payload))
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(s))
+		return s + "." + enc.EncodeToString(mac.Sum(nil))
+	}
+	payload := `{"sub":"monitor","exp":1700000000,"admin":true,"roles":["read","write"],"n":null}`
+	vars := map[string]interface{}{
+		"token": sign(`{"alg":"HS256","typ":"JWT"}`, payload, "secret"),
+		"none":  sign(`{"alg":"none"}`, payload, "secret"),
+	}
+	var ok = map[string]interface{}{
+		`jwtClaim(token, "sub")`:           "monitor",
+		`jwtClaim(token, "exp")`:           1700000000.0,
+		`jwtClaim(token, "admin")`:         true,
+		`jwtClaim(token, "roles")`:         `["read","write"]`,
+		`jwtClaim(token, "roles/1")`:       "write",
+		`jwtClaim(token, "sub", "secret")`: "monitor",
+		`jwtClaim(none, "sub")`:            "monitor",
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Variables(vars).Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{
+		`jwtClaim(token, "missing")`,
+		`jwtClaim(token, "n")`,
+		`jwtClaim(token, "sub", "wrong")`,
+		`jwtClaim(none, "sub", "secret")`,
+		`jwtClaim("a.b", "sub")`,
+		`jwtClaim("a.!.c", "sub")`,
+		`jwtClaim(token)`,
+	} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Variables(vars).Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	e := New(`throttle("cpu", 2, 60)`)
+	_ = e.ParseExpr()
+	for i, tc := range []struct {
+		offset time.Duration
+		want   bool
+	}{
+		{0, true},
+		{10 * time.Second, true},
+		{20 * time.Second, false},
+		{59 * time.Second, false},
+		{60 * time.Second, true},  // first event left the window
+		{65 * time.Second, false}, // event at 10s still counts
+		{70 * time.Second, true},
+	} {
+		clock = start.Add(tc.offset)
+		if result := e.Run(); result != tc.want {
+			t.Errorf("%d: expected %v at %v but got %v", i, tc.want, tc.offset, result)
+		}
+	}
+
+	// different names don't share their budget
+	clock = start.Add(70 * time.Second)
+	e.SetInput(`throttle("disk", 2, 60)`)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != true {
+		t.Errorf("expected true for a new name but got %v", result)
+	}
+
+	// the state is kept in the Environment between runs
+	env := NewEnvironment()
+	c := MustCompile(`throttle("cpu", 1, 60)`)
+	for i, want := range []bool{true, false} {
+		if result, _ := env.Run(c); result != want {
+			t.Errorf("environment run %d: expected %v but got %v", i, want, result)
+		}
+	}
+
+	for _, s := range []string{`throttle("cpu", 1)`, `throttle(1, 1, 60)`, `throttle("cpu", "x", 60)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != false {
+			t.Errorf("expected false from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	calls := 0
+	env := NewEnvironment().Function("expensive", func(args ...interface{}) (interface{}, error) {
+		calls++
+		return float64(calls), nil
+	})
+	c := MustCompile(`cache("x", 60, expensive())`)
+	for i, tc := range []struct {
+		offset time.Duration
+		want   float64
+	}{
+		{0, 1},
+		{30 * time.Second, 1},
+		{59 * time.Second, 1},
+		{60 * time.Second, 2},
+		{90 * time.Second, 2},
+	} {
+		clock = start.Add(tc.offset)
+		if result, err := env.Run(c); err != nil || result != tc.want {
+			t.Errorf("%d: expected %v at %v but got %v, %v", i, tc.want, tc.offset, result, err)
+		}
+	}
+
+	// errors are not cached
+	e := New(`cache("n", 60, sqrt(x))`)
+	_ = e.ParseExpr()
+	e.Variables(map[string]interface{}{"x": -1.0})
+	if result := e.Run(); !math.IsNaN(result.(float64)) {
+		t.Errorf("expected NaN but got %v", result)
+	}
+	e.Variables(map[string]interface{}{"x": 4.0})
+	if result := e.Run(); result != 2.0 {
+		t.Errorf("expected 2 but got %v", result)
+	}
+
+	e = New(`cache("n", "x", 1)`)
+	_ = e.ParseExpr()
+	if result := e.Run(); !math.IsNaN(result.(float64)) {
+		t.Errorf("expected NaN but got %v", result)
+	}
+}
+
+func TestCounters(t *testing.T) {
+	env := NewEnvironment()
+	inc := MustCompile(`counterInc("failures")`)
+	for i := 1; i <= 3; i++ {
+		if result, _ := env.Run(inc); result != float64(i) {
+			t.Errorf("expected %d but got %v", i, result)
+		}
+	}
+	for _, tc := range []struct {
+		s string
+		r float64
+	}{
+		{`counterInc("failures", -1.5)`, 1.5},
+		{`counterGet("failures")`, 1.5},
+		{`counterGet("unknown")`, 0},
+	} {
+		if result, _ := env.Run(MustCompile(tc.s)); result != tc.r {
+			t.Errorf("Expected %v from %s as output but got %v", tc.r, tc.s, result)
+		}
+	}
+
+	// the counters of an Eval are kept between runs
+	e := New(`counterInc("n", 2)`)
+	_ = e.ParseExpr()
+	e.Run()
+	if result := e.Run(); result != 4.0 {
+		t.Errorf("expected 4 but got %v", result)
+	}
+
+	for _, s := range []string{`counterInc()`, `counterInc("n", "x")`, `counterGet(1)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestSetEnv(t *testing.T) {
+	const key = "EVAL_TEST_SET_ENV"
+	defer os.Unsetenv(key)
+
+	e := New(`setEnv("EVAL_TEST_SET_ENV", "a")`)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != false || e.err == nil {
+		t.Errorf("expected false and an error without AllowSetEnv but got %v, %v", result, e.err)
+	}
+	if os.Getenv(key) != "" {
+		t.Errorf("expected %s to be unset", key)
+	}
+
+	var ok = map[string]string{
+		`setEnv("EVAL_TEST_SET_ENV", "a b")`: "a b",
+		`setEnv("EVAL_TEST_SET_ENV", 2.5)`:   "2.5",
+		`setEnv("EVAL_TEST_SET_ENV", x)`:     "x",
+	}
+	for s, r := range ok {
+		e := New(s).AllowSetEnv(true).Variables(map[string]interface{}{"x": "x"})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != true || os.Getenv(key) != r {
+			t.Errorf("Expected %s from %s but got %v, %q", r, s, result, os.Getenv(key))
+		}
+	}
+
+	env := NewEnvironment().AllowSetEnv(true)
+	if result, err := env.Run(MustCompile(`setEnv("EVAL_TEST_SET_ENV", "env") && env("EVAL_TEST_SET_ENV") == "env"`)); result != true || err != nil {
+		t.Errorf("expected true from the Environment but got %v, %v", result, err)
+	}
+
+	for _, s := range []string{`setEnv("", "a")`, `setEnv("EVAL_TEST_SET_ENV")`} {
+		e := New(s).AllowSetEnv(true)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != false {
+			t.Errorf("expected false from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestMinMaxValues(t *testing.T) {
+	e := New(`setVal("lo", "hi", minMax(0, -3.33, "97.77", "x"))`)
+	_ = e.ParseExpr()
+	e.Run()
+	e.SetInput(`sprintf("%.2f %.2f", lo, hi)`)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != "-3.33 97.77" || e.err != nil {
+		t.Errorf("expected -3.33 97.77 but got %v, %v", result, e.err)
+	}
+
+	// the inputs are evaluated once
+	calls := 0
+	env := NewEnvironment().Function("expensive", func(args ...interface{}) (interface{}, error) {
+		calls++
+		return 5.0, nil
+	})
+	if _, err := env.Run(MustCompile(`setVal("lo", "hi", minMax(expensive(), 7))`)); err != nil || calls != 1 {
+		t.Errorf("expected 1 call but got %d, %v", calls, err)
+	}
+	if lo, _ := env.Get("lo"); lo != 5.0 {
+		t.Errorf("expected lo 5 but got %v", lo)
+	}
+
+	// pairs still work, Values as value of a pair are ignored
+	e = New(`setVal("a", 1, "b", "x")`)
+	_ = e.ParseExpr()
+	e.Run()
+	if e.variables["a"] != 1 || e.variables["b"] != "x" {
+		t.Errorf("unexpected variables %v", e.variables)
+	}
+
+	for _, s := range []string{`setVal("a", "b", "c", minMax(1, 2))`, `setVal("", "hi", minMax(1, 2))`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if e.Run() == nil || e.err == nil {
+			t.Errorf("expected an error from %s", s)
+		}
+	}
+	if result := MustCompile(`minMax("x")`).MustRun(nil); !math.IsNaN(result.(float64)) {
+		t.Errorf("expected NaN but got %v", result)
+	}
+	if result := MustCompile(`minMax(3, 1, 2)`).MustRun(nil); len(result.(Values)) != 2 {
+		t.Errorf("expected 2 values but got %v", result)
+	}
+
+	// a single name keeps the Values, pairs see the variables set before
+	var ok = map[string]interface{}{
+		`r = minMax(1, 5); r[1]`:                    5.0,
+		`setVal("r", minMax(1, 5)); r[0]`:           1.0,
+		`setVal(1, "hi", minMax(1, 5)); hi[1]`:      5.0,
+		`setVal("a", 1, "b", val("a") + 1); b`:      2,
+		`setVal("lo", "hi", minMax(3, 1, 2)); hi`:   3.0,
+		`setVal("a", "b", "c", counterInc("n")); c`: 1.0,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("%s: expected %v but got %v (%v)", s, r, result, e.err)
+		}
+	}
+}
+
+func TestArgMinMax(t *testing.T) {
+	vars := map[string]interface{}{"l1": 230.5, "l2": 231.0, "l3": 229.0}
+	var ok = map[string]interface{}{
+		`argMax(3,9.5,"7")`:                2,
+		`argMin(3,9.5,"7")`:                1,
+		`argMax(1,5,5)`:                    2,
+		`argMin(4,"x",-1)`:                 3,
+		`argMax("L1",l1,"L2",l2,"L3",l3)`:  "L2",
+		`argMin("L1",l1,"L2",l2,"L3",l3)`:  "L3",
+		`argMin("L1",l1,"L2","x","L3",l1)`: "L1",
+		`math.argMax(l1,l2,l3)`:            2,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Variables(vars).Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`argMax()`, `argMax("x")`, `argMin("L1",1,"L2")`, `argMin("L1",1,2,3)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestNum(t *testing.T) {
+	var ok = map[string]float64{
+		`num(" 42 ")`:   42,
+		`num("-2.5")`:   -2.5,
+		`num(3)`:        3,
+		`num(x) * 2`:    5,
+		`num("1e3")`:    1000,
+		`round(" ", 2)`: FloatError,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		result := e.Variables(map[string]interface{}{"x": "2.5"}).Run()
+		if f, _ := result.(float64); f != r && !(math.IsNaN(f) && math.IsNaN(r)) {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`num("")`, `num(env("EVAL_TEST_UNSET"))`, `num(val("missing")) * 2`,
+		`num(true)`, `num("x")`, `num()`, `round(num(""), 2)`, `pow(num(""), 0)`, `round(1.5, "")`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result, ok := e.Run().(float64); !ok || !math.IsNaN(result) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestStartOf(t *testing.T) {
+	// 2024-06-15 14:30:00 CEST
+	var ok = map[string]float64{
+		`startOfDay(1718454600, "Europe/Vienna")`:   1718402400,
+		`startOfDay(1718454600.5, "UTC")`:           1718409600,
+		`startOfHour(1718454600, "UTC")`:            1718452800,
+		`startOfHour(1718454600, "Asia/Kolkata")`:   1718454600,
+		`startOfMonth(1718454600, "Europe/Vienna")`: 1717192800,
+		`time.startOfDay("1718454600", "UTC")`:      1718409600,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`startOfDay(1718454600, "Nowhere/City")`, `startOfDay("x")`,
+		`startOfHour()`, `startOfMonth(1, 2)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	local := time.Date(2024, 6, 15, 14, 30, 0, 0, time.Local)
+	var ok = map[string]float64{
+		`parseTime("2024-06-15T12:30:00Z")`:                             1718454600,
+		`parseTime(" 2024-06-15T14:30:00.5+02:00 ")`:                    1718454600.5,
+		`parseTime("Sat, 15 Jun 2024 12:30:00 GMT")`:                    1718454600,
+		`parseTime("15.06.2024 12:30 +0000", "02.01.2006 15:04 -0700")`: 1718454600,
+		`time.parse("2024-06-15T12:30:00Z")`:                            1718454600,
+		`parseTime("15.06.2024 14:30", "02.01.2006 15:04")`:             float64(local.Unix()),
+		`parseTime("2024-06-15 14:30")`:                                 float64(local.Unix()),
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`parseTime("x")`, `parseTime(1718454600)`, `parseTime()`,
+		`parseTime("2024-06-15", "02.01.2006")`, `parseTime("15.06.2024", 1)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestAgeSeconds(t *testing.T) {
+	clock := time.Date(2024, 6, 15, 12, 30, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	local := clock.Add(-90 * time.Second).In(time.Local).Format("2006-01-02 15:04:05")
+	var ok = map[string]float64{
+		`ageSeconds(1718454540)`:                      60,
+		`ageSeconds(1718454540000)`:                   60,
+		`ageSeconds(1718454599.5)`:                    0.5,
+		`ageSeconds("1718454540")`:                    60,
+		`ageSeconds("2024-06-15T14:00:00+02:00")`:     1800,
+		`ageSeconds("2024-06-15T12:29:59.5Z")`:        0.5,
+		`ageSeconds("Sat, 15 Jun 2024 12:00:00 GMT")`: 1800,
+		`ageSeconds(local)`:                           90,
+		`ageSeconds(1718458200)`:                      -3600,
+	}
+	for s, r := range ok {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Variables(map[string]interface{}{"local": local}).Run(); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+	for _, s := range []string{`ageSeconds("")`, `ageSeconds("yesterday")`, `ageSeconds()`, `ageSeconds(true)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestRolling(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	maxExpr := MustCompile(`rollingMax("cpu", cpu, 60)`)
+	minExpr := MustCompile(`rollingMin("cpu", cpu, 60)`)
+	env := NewEnvironment()
+	for i, tc := range []struct {
+		offset   time.Duration
+		cpu      interface{}
+		min, max float64
+	}{
+		{0, 50.0, 50, 50},
+		{10 * time.Second, 90.0, 50, 90},
+		{20 * time.Second, "x", 50, 90},
+		{30 * time.Second, 70.0, 50, 90},
+		{65 * time.Second, 60.0, 60, 90}, // 50 left the window
+		{75 * time.Second, 65.0, 60, 70}, // 90 left the window
+	} {
+		clock = start.Add(tc.offset)
+		env.Set("cpu", tc.cpu)
+		max, _ := env.Run(maxExpr)
+		min, _ := env.Run(minExpr)
+		if max != tc.max || min != tc.min {
+			t.Errorf("%d: expected %v..%v but got %v..%v", i, tc.min, tc.max, min, max)
+		}
+	}
+
+	// without valid samples
+	for _, s := range []string{`rollingMax("n", "x", 60)`, `rollingMin("n", 1, "x")`, `rollingMin("n", 1)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestFlapCount(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	c := MustCompile(`flapCount("web", down, 60)`)
+	env := NewEnvironment()
+	for i, tc := range []struct {
+		offset   time.Duration
+		down     bool
+		expected float64
+	}{
+		{0, false, 0},
+		{10 * time.Second, true, 1},
+		{20 * time.Second, true, 1},
+		{30 * time.Second, false, 2},
+		{40 * time.Second, true, 3},
+		{75 * time.Second, true, 2},  // the change at 10s left the window
+		{200 * time.Second, true, 0}, // all changes left the window
+	} {
+		clock = start.Add(tc.offset)
+		env.Set("down", tc.down)
+		if result, err := env.Run(c); err != nil || result != tc.expected {
+			t.Errorf("%d: expected %v but got %v (%v)", i, tc.expected, result, err)
+		}
+	}
+
+	for _, s := range []string{`flapCount("x", 1, 60)`, `flapCount("x", true, "y")`, `flapCount("x", true)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); !math.IsNaN(result.(float64)) {
+			t.Errorf("Expected NaN from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestBackoffDue(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	now = func() time.Time { return clock }
+	defer func() { now = time.Now }()
+
+	c := MustCompile(`backoffDue("disk", 60, 2, 300)`)
+	env := NewEnvironment()
+	var due []int
+	for minute := 0; minute <= 20; minute++ {
+		clock = start.Add(time.Duration(minute) * time.Minute)
+		if result, err := env.Run(c); err != nil {
+			t.Fatal(err)
+		} else if result == true {
+			due = append(due, minute)
+		}
+	}
+	// delays of 1, 2, 4 and then 5 minutes
+	if expected := []int{0, 1, 3, 7, 12, 17}; !reflect.DeepEqual(due, expected) {
+		t.Errorf("expected attempts at %v but got %v", expected, due)
+	}
+
+	for _, s := range []string{`backoffDue("x", 0, 2, 60)`, `backoffDue("x", 60, 0.5, 600)`,
+		`backoffDue("x", 60, 2, 30)`, `backoffDue("x", 60, 2)`} {
+		e := New(s)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != false {
+			t.Errorf("Expected false from %s but got %v", s, result)
+		}
+	}
+}
+
+func TestChanged(t *testing.T) {
+	c := MustCompile(`changed("status", status)`)
+	p := MustCompile(`previous("status")`)
+	env := NewEnvironment()
+	if result, _ := env.Run(p); !math.IsNaN(result.(float64)) {
+		t.Errorf("expected NaN without a previous value but got %v", result)
+	}
+	for i, tc := range []struct {
+		status   interface{}
+		changed  bool
+		previous interface{}
+	}{
+		{1, false, nil},
+		{1.0, false, 1},
+		{2, true, 1.0},
+		{"down", true, 2},
+		{"down", false, "down"},
+	} {
+		env.Set("status", tc.status)
+		if result, err := env.Run(c); err != nil || result != tc.changed {
+			t.Errorf("%d: expected %v but got %v (%v)", i, tc.changed, result, err)
+		}
+		result, _ := env.Run(p)
+		if f, ok := result.(float64); tc.previous == nil && ok && math.IsNaN(f) {
+			continue
+		}
+		if result != tc.previous {
+			t.Errorf("%d: expected previous %v but got %v", i, tc.previous, result)
+		}
+	}
+}
+
+func TestWavg(t *testing.T) {
+	variables := map[string]interface{}{
+		"values":  []float64{10, 20, 40},
+		"weights": []interface{}{1, 2, 1.0},
+		"short":   []int{1, 2},
+	}
+	var tests = map[string]float64{
+		`wavg(10, 1, 20, 3)`:         17.5,
+		`wavg(10, 1, "20", 1)`:       15,
+		`wavg(5, 2)`:                 5,
+		`wavg(values, weights)`:      22.5,
+		`wavg(short, short)`:         5.0 / 3,
+		`wavg(10, 1, 20)`:            math.NaN(),
+		`wavg(10, 0, 20, 0)`:         math.NaN(),
+		`wavg(10, 1, "x", 1)`:        math.NaN(),
+		`wavg(values, short)`:        math.NaN(),
+		`wavg(values, weights, 1.0)`: math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || (math.IsNaN(expected) != math.IsNaN(result)) || (!math.IsNaN(expected) && math.Abs(result-expected) > 1e-9) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	var ok = map[string]interface{}{
+		`setVal("a",10); val("a")*2`:            20,
+		`setVal("a",10);setVal("b",a+1);a*b`:    110,
+		`sprintf("%s;%d", "x", 1); 2`:           2,
+		`substr("a;b", 1, 1)`:                   ";",
+		`1; 2;`:                                 2,
+		"setVal(\"x\", 1.5)\n; x +\n 1":         2.5,
+		`let("v", 1, v + 1); isNaN(val("v"))`:   true,
+		`ifExpr(1 > 0, "yes", "no") ; ;`:        "yes",
+		`setVal("s", "a"); sprintf("%s!", s)`:   "a!",
+		`setVal("n", 2); setVal("n", n*n); n*n`: 16,
+	}
+	for s, expected := range ok {
+		e := New(s)
+		if err := e.ParseExpr(); err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if result := e.Run(); result != expected {
+			t.Errorf("Expected %v from %s as output but got %v", expected, s, result)
+		}
+	}
+
+	for _, s := range []string{`1; 2 +`, `; ;`, `(1; 2)`, `1 2; 3`} {
+		if err := New(s).ParseExpr(); err == nil {
+			t.Errorf("%s should lead to an error", s)
+		}
+	}
+
+	// positions are those of the input
+	errs := New(`setVal("a", 1);` + "\n" + `a; sprintf("%d")`).Validate()
+	if len(errs) != 1 || errs[0].Error() != "2:4: sprintf: missing argument for %d" {
+		t.Errorf("expected an error at 2:4 but got %v", errs)
+	}
+	c := MustCompile(`setVal("a", b); setVal("c", a + d)`)
+	if r, w := c.Reads(), c.Writes(); !reflect.DeepEqual(r, []string{"a", "b", "d"}) || !reflect.DeepEqual(w, []string{"a", "c"}) {
+		t.Errorf("expected reads [a b d] and writes [a c] but got %v %v", r, w)
+	}
+}
+
+func TestPctChange(t *testing.T) {
+	var tests = map[string]float64{
+		`pctChange(100, 120)`:        20,
+		`pctChange(200, 150)`:        -25,
+		`pctChange(-100, -50)`:       50,
+		`pctChange("50", 100)`:       100,
+		`pctChange(0, 0)`:            0,
+		`pctChange(0, 5)`:            math.NaN(),
+		`pctChange(0, 5, 0)`:         0,
+		`pctChange(x, 5, -1)`:        -1,
+		`pctChange(10, "x")`:         math.NaN(),
+		`pctChange(10, pow(10,400))`: math.NaN(),
+		`pctChange(10)`:              math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input)
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || math.IsNaN(expected) != math.IsNaN(result) || (!math.IsNaN(expected) && result != expected) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	var tests = map[string]float64{
+		`normalize(50, 0, 100)`:   0.5,
+		`normalize(150, 0, 100)`:  1,
+		`normalize(-5, 0, 100)`:   0,
+		`normalize(0.05, 0.2, 0)`: 0.75,
+		`normalize("5", 0, 10)`:   0.5,
+		`normalize(5, 10, 10)`:    math.NaN(),
+		`normalize("x", 0, 10)`:   math.NaN(),
+		`normalize(5, 0)`:         math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input)
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || math.IsNaN(expected) != math.IsNaN(result) || (!math.IsNaN(expected) && math.Abs(result-expected) > 1e-12) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	variables := map[string]interface{}{"up": 100.0, "slow": 40.0, "missing": math.NaN()}
+	for _, tc := range []struct {
+		input                 string
+		propagate, skip, zero float64
+	}{
+		{`score(1, up, 1, slow)`, 70, 70, 70},
+		{`score(3, up, 1, slow)`, 85, 85, 85},
+		{`score(1, 150, 1, -20)`, 50, 50, 50},
+		{`score(1, up, 1, missing)`, math.NaN(), 100, 50},
+		{`score(1, missing)`, math.NaN(), math.NaN(), 0},
+		{`score(0, up, 0, slow)`, math.NaN(), math.NaN(), math.NaN()},
+		{`score(-1, up, 2, slow)`, math.NaN(), math.NaN(), math.NaN()},
+		{`score(1, up, 1)`, math.NaN(), math.NaN(), math.NaN()},
+	} {
+		for policy, expected := range map[NaNPolicy]float64{NaNPropagate: tc.propagate, NaNSkip: tc.skip, NaNZero: tc.zero} {
+			result, _ := New(tc.input).Variables(variables).NaNPolicy(policy).RunErr()
+			f, ok := result.(float64)
+			if !ok || math.IsNaN(expected) != math.IsNaN(f) || (!math.IsNaN(expected) && f != expected) {
+				t.Errorf("%s with policy %d: expected %v but got %v", tc.input, policy, expected, result)
+			}
+		}
+	}
+
+	env := NewEnvironment().NaNPolicy(NaNSkip).Set("a", 80.0).Set("b", math.NaN())
+	if result, _ := env.Run(MustCompile(`score(1, a, 1, b)`)); result != 80.0 {
+		t.Errorf("expected 80 with the policy of the Environment but got %v", result)
+	}
+}
+
+func TestDewPointHeatIndex(t *testing.T) {
+	var tests = map[string]float64{
+		`round(dewPoint(20, 50), 2)`:          9.26,
+		`round(dewPoint(-10, 80), 2)`:         -12.8,
+		`dewPoint(25, 100)`:                   25,
+		`round(weather.heatIndex(32, 70), 1)`: 40.4,
+		`round(heatIndex(20, 50), 1)`:         19.4,
+		`round(heatIndex(40, 10), 1)`:         36.7,
+		`round(heatIndex(29, 90), 1)`:         37.2,
+		`dewPoint(20, 0)`:                     math.NaN(),
+		`dewPoint(20, 101)`:                   math.NaN(),
+		`heatIndex("x", 50)`:                  math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input)
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || math.IsNaN(expected) != math.IsNaN(result) || (!math.IsNaN(expected) && math.Abs(result-expected) > 1e-9) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestLazyEvaluation(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected interface{}
+		set      bool // whether setVal("hit", ...) was run
+	}{
+		{`ifExpr(true, 1, setVal("hit", 2))`, 1, false},
+		{`ifExpr(false, setVal("hit", 1), 2)`, 2, false},
+		{`ifExpr(false, 1, setVal("hit", 2))`, FloatError, true},
+		{`false && setVal("hit", true)`, false, false},
+		{`true || setVal("hit", true)`, true, false},
+		{`true && isNaN(setVal("hit", 1))`, true, true},
+		{`false || true`, true, false},
+		{`true && 1`, FloatError, false},
+	} {
+		variables := map[string]interface{}{}
+		e := New(tc.input).Variables(variables)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, ok := tc.expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", tc.input, result)
+			}
+		} else if result != tc.expected {
+			t.Errorf("%s: expected %v but got %v", tc.input, tc.expected, result)
+		}
+		if _, set := variables["hit"]; set != tc.set {
+			t.Errorf("%s: setVal() run %v, expected %v", tc.input, set, tc.set)
+		}
+	}
+}
+
+func TestBarometric(t *testing.T) {
+	var tests = map[string]float64{
+		`round(altitudeFromPressure(900), 1)`:                             988.6,
+		`altitudeFromPressure(1013.25)`:                                   0,
+		`round(weather.altitude(950, 1020), 1)`:                           595.7,
+		`round(seaLevelPressure(950, 540), 1)`:                            1013.2,
+		`seaLevelPressure(1013.25, 0)`:                                    1013.25,
+		`round(altitudeFromPressure(950, seaLevelPressure(950, 540)), 6)`: 540,
+		`altitudeFromPressure(0)`:                                         math.NaN(),
+		`altitudeFromPressure(900, -1)`:                                   math.NaN(),
+		`altitudeFromPressure("x")`:                                       math.NaN(),
+		`seaLevelPressure(950, 44330)`:                                    math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input)
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || math.IsNaN(expected) != math.IsNaN(result) || (!math.IsNaN(expected) && math.Abs(result-expected) > 1e-9) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestRemainder(t *testing.T) {
+	variables := map[string]interface{}{"n": 10, "x": 7.5, "big": uint64(math.MaxUint64)}
+	var tests = map[string]interface{}{
+		`big % 10`:       5,
+		`big % -10`:      5,
+		`big % big`:      0,
+		`-7 % big`:       -7,
+		`big % 0`:        FloatError,
+		`mod(big, 10)`:   5,
+		`7 % 2`:          1,
+		`-7 % 2`:         -1,
+		`n % 3`:          1,
+		`n % 2 == 0`:     true,
+		`x % 2`:          1.5,
+		`7 % 2.5`:        2.0,
+		`x % 2.5`:        0.0,
+		`-x % 2`:         -1.5,
+		`2 + 7 % 4 * 2`:  8,
+		`mod(7, 2)`:      1,
+		`math.mod(x, 2)`: 1.5,
+		`mod(n, 4) == 2`: true,
+		`7 % 0`:          FloatError,
+		`x % 0`:          FloatError,
+		`"7" % 2`:        FloatError,
+		`mod(7, "a")`:    FloatError,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+
+	// the numeric fast path returns the same results
+	c := MustCompile(`x % 2 + 1`)
+	if result := c.Eval(map[string]interface{}{"x": 7.5}); result != 2.5 {
+		t.Errorf("expected 2.5 but got %v", result)
+	}
+}
+
+func TestWindChillApparentTemp(t *testing.T) {
+	var tests = map[string]float64{
+		`round(windChill(-10, 30), 1)`:               -19.5,
+		`round(weather.windChill(0, 20), 1)`:         -5.2,
+		`windChill(15, 30)`:                          15,
+		`windChill(-5, 3)`:                           -5,
+		`round(apparentTemp(30, 60, 10), 1)`:         32.4,
+		`round(weather.apparentTemp(-5, 80, 20), 1)`: -11.8,
+		`round(apparentTemp(20, 50, 0), 1)`:          19.8,
+		`windChill(-5, -1)`:                          math.NaN(),
+		`windChill("x", 10)`:                         math.NaN(),
+		`apparentTemp(20, 101, 10)`:                  math.NaN(),
+		`apparentTemp(20, 50, -1)`:                   math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input)
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || math.IsNaN(expected) != math.IsNaN(result) || (!math.IsNaN(expected) && math.Abs(result-expected) > 1e-9) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestNot(t *testing.T) {
+	variables := map[string]interface{}{"up": true, "n": 1}
+	var tests = map[string]interface{}{
+		`!true`:                     false,
+		`!up`:                       false,
+		`!!up`:                      true,
+		`!regexpMatch("^a","abc")`:  false,
+		`!(1 > 2)`:                  true,
+		`!isNaN(n) && n > 0`:        true,
+		`!up || n == 1`:             true,
+		`not(up)`:                   false,
+		`not(1 > 2)`:                true,
+		`ifExpr(!up, "down", "up")`: "up",
+		`!n`:                        FloatError,
+		`!"a"`:                      FloatError,
+		`not(1)`:                    FloatError,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestTariff(t *testing.T) {
+	const bands = "0-1000:0.25,1000+:0.30"
+	var tests = map[string]float64{
+		`tariff(1500, "` + bands + `")`:                       400,
+		`tariff(800, "` + bands + `")`:                        200,
+		`tariff(1000, "` + bands + `")`:                       250,
+		`tariff(0, "` + bands + `")`:                          0,
+		`tariff(kwh, "0-500:0.2, 500-2000:0.25, 2000+:0.28")`: 100 + 375 + 140,
+		`tariff("1500", "` + bands + `")`:                     400,
+		`tariff(1500, "0-1000:0.25")`:                         math.NaN(),
+		`tariff(500, "0-100:0.25,200+:0.30")`:                 math.NaN(),
+		`tariff(500, "0-600:0.25,100+:0.30")`:                 math.NaN(),
+		`tariff(-1, "` + bands + `")`:                         math.NaN(),
+		`tariff(1, "0-1000")`:                                 math.NaN(),
+		`tariff(1, "0-1000:x")`:                               math.NaN(),
+		`tariff(1, "1000-0:0.25")`:                            math.NaN(),
+		`tariff(1, "")`:                                       math.NaN(),
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(map[string]interface{}{"kwh": 2500.0})
+		_ = e.ParseExpr()
+		result, ok := e.Run().(float64)
+		if !ok || math.IsNaN(expected) != math.IsNaN(result) || (!math.IsNaN(expected) && math.Abs(result-expected) > 1e-9) {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	var tests = map[string]interface{}{
+		"regexpMatch(`^\\d+\\.\\d+$`, \"1.5\")": true,
+		`regexpMatch("^\\d+\\.\\d+$", "1.5")`:   true,
+		`regexpMatch("^\d+$", "15")`:            true, // unknown escapes are kept
+		`regexpMatch("\\.", "a.b")`:             true,
+		`regexpMatch("\\.", "ab")`:              false,
+		"`a\\tb`":                               `a\tb`,
+		`"a\tb"`:                                "a\tb",
+		`"say \"hi\" now"`:                      `say "hi" now`,
+		"`say \"hi\" now`":                      `say "hi" now`,
+		`"\u00e4\x41"`:                          "äA",
+		"wordCount(`a b c`)":                    3,
+		"`a` == \"a\"":                          true,
+		`"a\d" == "a\\d"`:                       true,
+	}
+	for input, expected := range tests {
+		// unknown escapes are no parser errors
+		if result, err := New(input).RunErr(); result != expected || err != nil {
+			t.Errorf("%s: expected %q but got %q, %v", input, expected, result, err)
+		}
+	}
+	if errs := New(`regexpMatch("^\d+$", s)`).Validate(); len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if _, err := New(`"\x4G"`).RunErr(); err == nil {
+		t.Errorf("expected an error of an invalid escape")
+	}
+}
+
+func TestInt64(t *testing.T) {
+	variables := map[string]interface{}{
+		"i64": int64(1700000000),
+		"u64": uint64(42),
+		"big": uint64(math.MaxUint64),
+	}
+	var tests = map[string]interface{}{
+		`i64 + 60`:         1700000060,
+		`i64 - 1700000000`: 0,
+		`u64 * 2`:          84,
+		`u64 / 4`:          10.5,
+		`u64 % 5`:          2,
+		`i64 + 0.5`:        1700000000.5,
+		`-i64`:             -1700000000,
+		`big > 1e19`:       true,
+		`sqrt(u64 - 33)`:   3.0,
+		`time("now","epoch") - time("now","epoch") <= 1`: true,
+		`time("now","epoch") + 0 > 1700000000`:           true,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	variables := map[string]interface{}{"quoted": `"ok"`}
+	var tests = map[string]interface{}{
+		`"\"ok\""`:                       `"ok"`,
+		`"\"ok\"" == quoted`:             true,
+		`quoted`:                         `"ok"`,
+		`val("quoted")`:                  `"ok"`,
+		`ifExpr(true, quoted, "")`:       `"ok"`,
+		`lineCount("line1\nline2")`:      2,
+		`wordCount("a\tb\nc")`:           3,
+		`substr("\u00e4bc", 0, 2)`:       "ä",
+		`sprintf("%q", "a\"b")`:          `"a\"b"`,
+		`setVal("s", "x\ny"); s`:         "x\ny",
+		`kvGet("a=\"1\";b=2", "a")`:      `"1"`,
+		`ellipsis("\"quoted text\"", 4)`: `"qu…`,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != expected {
+			t.Errorf("%s: expected %q but got %q", input, expected, result)
+		}
+	}
+}
+
+func TestInt64Comparisons(t *testing.T) {
+	variables := map[string]interface{}{
+		"epoch": int64(1700000000),
+		"limit": int64(1700000060),
+		"count": uint64(3),
+	}
+	var tests = map[string]bool{
+		`epoch < limit`:                                     true,
+		`epoch > 1699999999`:                                true,
+		`1699999999.5 < epoch`:                              true,
+		`epoch <= 1700000000`:                               true,
+		`epoch >= 1700000000.0`:                             true,
+		`epoch == 1700000000`:                               true,
+		`epoch != limit`:                                    true,
+		`count == 3`:                                        true,
+		`count < epoch`:                                     true,
+		`val("epoch") == epoch`:                             true,
+		`limit - epoch == 60`:                               true,
+		`time("now","epoch") > 1700000000`:                  true,
+		`time("now","epoch") >= epoch`:                      true,
+		`time("now","epoch") == 0`:                          false,
+		`time("now","epoch") != 0`:                          true,
+		`time("now","epoch") < 1700000000`:                  false,
+		`time("now","epoch") <= 1700000000`:                 false,
+		`isBetween(time("now","epoch"), epoch, 9999999999)`: true,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != expected {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+		// compiled expressions with int64 variables use the interpreter
+		if result := MustCompile(input).Eval(variables); result != expected {
+			t.Errorf("%s: expected %v but got %v when compiled", input, expected, result)
+		}
+	}
+}
+
+func TestIntLiterals(t *testing.T) {
+	var tests = map[string]interface{}{
+		`0xFF`:               255,
+		`0XfF`:               255,
+		`0o17`:               15,
+		`017`:                15,
+		`0b1010`:             10,
+		`1_000_000`:          1000000,
+		`0xFF & 0x0F`:        15,
+		`0b1010 | 0b0101`:    15,
+		`status & 0x04 == 4`: true,
+		`0x10 * 1.5`:         24.0,
+		`1_000.5`:            1000.5,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(map[string]interface{}{"status": 0x0C})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+
+	// the numeric fast path reads the same literals
+	if result := MustCompile(`x * 0x10`).Eval(map[string]interface{}{"x": 0.5}); result != 8.0 {
+		t.Errorf("expected 8 but got %v", result)
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	var ok = map[string]interface{}{
+		`a = 10; b = a * 2; b`:                    20,
+		`a=1;a=a+1;a`:                             2,
+		`s = "x" ; sprintf("%s!", s)`:             "x!",
+		`up = 1 > 0; !up`:                         false,
+		`a = 2; a == 2`:                           true,
+		"n = 3\n; m = n *\n 2; m":                 6,
+		`t = time("now","epoch"); t > 1700000000`: true,
+		`a = 1; ifExpr(a == 1, "one", "other")`:   "one",
+	}
+	for s, expected := range ok {
+		e := New(s)
+		if err := e.ParseExpr(); err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if result := e.Run(); result != expected {
+			t.Errorf("Expected %v from %s as output but got %v", expected, s, result)
+		}
+	}
+
+	for _, s := range []string{`a = `, `a = 1 +; a`, `1 = a`, `a.b = 1`, `a = b = 1`} {
+		if err := New(s).ParseExpr(); err == nil {
+			t.Errorf("%s should lead to an error", s)
+		}
+	}
+
+	// assignments write into the variables like setVal
+	variables := map[string]interface{}{"x": 2}
+	e := New(`y = x * 3`).Variables(variables)
+	_ = e.ParseExpr()
+	e.Run()
+	if variables["y"] != 6 {
+		t.Errorf("expected y = 6 but got %v", variables["y"])
+	}
+	c := MustCompile(`a = b; c = a + d`)
+	if r, w := c.Reads(), c.Writes(); !reflect.DeepEqual(r, []string{"a", "b", "d"}) || !reflect.DeepEqual(w, []string{"a", "c"}) {
+		t.Errorf("expected reads [a b d] and writes [a c] but got %v %v", r, w)
+	}
+	errs := New(`a = 1;` + "\n" + `b = sqrt("x")`).Validate()
+	if len(errs) != 1 || errs[0].Error() != "2:10: sqrt: argument 1 is no number" {
+		t.Errorf("expected an error at 2:10 but got %v", errs)
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	variables := map[string]interface{}{"errors": 2, "load": 0.0, "nan": math.NaN()}
+	var tests = map[string]interface{}{
+		`ifExpr(errors, "failed", "ok")`: "failed",
+		`ifExpr(load, "busy", "idle")`:   "idle",
+		`errors && load`:                 false,
+		`errors || load`:                 true,
+		`!errors`:                        false,
+		`!load`:                          true,
+		`not(0)`:                         true,
+		`errors && 1 > 0`:                true,
+		`ifExpr(nan, 1, 2)`:              FloatError,
+		`"a" && true`:                    FloatError,
+	}
+	check := func(input string, expected, result interface{}) {
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables).Truthy(true)
+		_ = e.ParseExpr()
+		check(input, expected, e.Run())
+
+		c, _ := New(input).Truthy(true).Compile()
+		check(input, expected, c.Eval(variables))
+
+		env := NewEnvironment().Truthy(true)
+		for k, v := range variables {
+			env.Set(k, v)
+		}
+		result, _ := env.Run(MustCompile(input))
+		check(input, expected, result)
+
+		// numbers are no conditions by default
+		if _, isBool := tests[input].(bool); isBool {
+			e := New(input).Variables(variables)
+			_ = e.ParseExpr()
+			check(input, FloatError, e.Run())
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	variables := map[string]interface{}{
+		"offline": math.NaN(),
+		"empty":   "",
+		"temp":    21.5,
+		"name":    "srv1",
+		"zero":    0,
+	}
+	var tests = map[string]interface{}{
+		`coalesce(offline, temp, 20)`:      21.5,
+		`coalesce(unknown, offline, 20)`:   20,
+		`coalesce(empty, name)`:            "srv1",
+		`coalesce(zero, 1)`:                0,
+		`coalesce(false, true)`:            false,
+		`coalesce(sqrt(-1), "", "x")`:      "x",
+		`coalesce(temp, setVal("hit", 1))`: 21.5,
+		`coalesce(unknown, offline)`:       FloatError,
+		`valOr("temp", 20)`:                21.5,
+		`valOr("unknown", 20)`:             20,
+		`valOr("offline", "n/a")`:          "n/a",
+		`valOr("empty", name)`:             "srv1",
+		`valOr("zero", 1)`:                 0,
+		`valOr("temp", setVal("hit", 1))`:  21.5,
+	}
+	for input, expected := range tests {
+		vars := make(map[string]interface{}, len(variables))
+		for k, v := range variables {
+			vars[k] = v
+		}
+		result, err := New(input).Variables(vars).Strict(true).RunErr()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+		}
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+		if _, ok := vars["hit"]; ok {
+			t.Errorf("%s: the default was evaluated", input)
+		}
+	}
+
+	if r := New(`valOr("a", b) + coalesce(c, 1)`).ListVariables(); !reflect.DeepEqual(r, []string{"a", "b", "c"}) {
+		t.Errorf("expected variables [a b c] but got %v", r)
+	}
+}
+
+func TestSpread(t *testing.T) {
+	variables := map[string]interface{}{
+		"samples": []float64{3, 7.5, 1},
+		"ints":    []int{4, 2},
+		"mixed":   []interface{}{1, "2", 3.5},
+		"words":   []string{"a", "b"},
+		"empty":   []float64{},
+		"x":       1.0,
+	}
+	var tests = map[string]interface{}{
+		`max(samples...)`:            7.5,
+		`min(samples...)`:            1.0,
+		`avg(ints...)`:               3.0,
+		`max(10, samples...)`:        10.0,
+		`max(mixed...)`:              3.5,
+		`round(avg(mixed...), 1)`:    2.2,
+		`sprintf("%s-%s", words...)`: "a-b",
+		`coalesce(words...)`:         "a",
+		`max(empty...)`:              FloatError,
+		`max(x...)`:                  FloatError,
+		`math.max(samples...) > 5`:   true,
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+
+	if _, err := New(`max(x...)`).Variables(variables).RunErr(); err == nil {
+		t.Error("expected an error for spreading a number")
+	}
+	if errs := New(`sqrt(samples...) + substr(words...)`).Validate(); len(errs) != 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	// functions registered in Go get the elements
+	env := NewEnvironment().Set("samples", []float64{1, 2})
+	env.Function("count", func(args ...interface{}) (interface{}, error) {
+		return len(args), nil
+	})
+	if result, err := env.Run(MustCompile(`count(0, samples...)`)); err != nil || result != 3 {
+		t.Errorf("expected 3 but got %v (%v)", result, err)
+	}
+}
+
+func TestSwitchExpr(t *testing.T) {
+	variables := map[string]interface{}{"severity": 2, "load": 60.0, "state": "down"}
+	var tests = map[string]interface{}{
+		`switchExpr(severity, 1, "info", 2, "warning", 3, "critical", "unknown")`: "warning",
+		`switchExpr(7, 1, "info", 2, "warning", "unknown")`:                       "unknown",
+		`switchExpr(2.0, 1, "info", 2, "warning")`:                                "warning",
+		`switchExpr(state, "up", 1, "down", 0)`:                                   0,
+		`switchExpr(true, load > 90, "high", load > 50, "medium", "low")`:         "medium",
+		`switchExpr(1, 1, 10, 1, setVal("hit", 1))`:                               10,
+		`switchExpr(3, 1, setVal("hit", 1), 3, 30, setVal("hit", 2))`:             30,
+		`switchExpr("2", 2, "number", "2", "string")`:                             "string",
+		`switchExpr(7, 1, "info", 2, "warning")`:                                  FloatError,
+	}
+	for input, expected := range tests {
+		vars := map[string]interface{}{}
+		for k, v := range variables {
+			vars[k] = v
+		}
+		e := New(input).Variables(vars)
+		_ = e.ParseExpr()
+		result := e.Run()
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v but got %v", input, expected, result)
+		}
+		if _, ok := vars["hit"]; ok {
+			t.Errorf("%s: a result not selected was evaluated", input)
+		}
+	}
+}
+
+func TestExists(t *testing.T) {
+	variables := map[string]interface{}{"empty": "", "offline": math.NaN(), "temp": 21.5}
+	for input, expected := range map[string]bool{
+		`exists("temp")`:                        true,
+		`exists("empty")`:                       true,
+		`exists("offline")`:                     true,
+		`exists("unknown")`:                     false,
+		`exists(1)`:                             false,
+		`setVal("x", 1); exists("x")`:           true,
+		`exists("empty") && val("empty") == ""`: true,
+	} {
+		result, err := New(input).Variables(variables).Strict(true).RunErr()
+		if err != nil || result != expected {
+			t.Errorf("%s: expected %v but got %v, %v", input, expected, result, err)
+		}
+	}
+
+	env := NewEnvironment().Provider(ProviderFunc(func(name string) (interface{}, bool) {
+		return 1, name == "provided"
+	}))
+	if r, _ := env.Run(MustCompile(`exists("provided") && !exists("other")`)); r != true {
+		t.Errorf("expected true but got %v", r)
+	}
+
+	for _, tc := range []struct {
+		policy   MissingPolicy
+		expected interface{}
+		err      error
+	}{
+		{MissingEmpty, "", nil},
+		{MissingNaN, FloatError, nil},
+		{MissingError, FloatError, ErrUndefinedVariable},
+	} {
+		result, err := New(`val("unknown")`).MissingPolicy(tc.policy).RunErr()
+		if f, ok := tc.expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%d: expected NaN but got %v", tc.policy, result)
+			}
+		} else if result != tc.expected {
+			t.Errorf("%d: expected %v but got %v", tc.policy, tc.expected, result)
+		}
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d: expected error %v but got %v", tc.policy, tc.err, err)
+		}
+		// present variables are not affected
+		if r, _ := New(`val("empty")`).Variables(variables).MissingPolicy(tc.policy).RunErr(); r != "" {
+			t.Errorf("%d: expected an empty string but got %v", tc.policy, r)
+		}
+	}
+
+	c, _ := New(`val("unknown")`).MissingPolicy(MissingError).Compile()
+	if _, err := c.Run(nil); !errors.Is(err, ErrUndefinedVariable) {
+		t.Errorf("expected undefined variable but got %v", err)
+	}
+	env = NewEnvironment().MissingPolicy(MissingNaN)
+	if r, _ := env.Run(MustCompile(`isNaN(val("unknown"))`)); r != true {
+		t.Errorf("expected true but got %v", r)
+	}
+	if r := New(`exists("a") && b`).ListVariables(); !reflect.DeepEqual(r, []string{"a", "b"}) {
+		t.Errorf("unexpected variables %v", r)
+	}
+}
+
+func TestIndex(t *testing.T) {
+	variables := map[string]interface{}{
+		"samples": []float64{1.5, 2.5, 4},
+		"hosts":   []interface{}{"srv1", "srv2", 3},
+		"counts":  []int{7, 8},
+		"empty":   []float64{},
+		"i":       1.0,
+		"name":    "Grüße",
+	}
+	var tests = map[string]interface{}{
+		`samples[0]`:                          1.5,
+		`samples[len(samples)-1]`:             4.0,
+		`samples[i] * 2`:                      5.0,
+		`samples[0] + samples[1]`:             4.0,
+		`hosts[1]`:                            "srv2",
+		`hosts[2] + 1`:                        4,
+		`counts[1]`:                           8,
+		`len(samples)`:                        3,
+		`len(empty)`:                          0,
+		`len(name)`:                           5,
+		`len("")`:                             0,
+		`ifExpr(len(empty) > 0, empty[0], 0)`: 0,
+		`avg(samples...) == (samples[0] + samples[1] + samples[2]) / 3`: true,
+		`s = samples; len(s)`:       3,
+		`s = samples; s[2] * 2`:     8.0,
+		`s = samples; max(s...)`:    4.0,
+		`let("s", samples, len(s))`: 3,
+		`let("h", hosts, h[0])`:     "srv1",
+		`setVal("a", counts); a[1]`: 8,
+		`samples[3]`:                FloatError,
+		`samples[-1]`:               FloatError,
+		`samples[0.5]`:              FloatError,
+		`samples["a"]`:              FloatError,
+		`name[0]`:                   FloatError,
+		`len(1)`:                    FloatError,
+		`samples + 1`:               FloatError,
+	}
+	for input, expected := range tests {
+		result, err := New(input).Variables(variables).RunErr()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+		}
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+
+	if _, err := New(`unknown[0]`).Strict(true).RunErr(); !errors.Is(err, ErrUndefinedVariable) {
+		t.Errorf("expected undefined variable but got %v", err)
+	}
+	if r := New(`samples[i] + len(hosts)`).ListVariables(); !reflect.DeepEqual(r, []string{"hosts", "i", "samples"}) {
+		t.Errorf("unexpected variables %v", r)
+	}
+	c := MustCompile(`samples[0] * 2`)
+	if r, err := c.Run(variables); err != nil || r != 3.0 {
+		t.Errorf("expected 3 but got %v, %v", r, err)
+	}
+}
+
+func TestNestedMaps(t *testing.T) {
+	variables := map[string]interface{}{
+		"sensor": map[string]interface{}{
+			"temp":     map[string]interface{}{"value": 21.5, "unit": "°C"},
+			"readings": []interface{}{map[string]interface{}{"value": 1}, map[string]interface{}{"value": 2}},
+			"name":     "",
+		},
+		"limits": map[string]float64{"high": 30},
+		"$SYS/b": map[string]interface{}{"x": 1},
+		"$SYS/c": 3,
+	}
+	var tests = map[string]interface{}{
+		`val("sensor/temp/value")`:                         21.5,
+		`val("sensor/temp/unit")`:                          "°C",
+		`val("sensor/readings/1/value")`:                   2,
+		`val("limits/high")`:                               30.0,
+		`val("$SYS/b/x")`:                                  1,
+		`val("$SYS/c")`:                                    3,
+		`sensor.temp.value`:                                21.5,
+		`sensor.temp.value < limits.high`:                  true,
+		`sensor["temp"]["unit"]`:                           "°C",
+		`sensor.readings[0].value + 1`:                     2,
+		`len(sensor.readings)`:                             2,
+		`exists("sensor/name") && !exists("sensor/other")`: true,
+		`valOr("sensor/temp/other", 0)`:                    0,
+		`val("sensor/temp/value/x")`:                       "",
+		`val("sensor/readings/2/value")`:                   "",
+		`sensor.other`:                                     FloatError,
+		`sensor.temp.value.x`:                              FloatError,
+		`sensor[0]`:                                        FloatError,
+	}
+	for input, expected := range tests {
+		result, err := New(input).Variables(variables).RunErr()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+		}
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+
+	for _, input := range []string{`sensor.temp.other`, `val("sensor/other")`} {
+		_, err := New(input).Variables(variables).Strict(true).RunErr()
+		if !errors.Is(err, ErrUndefinedVariable) {
+			t.Errorf("%s: expected undefined variable but got %v", input, err)
+		}
+	}
+	if errs := New(`sensor.temp.value > 20 && math.sqrt(4) == 2`).Validate(); len(errs) > 0 {
+		t.Errorf("unexpected errors %v", errs)
+	}
+	if r := New(`sensor.temp.value > limits["high"]`).ListVariables(); !reflect.DeepEqual(r, []string{"limits", "sensor"}) {
+		t.Errorf("unexpected variables %v", r)
+	}
+	env := NewEnvironment().Provider(ProviderFunc(func(name string) (interface{}, bool) {
+		return variables[name], name == "sensor"
+	}))
+	if r, err := env.Run(MustCompile(`val("sensor/temp/value") == sensor.temp.value`)); err != nil || r != true {
+		t.Errorf("expected true but got %v, %v", r, err)
+	}
+}
+
+func TestSumCount(t *testing.T) {
+	variables := map[string]interface{}{
+		"readings": []float64{1.5, 2.5, 4},
+		"mixed":    []interface{}{1, "2", "n/a", math.NaN()},
+		"counts":   []int32{3, 1, 2},
+		"empty":    []float64{},
+		"sensor":   map[string]interface{}{"readings": []interface{}{10, 20}},
+	}
+	var tests = map[string]interface{}{
+		`sum(1, 2, 3.5)`:                  6.5,
+		`sum(30, "10", "John Doe")`:       40.0,
+		`sum(readings)`:                   8.0,
+		`sum(val("readings"))`:            8.0,
+		`sum(readings, 2)`:                10.0,
+		`sum(readings...)`:                8.0,
+		`sum(empty)`:                      FloatError,
+		`sum("x")`:                        FloatError,
+		`math.sum(counts)`:                6.0,
+		`count(1, 2, "x")`:                2,
+		`count(readings)`:                 3,
+		`count(mixed)`:                    2,
+		`count(empty)`:                    0,
+		`math.count(readings, 1)`:         4,
+		`sum(readings) / count(readings)`: 8.0 / 3,
+		`avg(readings) == sum(readings) / count(readings)`: true,
+		`avg(val("sensor/readings"))`:                      15.0,
+		`max(readings)`:                                    4.0,
+		`min(readings, 1)`:                                 1.0,
+		`max(counts)`:                                      3.0,
+		`setVal("lo", "hi", minMax(readings)); hi - lo`:    2.5,
+		`argMax(counts)`:                                   1,
+		`argMin(readings)`:                                 1,
+		`argMax(2, readings)`:                              4,
+	}
+	for input, expected := range tests {
+		result, err := New(input).Variables(variables).RunErr()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+		}
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+}
+
+func TestAlmostEqual(t *testing.T) {
+	variables := map[string]interface{}{"x": 3.1410000001, "n": 3}
+	for input, expected := range map[string]bool{
+		`almostEqual(0.1+0.2, 0.3, 1e-9)`:   true,
+		`almostEqual(3.1416, 3.141, 1e-3)`:  true,
+		`almostEqual(3.15, 3.141, 1e-3)`:    false,
+		`almostEqual(x, 3.141, 0)`:          false,
+		`almostEqual(n, 3, 0)`:              true,
+		`almostEqual(x, 3.141, -1)`:         false,
+		`almostEqual(y, y, 1)`:              false,
+		`math.almostEqual("2.5", 2.4, 0.2)`: true,
+		`0.1+0.2 == 0.3`:                    false,
+	} {
+		result, err := New(input).Variables(variables).RunErr()
+		if err != nil || result != expected {
+			t.Errorf("%s: expected %v but got %v, %v", input, expected, result, err)
+		}
+	}
+
+	// Epsilon applies to == and != of floats
+	for input, expected := range map[string]bool{
+		`x == 3.141`:     true,
+		`x != 3.141`:     false,
+		`3.141 == x`:     true,
+		`0.1+0.2 == 0.3`: true,
+		`x == 3.142`:     false,
+		`x != 3.142`:     true,
+		`n == 3.0000001`: true,
+		`n == 3`:         true,
+		`n == 4`:         false,
+	} {
+		result, err := New(input).Variables(variables).Epsilon(1e-6).RunErr()
+		if err != nil || result != expected {
+			t.Errorf("%s: expected %v but got %v, %v", input, expected, result, err)
+		}
+	}
+
+	// Compiled skips its exact numeric fast path with an Epsilon
+	c, _ := New(`x == 3.141`).Epsilon(1e-6).Compile()
+	if r, _ := c.Run(variables); r != true {
+		t.Errorf("expected true but got %v", r)
+	}
+	if r := c.Eval(variables); r != true {
+		t.Errorf("expected true but got %v", r)
+	}
+	if r, _ := MustCompile(`x == 3.141`).Run(variables); r != false {
+		t.Errorf("expected false but got %v", r)
+	}
+	env := NewEnvironment().Set("x", 3.1410000001).Epsilon(1e-6)
+	if r, _ := env.Run(MustCompile(`x == 3.141`)); r != true {
+		t.Errorf("expected true but got %v", r)
+	}
+}
+
 //// register
 //func TestRegister(t *testing.T) {
 //	var ok = map[string]string{
@@ -910,11 +3268,22 @@ func TestIsBetween(t *testing.T) {
 		`isBetween(env("x"),50.5,0)`:                      false,
 		`isBetween(env("y"),0,100)`:                       false,
 		`isBetween(env("x"),val("a"),abs(val("b"))`:       true,
-		`isBetween(time("now",""),0,9999999999)`:          false,
+		`isBetween(time("now",""),0,9999999999)`:          true,
 		`isBetween(float64(time("now","")),0,9999999999)`: true,
 		`isBetween(-0.95,-0.99,-0.90)`:                    true,
 		`isBetween(-0.89,-0.99,-0.90)`:                    false,
 		`isBetween(something,"Wrong",/)`:                  false,
+		`isBetween(1,0,1,"[]")`:                           true,
+		`isBetween(1,0,1,"[)")`:                           false,
+		`isBetween(0,0,1,"[)")`:                           true,
+		`isBetween(0,0,1,"(]")`:                           false,
+		`isBetween(1,0,1,"(]")`:                           true,
+		`isBetween(0.5,0,1,"()")`:                         true,
+		`isBetween(0,0,1,"()")`:                           false,
+		`isBetween(1,1,1,"()")`:                           false,
+		`isBetween(1,0,1,"<>")`:                           false,
+		`isBetween(1,0,1,"[")`:                            false,
+		`isBetween(1,0,1,1)`:                              false,
 	}
 
 	for s, r := range ok {
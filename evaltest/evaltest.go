@@ -0,0 +1,244 @@
+// Package evaltest runs tables of expressions with their variables and
+// expected results as Go subtests, e.g. to regression-test the rules of
+// a team the way the tests of package eval work.
+//
+// A case file is JSON:
+//
+//	{
+//	  "cases": [
+//	    {"expression": "(size-used)/size*100", "variables": {"size": 200, "used": 50}, "expected": 75},
+//	    {"name": "no size", "expression": "used/size", "variables": {"used": 1}, "nan": true},
+//	    {"expression": "rund(1.5, 0)", "error": "unknown function"}
+//	  ]
+//	}
+//
+// and run in a test with
+//
+//	func TestRules(t *testing.T) {
+//		evaltest.RunFile(t, "testdata/rules.json")
+//	}
+//
+// Integral numbers of variables are int like in most Go programs, e.g.
+// "%d" of sprintf() formats them, other numbers are float64.
+//
+// LoadWith reads case files in other formats, e.g. YAML decoded by
+// the Unmarshal function of a YAML package:
+//
+//	cases, err := evaltest.LoadWith("testdata/rules.yaml", yaml.Unmarshal)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	evaltest.Run(t, cases)
+package evaltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/itdesign-at/eval"
+)
+
+// DefaultTolerance is the largest difference of numbers which are
+// still equal when a Case has no Tolerance
+const DefaultTolerance = 1e-9
+
+// Case is an expression with its variables and the expected result
+type Case struct {
+	// Name of the subtest, the expression when empty
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Expression is run with Variables
+	Expression string                 `json:"expression" yaml:"expression"`
+	Variables  map[string]interface{} `json:"variables,omitempty" yaml:"variables,omitempty"`
+	// Expected is the result, numbers are equal regardless of their
+	// type when they differ by Tolerance at most
+	Expected interface{} `json:"expected,omitempty" yaml:"expected,omitempty"`
+	// NaN expects math.NaN() which JSON can't express
+	NaN bool `json:"nan,omitempty" yaml:"nan,omitempty"`
+	// Error expects an error of RunErr containing this text
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Tolerance of numbers, DefaultTolerance when 0
+	Tolerance float64 `json:"tolerance,omitempty" yaml:"tolerance,omitempty"`
+	// Strict runs the expression in strict mode, see eval.Eval.Strict()
+	Strict bool `json:"strict,omitempty" yaml:"strict,omitempty"`
+}
+
+// Load reads the JSON case file path, see Parse()
+func Load(path string) ([]Case, error) {
+	return LoadWith(path, unmarshalJSON)
+}
+
+// LoadWith reads the case file path decoded by unmarshal,
+// see ParseWith()
+func LoadWith(path string, unmarshal func(data []byte, v interface{}) error) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWith(data, unmarshal)
+}
+
+// Parse decodes the cases of a JSON case file
+func Parse(data []byte) ([]Case, error) {
+	return ParseWith(data, unmarshalJSON)
+}
+
+// ParseWith decodes the cases of a case file with unmarshal like
+// the Unmarshal function of a YAML package, the top level key
+// "cases" holds the list of cases
+func ParseWith(data []byte, unmarshal func(data []byte, v interface{}) error) ([]Case, error) {
+	var file struct {
+		Cases []Case `json:"cases" yaml:"cases"`
+	}
+	if err := unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	for i, c := range file.Cases {
+		if c.Expression == "" {
+			return nil, fmt.Errorf("case %d: missing expression", i+1)
+		}
+		for k, v := range c.Variables {
+			c.Variables[k] = plain(v)
+		}
+		file.Cases[i].Expected = plain(c.Expected)
+	}
+	return file.Cases, nil
+}
+
+// unmarshalJSON is json.Unmarshal keeping numbers as json.Number,
+// see plain()
+func unmarshalJSON(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// plain converts the json.Numbers in x to int when they are integral
+// and to float64 otherwise
+func plain(x interface{}) interface{} {
+	switch v := x.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil && i == int64(int(i)) {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = plain(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = plain(v[k])
+		}
+	}
+	return x
+}
+
+// RunFile loads the case file path and runs its cases, see Run()
+func RunFile(t *testing.T, path string) {
+	t.Helper()
+	cases, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Run(t, cases)
+}
+
+// Run runs each case as subtest which fails when Check returns an error
+func Run(t *testing.T, cases []Case) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		name := c.Name
+		if name == "" {
+			name = c.Expression
+		}
+		t.Run(name, func(t *testing.T) {
+			if err := c.Check(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// Check runs the expression of c and returns an error when the result
+// differs from the expected one
+func (c Case) Check() error {
+	variables := make(map[string]interface{}, len(c.Variables))
+	for k, v := range c.Variables {
+		variables[k] = v
+	}
+	result, err := eval.New(c.Expression).Variables(variables).Strict(c.Strict).RunErr()
+	switch {
+	case c.Error != "":
+		if err == nil || !strings.Contains(err.Error(), c.Error) {
+			return fmt.Errorf("%s: expected error %q but got %v", c.Expression, c.Error, err)
+		}
+		return nil
+	case err != nil:
+		return fmt.Errorf("%s: unexpected error %v", c.Expression, err)
+	case c.NaN:
+		if f, ok := result.(float64); !ok || !math.IsNaN(f) {
+			return fmt.Errorf("%s: expected NaN but got %v", c.Expression, result)
+		}
+		return nil
+	}
+	if !c.equal(result) {
+		return fmt.Errorf("%s: expected %v (%T) but got %v (%T)", c.Expression, c.Expected, c.Expected, result, result)
+	}
+	return nil
+}
+
+// equal reports whether result is the expected result of c
+func (c Case) equal(result interface{}) bool {
+	x, ok1 := number(c.Expected)
+	y, ok2 := number(result)
+	if ok1 && ok2 {
+		tolerance := c.Tolerance
+		if tolerance == 0 {
+			tolerance = DefaultTolerance
+		}
+		return x == y || math.Abs(x-y) <= tolerance
+	}
+	if ok1 || ok2 {
+		return false
+	}
+	// e.g. []interface{} of JSON and eval.Values
+	if expected, ok := c.Expected.([]interface{}); ok {
+		if values, ok := result.(eval.Values); ok {
+			result = []interface{}(values)
+		}
+		got, ok := result.([]interface{})
+		if !ok || len(got) != len(expected) {
+			return false
+		}
+		for i := range expected {
+			if !(Case{Expected: expected[i], Tolerance: c.Tolerance}).equal(got[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(c.Expected, result)
+}
+
+// number returns x as float64 when it is a number
+func number(x interface{}) (float64, bool) {
+	switch v := x.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
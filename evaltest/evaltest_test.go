@@ -0,0 +1,105 @@
+package evaltest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const disk = `{
+  "cases": [
+    {"name": "usage", "expression": "(size-used)/size*100", "variables": {"size": 200, "used": 50}, "expected": 75},
+    {"expression": "round(10/3, 2)", "expected": 3.333, "tolerance": 0.01},
+    {"expression": "1 + 2", "expected": 3},
+    {"expression": "sprintf(\"%d of %.1f\", a, b)", "variables": {"a": 7, "b": 2.0}, "expected": "7 of 2.0"},
+    {"expression": "sensor.values[1]", "variables": {"sensor": {"values": [1, 2.5]}}, "expected": 2.5},
+    {"expression": "used/size", "variables": {"used": 1}, "nan": true},
+    {"expression": "state == \"up\"", "variables": {"state": "up"}, "expected": true},
+    {"expression": "substr(\"abc\", 0, 1)", "expected": "a"},
+    {"expression": "minMax(1, 5, 3)", "expected": [1, 5]},
+    {"expression": "missing + 1", "strict": true, "error": "missing"},
+    {"expression": "rund(1.5, 0)", "error": "rund"}
+  ]
+}`
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.json")
+	if err := os.WriteFile(path, []byte(disk), 0600); err != nil {
+		t.Fatal(err)
+	}
+	RunFile(t, path)
+}
+
+// unmarshalLines decodes lines "expression => expected" with
+// expected in JSON to test LoadWith
+func unmarshalLines(data []byte, v interface{}) error {
+	var cases []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		expression, expected, ok := strings.Cut(line, "=>")
+		if !ok {
+			return fmt.Errorf("invalid line %q", line)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(expected), &value); err != nil {
+			return err
+		}
+		cases = append(cases, map[string]interface{}{"expression": strings.TrimSpace(expression), "expected": value})
+	}
+	data, err := json.Marshal(map[string]interface{}{"cases": cases})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func TestLoadWith(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.txt")
+	if err := os.WriteFile(path, []byte("1 + 2 => 3\nsubstr(\"abc\", 0, 1) => \"a\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cases, err := LoadWith(path, unmarshalLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("expected 2 cases but got %v", cases)
+	}
+	Run(t, cases)
+
+	for _, data := range []string{"1 + 2", " => 1"} {
+		if _, err := ParseWith([]byte(data), unmarshalLines); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		c        Case
+		expected string
+	}{
+		{Case{Expression: "1 + 2", Expected: 4.0}, "expected 4"},
+		{Case{Expression: "1 + 2", Expected: "3"}, "expected 3"},
+		{Case{Expression: "10 / 3.0", Expected: 3.33}, "expected 3.33"},
+		{Case{Expression: "1 + 2", NaN: true}, "expected NaN"},
+		{Case{Expression: "1 + 2", Error: "unknown"}, "expected error"},
+		{Case{Expression: "rund(1)", Expected: 1}, "unexpected error"},
+		{Case{Expression: "minMax(1, 5)", Expected: []interface{}{1.0}}, "expected [1]"},
+	} {
+		err := tc.c.Check()
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected error %q but got %v", tc.c.Expression, tc.expected, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, data := range []string{`{"cases": [{"expected": 1}]}`, `{"cases": [`} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
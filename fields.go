@@ -0,0 +1,65 @@
+package eval
+
+import (
+	"reflect"
+	"sync"
+)
+
+// fieldKey identifies a field of a struct type
+type fieldKey struct {
+	t    reflect.Type
+	name string
+}
+
+// fieldIndexes caches the index of exported fields by fieldKey,
+// nil for types without such a field
+var fieldIndexes sync.Map
+
+// structField returns the exported field name of the struct v, also of
+// embedded structs, ok is false when there is no such field
+func structField(v reflect.Value, name string) (interface{}, bool) {
+	key := fieldKey{v.Type(), name}
+	index, cached := fieldIndexes.Load(key)
+	if !cached {
+		var found []int
+		if f, ok := v.Type().FieldByName(name); ok && f.PkgPath == "" {
+			found = f.Index
+		}
+		index, _ = fieldIndexes.LoadOrStore(key, found)
+	}
+	if index.([]int) == nil {
+		return nil, false
+	}
+	// fails for fields of nil pointers to embedded structs
+	field, err := v.FieldByIndexErr(index.([]int))
+	if err != nil || !field.CanInterface() {
+		return nil, false
+	}
+	return plainValue(field), true
+}
+
+// plainValue returns the numbers, strings and bools of v as int, uint64,
+// float64, string or bool, also those of types like int32 or
+// 'type Status int', so that they can be calculated with
+func plainValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(v.Int())
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return int(v.Uint())
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return plainValue(v.Elem())
+	}
+	return v.Interface()
+}
@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+type fieldsTestStatus int
+
+type fieldsTestLocation struct {
+	Site string
+}
+
+type fieldsTestHost struct {
+	*fieldsTestLocation
+	Name    string
+	RttMs   float32
+	Retries int32
+	Status  fieldsTestStatus
+	Up      bool
+	Tags    []string
+	Labels  map[string]string
+	secret  string
+}
+
+func TestStructFields(t *testing.T) {
+	host := fieldsTestHost{
+		fieldsTestLocation: &fieldsTestLocation{Site: "vie"},
+		Name:               "srv1",
+		RttMs:              12.5,
+		Retries:            3,
+		Status:             2,
+		Up:                 true,
+		Tags:               []string{"web", "db"},
+		Labels:             map[string]string{"env": "prod"},
+		secret:             "x",
+	}
+	variables := map[string]interface{}{
+		"host":   host,
+		"ptr":    &host,
+		"hosts":  []fieldsTestHost{host, {Name: "srv2"}},
+		"nilptr": (*fieldsTestHost)(nil),
+	}
+	var tests = map[string]interface{}{
+		`host.Name`:                  "srv1",
+		`host.RttMs * 2`:             25.0,
+		`host.Retries + 1`:           4,
+		`host.Status == 2`:           true,
+		`host.Up && host.RttMs < 50`: true,
+		`host.Site`:                  "vie",
+		`host.Tags[1]`:               "db",
+		`len(host.Tags)`:             2,
+		`host.Labels.env`:            "prod",
+		`ptr.Name`:                   "srv1",
+		`hosts[1].Name`:              "srv2",
+		`val("host/Name")`:           "srv1",
+		`val("hosts/0/Labels/env")`:  "prod",
+		`exists("host/Up")`:          true,
+		`exists("host/secret")`:      false,
+		`host.secret`:                FloatError,
+		`host.Unknown`:               FloatError,
+		`hosts[1].Site`:              FloatError, // nil embedded pointer
+		`nilptr.Name`:                FloatError,
+	}
+	for input, expected := range tests {
+		result, err := New(input).Variables(variables).RunErr()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", input, err)
+		}
+		if f, ok := expected.(float64); ok && math.IsNaN(f) {
+			if r, ok := result.(float64); !ok || !math.IsNaN(r) {
+				t.Errorf("%s: expected NaN but got %v", input, result)
+			}
+		} else if result != expected {
+			t.Errorf("%s: expected %v (%T) but got %v (%T)", input, expected, expected, result, result)
+		}
+	}
+
+	if _, err := New(`host.Nmae`).Variables(variables).Strict(true).RunErr(); !errors.Is(err, ErrUndefinedVariable) {
+		t.Errorf("expected undefined variable but got %v", err)
+	}
+
+	// the index of fields is cached per type
+	key := fieldKey{reflect.TypeOf(host), "Name"}
+	if index, ok := fieldIndexes.Load(key); !ok || !reflect.DeepEqual(index, []int{1}) {
+		t.Errorf("expected cached index [1] but got %v", index)
+	}
+}
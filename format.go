@@ -0,0 +1,109 @@
+package eval
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Format returns the expression src in a canonical layout, e.g. to store
+// rules diff-friendly or to find duplicates by comparing strings:
+//
+//	eval.Format(`round( a*2,1)+ val(  "x")`) // round(a * 2, 1) + val("x")
+//
+// Binary operators are surrounded by single spaces, arguments separated
+// by ", " and statements by "; ". Strings are written in double quotes,
+// those with backslashes or double quotes in back quotes when possible.
+// Parentheses are kept as written. A syntax error of src is returned, also
+// for invalid escapes like "^\d+$" which Run() tolerates.
+func Format(src string) (string, error) {
+	ranges := splitStatements(src)
+	if len(ranges) == 0 {
+		// returns the syntax error of an empty input
+		_, err := parseStatements(src)
+		return "", err
+	}
+	var b strings.Builder
+	for i, r := range ranges {
+		exp, err := parseStatement(src, r)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		if name, _, ok := assignment(src, r); ok {
+			b.WriteString(name + " = ")
+			exp = exp.(*ast.CallExpr).Args[1]
+		}
+		formatExpr(&b, exp)
+	}
+	return b.String(), nil
+}
+
+// formatExpr writes exp in the layout of Format() to b
+func formatExpr(b *strings.Builder, exp ast.Expr) {
+	switch exp := exp.(type) {
+	case *ast.BasicLit:
+		if exp.Kind == token.STRING {
+			b.WriteString(formatString(unquote(exp.Value)))
+			return
+		}
+		b.WriteString(exp.Value)
+	case *ast.Ident:
+		b.WriteString(exp.Name)
+	case *ast.ParenExpr:
+		b.WriteByte('(')
+		formatExpr(b, exp.X)
+		b.WriteByte(')')
+	case *ast.UnaryExpr:
+		b.WriteString(exp.Op.String())
+		// '- -x' must not become '--x'
+		if x, ok := exp.X.(*ast.UnaryExpr); ok && (x.Op == token.ADD || x.Op == token.SUB) {
+			b.WriteByte(' ')
+		}
+		formatExpr(b, exp.X)
+	case *ast.BinaryExpr:
+		formatExpr(b, exp.X)
+		b.WriteString(" " + exp.Op.String() + " ")
+		formatExpr(b, exp.Y)
+	case *ast.CallExpr:
+		formatExpr(b, exp.Fun)
+		b.WriteByte('(')
+		for i, arg := range exp.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			formatExpr(b, arg)
+		}
+		if exp.Ellipsis.IsValid() {
+			b.WriteString("...")
+		}
+		b.WriteByte(')')
+	case *ast.SelectorExpr:
+		formatExpr(b, exp.X)
+		b.WriteString("." + exp.Sel.Name)
+	case *ast.IndexExpr:
+		formatExpr(b, exp.X)
+		b.WriteByte('[')
+		formatExpr(b, exp.Index)
+		b.WriteByte(']')
+	default:
+		// Go syntax which is no expression of eval, e.g. a function literal
+		var buf bytes.Buffer
+		_ = printer.Fprint(&buf, token.NewFileSet(), exp)
+		b.Write(buf.Bytes())
+	}
+}
+
+// formatString returns s as string literal, in back quotes when s
+// contains backslashes or double quotes like regular expressions
+func formatString(s string) string {
+	if strings.ContainsAny(s, `\"`) && strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,67 @@
+package eval
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		input, expected string
+	}{
+		{`1+2`, `1 + 2`},
+		{`round( a*2,1)+ val('x')`, `round(a * 2, 1) + val('x')`},
+		{`round( a*2,1)+ val("x")`, `round(a * 2, 1) + val("x")`},
+		{"  (in-out)/in*100>80  ", `(in - out) / in * 100 > 80`},
+		{`!isNaN(x)&&-y<0x1F`, `!isNaN(x) && -y < 0x1F`},
+		{`- -1`, `- -1`},
+		{`-(-1)`, `-(-1)`},
+		{"`abc`", `"abc"`},
+		{"regexpMatch(`^\\d+$`,s)", "regexpMatch(`^\\d+$`, s)"},
+		{`regexpMatch("^\d+$",s)`, "regexpMatch(`^\\d+$`, s)"},
+		{`"say \"hi\""`, "`say \"hi\"`"},
+		{`"tab\there"`, `"tab\there"`},
+		{`math.sqrt(16)`, `math.sqrt(16)`},
+		{`max(1,samples...)`, `max(1, samples...)`},
+		{`samples[ i+1 ]`, `samples[i + 1]`},
+		{"x=1 ;y = x*2;\n x+y;", `x = 1; y = x * 2; x + y`},
+		{`setVal("a",1)`, `setVal("a", 1)`},
+		{"1 +\n  2", `1 + 2`},
+	} {
+		got, err := Format(tc.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.input, err)
+			continue
+		}
+		if got != tc.expected {
+			t.Errorf("%s: expected %s but got %s", tc.input, tc.expected, got)
+			continue
+		}
+		// formatting is stable and keeps the meaning
+		if again, _ := Format(got); again != got {
+			t.Errorf("%s: formatted again %s", got, again)
+		}
+	}
+
+	// syntax errors
+	for _, input := range []string{``, `1 +`, `round(1,`, `a = `, `regexpMatch("\x4G", s)`} {
+		if got, err := Format(input); err == nil {
+			t.Errorf("%s: expected an error but got %s", input, got)
+		}
+	}
+
+	variables := map[string]interface{}{"a": 2.5, "in": 10, "out": 2, "s": "42"}
+	for _, input := range []string{
+		`round( a*2,1)+ 1`,
+		`(in-out)/in*100`,
+		"regexpMatch(`^\\d+$`,s)",
+		`x=1 ;y = x*2; x+y`,
+	} {
+		formatted, _ := Format(input)
+		e := New(input).Variables(variables)
+		_ = e.ParseExpr()
+		expected := e.Run()
+		e = New(formatted).Variables(variables)
+		_ = e.ParseExpr()
+		if result := e.Run(); result != expected {
+			t.Errorf("%s: expected %v but got %v", formatted, expected, result)
+		}
+	}
+}
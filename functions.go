@@ -0,0 +1,471 @@
+package eval
+
+import (
+	"fmt"
+	"go/ast"
+	"go/scanner"
+	"go/token"
+	"strings"
+	"sync"
+)
+
+// arity is the number of arguments a function takes
+type arity struct {
+	min, max int // max -1 takes any number of arguments
+}
+
+// String returns the number of arguments for messages
+func (a arity) String() string {
+	switch {
+	case a.max < 0:
+		return fmt.Sprintf("at least %d", a.min)
+	case a.min == a.max:
+		return fmt.Sprint(a.min)
+	}
+	return fmt.Sprintf("%d to %d", a.min, a.max)
+}
+
+// accepts reports whether a function takes n arguments
+func (a arity) accepts(n int) bool {
+	return n >= a.min && (a.max < 0 || n <= a.max)
+}
+
+// builtins lists all built-in functions with the number of
+// arguments they take, see the switch in call()
+var builtins = map[string]arity{
+	"abs":                  {1, 1},
+	"acos":                 {1, 1},
+	"ageSeconds":           {1, 1},
+	"almostEqual":          {3, 3},
+	"altitudeFromPressure": {1, 2},
+	"apparentTemp":         {3, 3},
+	"argMax":               {1, -1},
+	"argMin":               {1, -1},
+	"asin":                 {1, 1},
+	"atan":                 {1, 1},
+	"atan2":                {2, 2},
+	"avg":                  {1, -1},
+	"backoffDue":           {4, 4},
+	"businessDaysBetween":  {2, 4},
+	"cache":                {3, 3},
+	"camelCase":            {1, 1},
+	"ceil":                 {1, 2},
+	"chain":                {2, -1},
+	"changed":              {2, 2},
+	"clamp":                {3, 3},
+	"coalesce":             {1, -1},
+	"cos":                  {1, 1},
+	"count":                {1, -1},
+	"counterGet":           {1, 1},
+	"counterInc":           {1, 2},
+	"csvField":             {2, 3},
+	"csvLine":              {1, -1},
+	"deg2rad":              {1, 1},
+	"dewPoint":             {2, 2},
+	"ellipsis":             {2, 2},
+	"env":                  {1, 1},
+	"exists":               {1, 1},
+	"flapCount":            {3, 3},
+	"float64":              {1, 1},
+	"floor":                {1, 2},
+	"fuzzyMatch":           {3, 3},
+	"globMatch":            {2, 2},
+	"hashBucket":           {2, 2},
+	"heatIndex":            {2, 2},
+	"hmacSha256":           {2, 2},
+	"htmlEscape":           {1, 1},
+	"htmlUnescape":         {1, 1},
+	"ifExpr":               {3, 3},
+	"int":                  {1, 1},
+	"isBetween":            {3, 4},
+	"isEmail":              {1, 1},
+	"isNaN":                {1, 1},
+	"isURL":                {1, 1},
+	"jsonType":             {2, 2},
+	"jsonValid":            {1, 1},
+	"jwtClaim":             {2, 3},
+	"kebabCase":            {1, 1},
+	"kvGet":                {2, 2},
+	"len":                  {1, 1},
+	"let":                  {3, -1},
+	"levenshtein":          {2, 2},
+	"lineCount":            {1, 1},
+	"lookup":               {3, -1},
+	"lookupTable":          {2, 3},
+	"luhnValid":            {1, 1},
+	"max":                  {1, -1},
+	"metaphone":            {1, 1},
+	"min":                  {1, -1},
+	"minMax":               {1, -1},
+	"mod":                  {2, 2},
+	"mod97Valid":           {1, 1},
+	"money":                {2, 3},
+	"naturalCompare":       {2, 2},
+	"normalize":            {3, 3},
+	"normalizeSpace":       {1, 1},
+	"not":                  {1, 1},
+	"num":                  {1, 1},
+	"parseTime":            {1, 2},
+	"pctChange":            {2, 3},
+	"plural":               {3, 3},
+	"popScope":             {0, 0},
+	"pow":                  {2, 2},
+	"previous":             {1, 1},
+	"pushScope":            {0, 0},
+	"queryParam":           {2, 2},
+	"rad2deg":              {1, 1},
+	"random":               {0, 1},
+	"regexpMatch":          {2, 2},
+	"result":               {1, 4},
+	"rollingMax":           {3, 3},
+	"rollingMin":           {3, 3},
+	"round":                {2, 2},
+	"score":                {2, -1},
+	"seaLevelPressure":     {2, 2},
+	"setEnv":               {2, 2},
+	"setVal":               {2, -1},
+	"sin":                  {1, 1},
+	"snakeCase":            {1, 1},
+	"soundex":              {1, 1},
+	"sprintf":              {1, -1},
+	"sqrt":                 {1, 1},
+	"startOfDay":           {1, 2},
+	"startOfHour":          {1, 2},
+	"startOfMonth":         {1, 2},
+	"stripAnsi":            {1, 1},
+	"stripControl":         {1, 1},
+	"substr":               {3, 3},
+	"sum":                  {1, -1},
+	"switchExpr":           {3, -1},
+	"tan":                  {1, 1},
+	"tariff":               {2, 2},
+	"template":             {1, 2},
+	"throttle":             {3, 3},
+	"time":                 {2, 2},
+	"titleCase":            {1, 1},
+	"translate":            {1, 1},
+	"trunc":                {1, 2},
+	"uuid":                 {0, 0},
+	"val":                  {1, 1},
+	"valOr":                {2, 2},
+	"wavg":                 {2, -1},
+	"windChill":            {2, 2},
+	"wordCount":            {1, 1},
+	"xmlGet":               {2, 2},
+}
+
+// namespaces groups the builtins to be called with a namespace, e.g.
+// 'math.sqrt(x)' or 'json.type(doc, "a")'. Keep it in sync with builtins.
+var namespaces = map[string]map[string]string{
+	"crypto": {
+		"hashBucket": "hashBucket",
+		"hmacSha256": "hmacSha256",
+		"jwtClaim":   "jwtClaim",
+	},
+	"json": {
+		"type":  "jsonType",
+		"valid": "jsonValid",
+	},
+	"math": {
+		"abs":         "abs",
+		"acos":        "acos",
+		"almostEqual": "almostEqual",
+		"argMax":      "argMax",
+		"argMin":      "argMin",
+		"asin":        "asin",
+		"atan":        "atan",
+		"atan2":       "atan2",
+		"avg":         "avg",
+		"ceil":        "ceil",
+		"clamp":       "clamp",
+		"cos":         "cos",
+		"count":       "count",
+		"deg2rad":     "deg2rad",
+		"float64":     "float64",
+		"floor":       "floor",
+		"int":         "int",
+		"isNaN":       "isNaN",
+		"max":         "max",
+		"min":         "min",
+		"minMax":      "minMax",
+		"mod":         "mod",
+		"normalize":   "normalize",
+		"num":         "num",
+		"pctChange":   "pctChange",
+		"pow":         "pow",
+		"rad2deg":     "rad2deg",
+		"round":       "round",
+		"score":       "score",
+		"sin":         "sin",
+		"sqrt":        "sqrt",
+		"sum":         "sum",
+		"tan":         "tan",
+		"trunc":       "trunc",
+		"wavg":        "wavg",
+	},
+	"os": {
+		"env":    "env",
+		"setEnv": "setEnv",
+	},
+	"state": {
+		"backoffDue": "backoffDue",
+		"cache":      "cache",
+		"changed":    "changed",
+		"counterGet": "counterGet",
+		"counterInc": "counterInc",
+		"flapCount":  "flapCount",
+		"previous":   "previous",
+		"rollingMax": "rollingMax",
+		"rollingMin": "rollingMin",
+		"throttle":   "throttle",
+	},
+	"str": {
+		"camelCase":      "camelCase",
+		"csvField":       "csvField",
+		"csvLine":        "csvLine",
+		"ellipsis":       "ellipsis",
+		"fuzzyMatch":     "fuzzyMatch",
+		"globMatch":      "globMatch",
+		"htmlEscape":     "htmlEscape",
+		"htmlUnescape":   "htmlUnescape",
+		"kebabCase":      "kebabCase",
+		"kvGet":          "kvGet",
+		"levenshtein":    "levenshtein",
+		"lineCount":      "lineCount",
+		"metaphone":      "metaphone",
+		"naturalCompare": "naturalCompare",
+		"normalizeSpace": "normalizeSpace",
+		"queryParam":     "queryParam",
+		"regexpMatch":    "regexpMatch",
+		"snakeCase":      "snakeCase",
+		"soundex":        "soundex",
+		"sprintf":        "sprintf",
+		"stripAnsi":      "stripAnsi",
+		"stripControl":   "stripControl",
+		"substr":         "substr",
+		"template":       "template",
+		"titleCase":      "titleCase",
+		"wordCount":      "wordCount",
+	},
+	"time": {
+		"ageSeconds":          "ageSeconds",
+		"businessDaysBetween": "businessDaysBetween",
+		"parse":               "parseTime",
+		"startOfDay":          "startOfDay",
+		"startOfHour":         "startOfHour",
+		"startOfMonth":        "startOfMonth",
+	},
+	"valid": {
+		"email": "isEmail",
+		"luhn":  "luhnValid",
+		"mod97": "mod97Valid",
+		"url":   "isURL",
+	},
+	"weather": {
+		"altitude":         "altitudeFromPressure",
+		"apparentTemp":     "apparentTemp",
+		"dewPoint":         "dewPoint",
+		"heatIndex":        "heatIndex",
+		"seaLevelPressure": "seaLevelPressure",
+		"windChill":        "windChill",
+	},
+	"xml": {
+		"get": "xmlGet",
+	},
+}
+
+// aliases maps alternative names to builtins, see RegisterAlias()
+var (
+	aliasesMu sync.RWMutex
+	aliases   = map[string]string{}
+)
+
+// RegisterAlias makes the builtin function name callable as alias,
+// e.g. to keep formulas of other expression dialects working:
+//
+//  _ = eval.RegisterAlias("power", "pow")
+//  _ = eval.RegisterAlias("if", "ifExpr") // if(x > 1, "a", "b")
+//
+// Aliases are global for all expressions, functions of an Environment
+// take precedence. It returns an error when name is no builtin or
+// alias is a builtin.
+func RegisterAlias(alias, name string) error {
+	if _, ok := builtins[name]; !ok {
+		return fmt.Errorf("alias %q: unknown function %q", alias, name)
+	}
+	if _, ok := builtins[alias]; ok {
+		return fmt.Errorf("alias %q: is a builtin function", alias)
+	}
+	if !token.IsIdentifier(alias) && !token.Lookup(alias).IsKeyword() {
+		return fmt.Errorf("alias %q: invalid name", alias)
+	}
+	aliasesMu.Lock()
+	defer aliasesMu.Unlock()
+	aliases[alias] = name
+	return nil
+}
+
+// functions holds the functions registered globally, see RegisterFunction()
+var (
+	functionsMu sync.RWMutex
+	functions   = map[string]Function{}
+)
+
+// RegisterFunction makes fn callable as name(...) in all expressions,
+// e.g. functions shared by all rules of an application. Functions of an
+// Environment or registered with Eval.RegisterFunction take precedence,
+// builtins are overridden.
+func RegisterFunction(name string, fn Function) {
+	functionsMu.Lock()
+	defer functionsMu.Unlock()
+	functions[name] = fn
+}
+
+// registeredFunction returns the function registered globally as name
+func registeredFunction(name string) (Function, bool) {
+	functionsMu.RLock()
+	defer functionsMu.RUnlock()
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// functionFilter restricts the builtins which may be called, see
+// AllowFunctions() and DenyFunctions(). The zero value permits all.
+// The maps are replaced but never modified, so that copies can be
+// shared.
+type functionFilter struct {
+	allowed map[string]bool // nil allows all
+	denied  map[string]bool
+}
+
+// allow returns f permitting names only
+func (f functionFilter) allow(names []string) functionFilter {
+	f.allowed = make(map[string]bool, len(names))
+	for _, name := range names {
+		f.allowed[resolveName(name)] = true
+	}
+	return f
+}
+
+// deny returns f forbidding names as well
+func (f functionFilter) deny(names []string) functionFilter {
+	denied := make(map[string]bool, len(f.denied)+len(names))
+	for name := range f.denied {
+		denied[name] = true
+	}
+	for _, name := range names {
+		denied[resolveName(name)] = true
+	}
+	f.denied = denied
+	return f
+}
+
+// permits reports whether the builtin name may be called
+func (f functionFilter) permits(name string) bool {
+	return !f.denied[name] && (f.allowed == nil || f.allowed[name])
+}
+
+// resolveName returns the builtin of a namespaced name like "math.sqrt"
+// or of an alias, otherwise name itself
+func resolveName(name string) string {
+	if ns, fn, ok := strings.Cut(name, "."); ok {
+		if builtin, ok := namespaces[ns][fn]; ok {
+			return builtin
+		}
+		return name
+	}
+	return resolveAlias(name)
+}
+
+// resolveAlias returns the builtin registered for alias
+// or name itself
+func resolveAlias(name string) string {
+	aliasesMu.RLock()
+	defer aliasesMu.RUnlock()
+	if builtin, ok := aliases[name]; ok {
+		return builtin
+	}
+	return name
+}
+
+// replaceKeywordAliases replaces calls of aliases and namespaced builtins
+// which are Go keywords like 'if(...)' or 'json.type(...)' with
+// identifiers like '_f(...)' of the same length, the parser rejects them
+// otherwise. Positions in the parsed expression stay those of input. The
+// keywords are returned by their identifier.
+func replaceKeywordAliases(input string) (string, map[string]string) {
+	aliasesMu.RLock()
+	defer aliasesMu.RUnlock()
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(input))
+	s.Init(file, []byte(input), nil, 0)
+	var b strings.Builder
+	last := 0 // offset of input copied to b
+	var keyword string
+	var offset int
+	var keywords map[string]string
+	var prev token.Token
+	var prevLit string
+	var ns string // namespace of the current token like "json" of 'json.type'
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.LPAREN && keyword != "" {
+			// keywords differ in more than their first letter
+			id := "_" + keyword[1:]
+			if keywords == nil {
+				keywords = make(map[string]string)
+			}
+			keywords[id] = keyword
+			b.WriteString(input[last:offset])
+			b.WriteString(id)
+			last = offset + len(keyword)
+		}
+		keyword = ""
+		if tok.IsKeyword() {
+			_, alias := aliases[lit]
+			_, namespaced := namespaces[ns][lit]
+			if namespaced || alias && prev != token.PERIOD {
+				keyword, offset = lit, file.Offset(pos)
+			}
+		}
+		ns = ""
+		if tok == token.PERIOD && prev == token.IDENT {
+			ns = prevLit
+		}
+		prev, prevLit = tok, lit
+	}
+	if last == 0 {
+		return input, nil
+	}
+	b.WriteString(input[last:])
+	return b.String(), keywords
+}
+
+// value is an already evaluated argument. It is used to
+// call functions with computed arguments, e.g. in chain().
+type value struct {
+	ast.BadExpr
+	v interface{}
+}
+
+// isFunction returns true when name can be called
+func (e *Eval) isFunction(name string) bool {
+	if _, ok := builtins[resolveName(name)]; ok {
+		return true
+	}
+	if _, ok := e.functions[name]; ok {
+		return true
+	}
+	if _, ok := registeredFunction(name); ok {
+		return true
+	}
+	if e.environment != nil {
+		_, ok := e.environment.functions[name]
+		return ok
+	}
+	return false
+}
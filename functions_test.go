@@ -0,0 +1,275 @@
+package eval
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// TestBuiltins checks that builtins lists exactly the functions of
+// the switch in call()
+func TestBuiltins(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "eval.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := make(map[string]bool)
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); !ok || fn.Name.Name != "call" {
+			continue
+		}
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if c, ok := n.(*ast.CaseClause); ok {
+				for _, x := range c.List {
+					if lit, ok := x.(*ast.BasicLit); ok {
+						name, _ := strconv.Unquote(lit.Value)
+						cases[name] = true
+					}
+				}
+			}
+			return true
+		})
+	}
+	if len(cases) == 0 {
+		t.Fatal("no functions found in call()")
+	}
+	for name := range cases {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("%s is missing in builtins", name)
+		}
+	}
+	for name := range builtins {
+		if !cases[name] {
+			t.Errorf("%s is listed in builtins but unknown to call()", name)
+		}
+	}
+}
+
+func TestRegisterAlias(t *testing.T) {
+	if err := RegisterAlias("power", "pow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterAlias("if", "ifExpr"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		aliasesMu.Lock()
+		delete(aliases, "power")
+		delete(aliases, "if")
+		aliasesMu.Unlock()
+	}()
+	for _, tc := range []struct {
+		alias, name string
+	}{
+		{"x", "unknown"},
+		{"pow", "sqrt"},
+		{"no alias", "pow"},
+	} {
+		if err := RegisterAlias(tc.alias, tc.name); err == nil {
+			t.Errorf("expected an error for alias %q of %q", tc.alias, tc.name)
+		}
+	}
+
+	var ok = map[string]interface{}{
+		`power(2, 3)`:                    8.0,
+		`if(x > 1, "big", "small")`:      "big",
+		`if(power(x, 2) > 10, 1, 2) + 1`: 3,
+		`chain(x, "power", 2)`:           4.0,
+	}
+	for s, r := range ok {
+		c, err := Compile(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if result := c.MustRun(map[string]interface{}{"x": 2.0}); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+
+	// keywords are replaced in calls only
+	if _, err := Compile(`if x`); err == nil {
+		t.Errorf("expected a parser error")
+	}
+
+	// positions are those of the input
+	errs := New(`if(x, "", sprintf("%s %s", "a"))`).Validate()
+	if want := `1:11: sprintf: missing argument for %s`; len(errs) != 1 || errs[0].Error() != want {
+		t.Errorf("expected %q but got %v", want, errs)
+	}
+	if s, _ := Format(`if(x>1,"a",  "b")`); s != `if(x > 1, "a", "b")` {
+		t.Errorf("unexpected format %s", s)
+	}
+
+	// functions of an Environment take precedence
+	env := NewEnvironment().Function("power", func(args ...interface{}) (interface{}, error) {
+		return "env", nil
+	})
+	if result, _ := env.Run(MustCompile(`power(2, 3)`)); result != "env" {
+		t.Errorf("expected env but got %v", result)
+	}
+}
+
+// TestNamespaces checks that all namespaced functions are builtins
+func TestNamespaces(t *testing.T) {
+	for ns, functions := range namespaces {
+		for fn, builtin := range functions {
+			if _, ok := builtins[builtin]; !ok {
+				t.Errorf("%s.%s: %s is no builtin", ns, fn, builtin)
+			}
+		}
+	}
+
+	var ok = map[string]interface{}{
+		`math.sqrt(16)`:                       4.0,
+		`math.round(math.pow(x, 0.5), 2)`:     1.41,
+		`str.snakeCase("Disk Usage")`:         "disk_usage",
+		`valid.email("a@example.com")`:        true,
+		`json.type("{}", "")`:                 "object",
+		`json.type("[]", "") == "array"`:      true,
+		`chain(16, "math.sqrt", "math.sqrt")`: 2.0,
+	}
+	for s, r := range ok {
+		if result := MustCompile(s).MustRun(map[string]interface{}{"x": 2.0}); result != r {
+			t.Errorf("Expected %v from %s as output but got %v", r, s, result)
+		}
+	}
+
+	for _, s := range []string{`math.upper("a")`, `unknown.sqrt(4)`, `sqrt(4).x(1)`} {
+		if _, err := MustCompile(s).Run(nil); err == nil {
+			t.Errorf("expected an error from %s", s)
+		}
+	}
+
+	// namespaced names which are Go keywords are no parser errors
+	if errs := New(`json.type(doc, "a")`).Validate(); len(errs) != 0 {
+		t.Errorf("expected no errors but got %v", errs)
+	}
+	if out, err := Format(`json.type(doc,"a")`); err != nil || out != `json.type(doc, "a")` {
+		t.Errorf("unexpected format %q, %v", out, err)
+	}
+	for _, s := range []string{`x.type(1)`, `json.type`} {
+		if _, err := Compile(s); err == nil {
+			t.Errorf("expected a parser error from %s", s)
+		}
+	}
+
+	// functions of an Environment may be namespaced, too
+	env := NewEnvironment().Function("my.answer", func(args ...interface{}) (interface{}, error) {
+		return 42, nil
+	})
+	if result, err := env.Run(MustCompile(`my.answer()`)); result != 42 || err != nil {
+		t.Errorf("expected 42 but got %v, %v", result, err)
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	RegisterFunction("testTwice", func(args ...interface{}) (interface{}, error) {
+		return args[0].(float64) * 2, nil
+	})
+	RegisterFunction("testAbs", func(args ...interface{}) (interface{}, error) {
+		return "global", nil
+	})
+	defer func() {
+		functionsMu.Lock()
+		delete(functions, "testTwice")
+		delete(functions, "testAbs")
+		functionsMu.Unlock()
+	}()
+	local := func(args ...interface{}) (interface{}, error) {
+		return "local", nil
+	}
+	for _, tc := range []struct {
+		input    string
+		expected interface{}
+	}{
+		{`testTwice(21.0)`, 42.0},
+		{`chain(2.0, "testTwice", "testTwice")`, 8.0},
+		{`testAbs()`, "local"},
+		{`testLocal()`, "local"},
+		{`abs(-1)`, 1.0},
+	} {
+		e := New(tc.input).RegisterFunction("testAbs", local).RegisterFunction("testLocal", local)
+		if result, err := e.RunErr(); err != nil || result != tc.expected {
+			t.Errorf("%s: expected %v but got %v (%v)", tc.input, tc.expected, result, err)
+		}
+	}
+
+	// builtins are overridden
+	RegisterFunction("soundex", func(args ...interface{}) (interface{}, error) {
+		return "overridden", nil
+	})
+	defer func() {
+		functionsMu.Lock()
+		delete(functions, "soundex")
+		functionsMu.Unlock()
+	}()
+	if result, _ := New(`soundex("Robert")`).RunErr(); result != "overridden" {
+		t.Errorf("expected the registered function but got %v", result)
+	}
+
+	// functions of an Environment take precedence, errors are wrapped
+	failure := errors.New("failure")
+	env := NewEnvironment().Function("testTwice", func(args ...interface{}) (interface{}, error) {
+		return nil, failure
+	})
+	if _, err := env.Run(MustCompile(`testTwice(1.0)`)); !errors.Is(err, failure) {
+		t.Errorf("expected the failure of the Environment but got %v", err)
+	}
+}
+
+func TestAllowDenyFunctions(t *testing.T) {
+	for _, tc := range []struct {
+		allow, deny []string
+		input       string
+		denied      string // function name, "" for none
+	}{
+		{[]string{"round", "pow", "val"}, nil, `round(pow(val("x"), 2), 1)`, ""},
+		{[]string{"round", "pow", "val"}, nil, `round(env("HOME"), 1)`, "env"},
+		{[]string{"math.sqrt"}, nil, `sqrt(4) + math.sqrt(4)`, ""},
+		{[]string{"sqrt"}, nil, `math.abs(4)`, "math.abs"},
+		{nil, []string{"env", "time"}, `round(1.55, 1)`, ""},
+		{nil, []string{"env", "time"}, `1 + time("now", "epoch")`, "time"},
+		{nil, []string{"os.env"}, `env("HOME")`, "env"},
+		{[]string{"chain", "abs"}, nil, `chain(-2, "abs", "env")`, "env"},
+		{[]string{"abs", "env"}, []string{"env"}, `env("HOME")`, "env"},
+	} {
+		e := New(tc.input).Variables(map[string]interface{}{"x": 2.0})
+		if tc.allow != nil {
+			e.AllowFunctions(tc.allow...)
+		}
+		e.DenyFunctions(tc.deny...)
+		_, err := e.RunErr()
+		var fnErr *Error
+		if tc.denied == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tc.input, err)
+			}
+		} else if !errors.As(err, &fnErr) || !errors.Is(err, ErrNotAllowed) || fnErr.Func != tc.denied {
+			t.Errorf("%s: expected %s to be denied but got %v", tc.input, tc.denied, err)
+		}
+	}
+
+	// functions registered in Go are not restricted
+	e := New(`own(1)`).AllowFunctions("abs").RegisterFunction("own", func(args ...interface{}) (interface{}, error) {
+		return 1, nil
+	})
+	if _, err := e.RunErr(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	env := NewEnvironment().DenyFunctions("env")
+	if _, err := env.Run(MustCompile(`env("HOME")`)); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed but got %v", err)
+	}
+	c, _ := New(`env("HOME")`).DenyFunctions("env").Compile()
+	if _, err := c.Run(nil); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed but got %v", err)
+	}
+	if errs := New(`abs(env("HOME"))`).AllowFunctions("abs").Validate(); len(errs) != 1 || !errors.Is(errs[0], ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed but got %v", errs)
+	}
+}
@@ -0,0 +1,233 @@
+package eval
+
+import (
+	"sort"
+	"strings"
+)
+
+// FunctionInfo describes a function which can be called in expressions,
+// e.g. for the autocompletion of an editor, see Functions()
+type FunctionInfo struct {
+	// Name of the function, builtins without namespace
+	Name string
+	// MinArgs and MaxArgs are the number of arguments,
+	// MaxArgs is -1 for functions taking any number of arguments
+	MinArgs, MaxArgs int
+	// Params are the kinds of the leading arguments which are checked
+	// by Validate(), "number", "string", "bool" or "any"
+	Params []string
+	// Pure is true when the result depends on the arguments and the
+	// variables only and calls have no side effects, e.g. sqrt() but
+	// neither time() nor setVal()
+	Pure bool
+	// Description is a one line summary
+	Description string
+	// Builtin is false for functions registered with RegisterFunction
+	Builtin bool
+}
+
+// descriptions summarizes the builtins, keep it in sync with builtins
+var descriptions = map[string]string{
+	"abs":                  "absolute value of x",
+	"acos":                 "arccosine of x in radians",
+	"ageSeconds":           "seconds since the time t",
+	"almostEqual":          "reports whether a and b differ by epsilon at most",
+	"altitudeFromPressure": "altitude in meters at an air pressure in hPa",
+	"apparentTemp":         "temperature felt in the shade with humidity and wind",
+	"argMax":               "index of the largest number",
+	"argMin":               "index of the smallest number",
+	"asin":                 "arcsine of x in radians",
+	"atan":                 "arctangent of x in radians",
+	"atan2":                "arctangent of y/x in radians",
+	"avg":                  "average of numbers",
+	"backoffDue":           "true when an exponential backoff allows the next action",
+	"businessDaysBetween":  "weekdays between two times without holidays",
+	"cache":                "value of an expression cached for some seconds",
+	"camelCase":            "converts s to camelCase",
+	"ceil":                 "rounds x up to decimal places",
+	"chain":                "applies functions from left to right",
+	"changed":              "true when a value differs from the previous run",
+	"clamp":                "x bounded into a range",
+	"coalesce":             "first argument which is no empty string, NaN or undefined",
+	"cos":                  "cosine of x radians",
+	"count":                "number of numbers",
+	"counterGet":           "value of a counter",
+	"counterInc":           "increments a counter and returns the new value",
+	"csvField":             "field of a CSV formatted line",
+	"csvLine":              "quoted CSV record of the values",
+	"deg2rad":              "converts degrees to radians",
+	"dewPoint":             "dew point in °C of air with a relative humidity",
+	"ellipsis":             "shortens s to a number of characters",
+	"env":                  "environment variable of the process",
+	"exists":               "true when a variable is set, also to an empty string",
+	"flapCount":            "number of changes of a value within a time window",
+	"float64":              "converts x to a float64 value",
+	"floor":                "rounds x down to decimal places",
+	"fuzzyMatch":           "true when two strings are similar",
+	"globMatch":            "true when s matches a shell pattern",
+	"hashBucket":           "stable bucket of a value for sharding",
+	"heatIndex":            "temperature felt at a relative humidity",
+	"hmacSha256":           "HMAC-SHA256 signature of a message",
+	"htmlEscape":           "escapes <, >, &, ' and \" in s",
+	"htmlUnescape":         "converts HTML entities back to characters",
+	"ifExpr":               "value depending on a condition",
+	"int":                  "converts x to an int",
+	"isBetween":            "true when x is within a range",
+	"isEmail":              "true for a valid e-mail address",
+	"isNaN":                "true when x is no number",
+	"isURL":                "true for a valid absolute URL",
+	"jsonType":             "type of an element of a JSON document",
+	"jsonValid":            "true for a valid JSON document",
+	"jwtClaim":             "claim of a JSON web token",
+	"kebabCase":            "converts s to kebab-case",
+	"kvGet":                "value of a key in key=value pairs",
+	"len":                  "number of elements of a slice or characters of a string",
+	"let":                  "binds variables for an expression",
+	"levenshtein":          "edit distance of two strings",
+	"lineCount":            "number of lines of s",
+	"lookup":               "value of a key in key value pairs",
+	"lookupTable":          "value of a key in a registered lookup table",
+	"luhnValid":            "true when a number passes the Luhn check",
+	"max":                  "largest number",
+	"metaphone":            "phonetic key of s",
+	"min":                  "smallest number",
+	"minMax":               "smallest and largest number",
+	"mod":                  "remainder of x divided by y",
+	"mod97Valid":           "true when a number passes the ISO 7064 mod 97 check",
+	"money":                "rounds and formats an amount of a currency",
+	"naturalCompare":       "compares strings in natural order",
+	"normalize":            "maps a value to 0..1",
+	"normalizeSpace":       "collapses white space in s",
+	"not":                  "negates a bool",
+	"num":                  "converts x to a float64 value",
+	"parseTime":            "epoch of a timestamp",
+	"pctChange":            "change from one value to another in percent",
+	"plural":               "translated text for a number",
+	"popScope":             "closes the scope of variables opened by pushScope",
+	"pow":                  "x to the power of y",
+	"previous":             "value of the previous run of changed()",
+	"pushScope":            "opens a new scope for variables",
+	"queryParam":           "parameter of the query of a URL",
+	"rad2deg":              "converts radians to degrees",
+	"random":               "random number in 0..1 or int in 0..n-1",
+	"regexpMatch":          "true when s matches a regular expression",
+	"result":               "structured Result of a check",
+	"rollingMax":           "largest value within a time window",
+	"rollingMin":           "smallest value within a time window",
+	"round":                "rounds x to decimal places",
+	"score":                "weighted health score in 0..100",
+	"seaLevelPressure":     "air pressure in hPa reduced to sea level",
+	"setEnv":               "sets an environment variable of the process",
+	"setVal":               "assigns values to variables",
+	"sin":                  "sine of x radians",
+	"snakeCase":            "converts s to snake_case",
+	"soundex":              "soundex code of s",
+	"sprintf":              "formats values like fmt.Sprintf",
+	"sqrt":                 "square root of x",
+	"startOfDay":           "start of the day of a time",
+	"startOfHour":          "start of the hour of a time",
+	"startOfMonth":         "start of the month of a time",
+	"stripAnsi":            "removes ANSI escape sequences from s",
+	"stripControl":         "removes control characters from s",
+	"substr":               "part of a string",
+	"sum":                  "sum of numbers",
+	"switchExpr":           "result of the first case equal to a value",
+	"tan":                  "tangent of x radians",
+	"tariff":               "price of units with tiered pricing",
+	"template":             "fills a text template with variables",
+	"throttle":             "true at most n times within a time window",
+	"time":                 "current or start time as epoch or string",
+	"titleCase":            "converts s to Title Case",
+	"translate":            "translated text",
+	"trunc":                "rounds x toward zero to decimal places",
+	"uuid":                 "random UUID version 4",
+	"val":                  "value of a variable",
+	"valOr":                "value of a variable or a default",
+	"wavg":                 "weighted average",
+	"windChill":            "temperature felt on exposed skin in the wind",
+	"wordCount":            "number of words of s",
+	"xmlGet":               "element or attribute of an XML document",
+}
+
+// impure lists the builtins which depend on more than their arguments
+// and the variables or have side effects
+var impure = map[string]bool{
+	"ageSeconds": true,
+	"backoffDue": true,
+	"cache":      true,
+	"chain":      true, // may call impure functions
+	"changed":    true,
+	"counterGet": true,
+	"counterInc": true,
+	"env":        true,
+	"flapCount":  true,
+	"popScope":   true,
+	"previous":   true,
+	"pushScope":  true,
+	"random":     true,
+	"rollingMax": true,
+	"rollingMin": true,
+	"setEnv":     true,
+	"setVal":     true,
+	"throttle":   true,
+	"time":       true,
+	"uuid":       true,
+}
+
+// Functions returns the builtins and the functions registered with
+// RegisterFunction sorted by name. A registered function replacing a
+// builtin is listed once as registered function.
+func Functions() []FunctionInfo {
+	functionsMu.RLock()
+	infos := make([]FunctionInfo, 0, len(builtins)+len(functions))
+	for name := range functions {
+		infos = append(infos, FunctionInfo{Name: name, MaxArgs: -1})
+	}
+	functionsMu.RUnlock()
+	for name, a := range builtins {
+		if _, ok := registeredFunction(name); ok {
+			continue
+		}
+		info := FunctionInfo{
+			Name:        name,
+			MinArgs:     a.min,
+			MaxArgs:     a.max,
+			Pure:        !impure[name],
+			Description: descriptions[name],
+			Builtin:     true,
+		}
+		for _, k := range paramKinds[name] {
+			param, ok := kindNames[k]
+			if !ok {
+				param = "any"
+			}
+			info.Params = append(info.Params, param)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Signature returns the call of the function with the kinds of its
+// arguments, e.g. "round(number, number)" or "max(number, ...)".
+// Optional arguments are written in brackets.
+func (info FunctionInfo) Signature() string {
+	var params []string
+	for i := 0; i < info.MinArgs || i < info.MaxArgs; i++ {
+		param := "any"
+		if i < len(info.Params) {
+			param = info.Params[i]
+		}
+		if i >= info.MinArgs {
+			param = "[" + param + "]"
+		}
+		params = append(params, param)
+	}
+	if info.MaxArgs < 0 {
+		params = append(params, "...")
+	}
+	return info.Name + "(" + strings.Join(params, ", ") + ")"
+}
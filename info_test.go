@@ -0,0 +1,77 @@
+package eval
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFunctions(t *testing.T) {
+	// keep the descriptions in sync with the builtins
+	for name := range builtins {
+		if descriptions[name] == "" {
+			t.Errorf("%s: missing description", name)
+		}
+	}
+	for name := range descriptions {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("%s: description of an unknown builtin", name)
+		}
+	}
+	for name := range impure {
+		if _, ok := builtins[name]; !ok {
+			t.Errorf("%s: unknown impure builtin", name)
+		}
+	}
+
+	RegisterFunction("infoTestFn", func(args ...interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	defer func() {
+		functionsMu.Lock()
+		delete(functions, "infoTestFn")
+		functionsMu.Unlock()
+	}()
+
+	infos := Functions()
+	byName := map[string]FunctionInfo{}
+	for i, info := range infos {
+		if i > 0 && infos[i-1].Name >= info.Name {
+			t.Errorf("%s is not sorted", info.Name)
+		}
+		byName[info.Name] = info
+	}
+	for name := range builtins {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("%s: missing", name)
+		}
+	}
+	expected := map[string]FunctionInfo{
+		"round": {Name: "round", MinArgs: 2, MaxArgs: 2, Params: []string{"number", "number"}, Pure: true,
+			Description: "rounds x to decimal places", Builtin: true},
+		"setVal": {Name: "setVal", MinArgs: 2, MaxArgs: -1, Description: "assigns values to variables", Builtin: true},
+		"valOr": {Name: "valOr", MinArgs: 2, MaxArgs: 2, Params: []string{"string", "any"}, Pure: true,
+			Description: "value of a variable or a default", Builtin: true},
+		"infoTestFn": {Name: "infoTestFn", MaxArgs: -1},
+	}
+	for name, info := range expected {
+		if !reflect.DeepEqual(byName[name], info) {
+			t.Errorf("expected %+v but got %+v", info, byName[name])
+		}
+	}
+}
+
+func TestSignature(t *testing.T) {
+	for _, tc := range []struct {
+		info     FunctionInfo
+		expected string
+	}{
+		{FunctionInfo{Name: "round", MinArgs: 2, MaxArgs: 2, Params: []string{"number", "number"}}, "round(number, number)"},
+		{FunctionInfo{Name: "time", MinArgs: 0, MaxArgs: 2, Params: []string{"string"}}, "time([string], [any])"},
+		{FunctionInfo{Name: "max", MinArgs: 1, MaxArgs: -1, Params: []string{"number"}}, "max(number, ...)"},
+		{FunctionInfo{Name: "fn", MaxArgs: -1}, "fn(...)"},
+	} {
+		if got := tc.info.Signature(); got != tc.expected {
+			t.Errorf("expected %q but got %q", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Package langsupport helps editors of expressions, e.g. the rule editor
+// of a web frontend, with tokens for syntax highlighting, completion
+// candidates, hover texts and diagnostics.
+//
+// All offsets are byte offsets in the expression, lines and columns start
+// at 1 like those of eval.ValidationError.
+package langsupport
+
+import (
+	"errors"
+	"go/scanner"
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/itdesign-at/eval"
+)
+
+// Token kinds
+const (
+	KindFunction    = "function"
+	KindVariable    = "variable"
+	KindNumber      = "number"
+	KindString      = "string"
+	KindOperator    = "operator"
+	KindIllegal     = "illegal"
+	KindPunctuation = "punctuation"
+)
+
+// Token is a part of an expression
+type Token struct {
+	// Kind is one of the Kind constants
+	Kind string
+	// Text is the token as written in the expression
+	Text string
+	// Offset, Line and Column of the first character
+	Offset, Line, Column int
+}
+
+// End returns the offset after the token
+func (t Token) End() int {
+	return t.Offset + len(t.Text)
+}
+
+// Tokenize splits input into tokens. Identifiers followed by '(' are
+// functions, all others variables. Invalid characters and unterminated
+// strings are returned as KindIllegal so that the rest of the input can
+// still be highlighted.
+func Tokenize(input string) []Token {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(input))
+	// failed is set when the scanner reports an error for the token,
+	// escapes unknown to Go like "^\d+$" are accepted by eval
+	var failed bool
+	s.Init(file, []byte(input), func(_ token.Position, msg string) {
+		if msg != "unknown escape sequence" {
+			failed = true
+		}
+	}, 0)
+	var tokens []Token
+	for {
+		failed = false
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// the scanner inserts a ';' at the end of lines
+		if tok == token.SEMICOLON && lit != ";" {
+			continue
+		}
+		position := fset.Position(pos)
+		t := Token{Offset: position.Offset, Line: position.Line, Column: position.Column}
+		switch {
+		case tok == token.IDENT || tok.IsKeyword():
+			t.Kind, t.Text = KindVariable, tok.String()
+			if tok == token.IDENT {
+				t.Text = lit
+			}
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			t.Kind, t.Text = KindNumber, lit
+		case (tok == token.STRING || tok == token.CHAR) && failed:
+			t.Kind, t.Text = KindIllegal, lit
+		case tok == token.STRING || tok == token.CHAR:
+			t.Kind, t.Text = KindString, lit
+		case tok == token.ILLEGAL:
+			t.Kind, t.Text = KindIllegal, lit
+			if t.Text == "" {
+				t.Text = input[t.Offset : t.Offset+1]
+			}
+		case tok.IsOperator() && strings.ContainsAny(tok.String(), "()[]{},;:."):
+			t.Kind, t.Text = KindPunctuation, tok.String()
+		default:
+			t.Kind, t.Text = KindOperator, tok.String()
+		}
+		if tok == token.LPAREN && len(tokens) > 0 && tokens[len(tokens)-1].Kind == KindVariable {
+			tokens[len(tokens)-1].Kind = KindFunction
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// Completion is a candidate for the identifier at the cursor
+type Completion struct {
+	// Label is the name of the function or variable
+	Label string
+	// Kind is KindFunction or KindVariable
+	Kind string
+	// Detail is the signature of functions, e.g. "round(number, number)"
+	Detail string
+	// Documentation is the description of functions
+	Documentation string
+}
+
+// Complete returns the functions and variables starting with the
+// identifier before offset, variables first. The variables are those
+// passed and those used in input.
+func Complete(input string, offset int, variables []string) []Completion {
+	if offset < 0 || offset > len(input) {
+		return nil
+	}
+	start := offset
+	for start > 0 && isIdentChar(input[start-1]) {
+		start--
+	}
+	// the function after a namespace like 'math.' is no builtin name
+	if start > 0 && input[start-1] == '.' {
+		return nil
+	}
+	prefix := input[start:offset]
+
+	seen := map[string]bool{prefix: true} // the identifier itself
+	var vars []Completion
+	names := append(append([]string(nil), variables...), eval.New(input).ListVariables()...)
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			vars = append(vars, Completion{Label: name, Kind: KindVariable})
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Label < vars[j].Label
+	})
+	for _, info := range eval.Functions() {
+		if strings.HasPrefix(info.Name, prefix) {
+			vars = append(vars, Completion{
+				Label:         info.Name,
+				Kind:          KindFunction,
+				Detail:        info.Signature(),
+				Documentation: info.Description,
+			})
+		}
+	}
+	return vars
+}
+
+// Hover returns the signature and the description of the function
+// called at offset, ok is false when there is no known function.
+func Hover(input string, offset int) (text string, ok bool) {
+	for _, t := range Tokenize(input) {
+		if t.Kind != KindFunction || offset < t.Offset || offset >= t.End() {
+			continue
+		}
+		for _, info := range eval.Functions() {
+			if info.Name == t.Text {
+				if info.Description == "" {
+					return info.Signature(), true
+				}
+				return info.Signature() + "\n" + info.Description, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Diagnostic is a problem of an expression
+type Diagnostic struct {
+	// Line and Column of the problem
+	Line, Column int
+	Message      string
+}
+
+// Diagnostics returns the syntax errors of input or the problems found by
+// eval.Validate(), e.g. unknown functions or wrong arguments.
+func Diagnostics(input string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, err := range eval.New(input).Validate() {
+		var list scanner.ErrorList
+		var validation *eval.ValidationError
+		switch {
+		case errors.As(err, &list):
+			for _, e := range list {
+				diagnostics = append(diagnostics, Diagnostic{Line: e.Pos.Line, Column: e.Pos.Column, Message: e.Msg})
+			}
+		case errors.As(err, &validation):
+			diagnostics = append(diagnostics, Diagnostic{Line: validation.Line, Column: validation.Column, Message: validation.Msg})
+		default:
+			diagnostics = append(diagnostics, Diagnostic{Line: 1, Column: 1, Message: err.Error()})
+		}
+	}
+	return diagnostics
+}
+
+// isIdentChar is true for the ASCII characters of identifiers
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,112 @@
+package langsupport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("round(a, 2) > 1.5 &&\n!up; s = \"x\" #")
+	expected := []Token{
+		{KindFunction, "round", 0, 1, 1},
+		{KindPunctuation, "(", 5, 1, 6},
+		{KindVariable, "a", 6, 1, 7},
+		{KindPunctuation, ",", 7, 1, 8},
+		{KindNumber, "2", 9, 1, 10},
+		{KindPunctuation, ")", 10, 1, 11},
+		{KindOperator, ">", 12, 1, 13},
+		{KindNumber, "1.5", 14, 1, 15},
+		{KindOperator, "&&", 18, 1, 19},
+		{KindOperator, "!", 21, 2, 1},
+		{KindVariable, "up", 22, 2, 2},
+		{KindPunctuation, ";", 24, 2, 4},
+		{KindVariable, "s", 26, 2, 6},
+		{KindOperator, "=", 28, 2, 8},
+		{KindString, `"x"`, 30, 2, 10},
+		{KindIllegal, "#", 34, 2, 14},
+	}
+	if !reflect.DeepEqual(tokens, expected) {
+		t.Errorf("expected\n%+v\nbut got\n%+v", expected, tokens)
+	}
+	if tokens := Tokenize(`math.sqrt(x)`); tokens[0].Kind != KindVariable || tokens[2].Kind != KindFunction {
+		t.Errorf("unexpected kinds %+v", tokens)
+	}
+
+	// unterminated strings are illegal, unknown escapes are accepted
+	for input, expected := range map[string][]Token{
+		`"abc`:           {{KindIllegal, `"abc`, 0, 1, 1}},
+		"`abc":           {{KindIllegal, "`abc", 0, 1, 1}},
+		"'ab'":           {{KindIllegal, "'ab'", 0, 1, 1}},
+		"x + \"ab\n1":    {{KindVariable, "x", 0, 1, 1}, {KindOperator, "+", 2, 1, 3}, {KindIllegal, `"ab`, 4, 1, 5}, {KindNumber, "1", 8, 2, 1}},
+		`"^\d+$"`:        {{KindString, `"^\d+$"`, 0, 1, 1}},
+		`"a\x4G" == "b"`: {{KindIllegal, `"a\x4G"`, 0, 1, 1}, {KindOperator, "==", 8, 1, 9}, {KindString, `"b"`, 11, 1, 12}},
+	} {
+		if tokens := Tokenize(input); !reflect.DeepEqual(tokens, expected) {
+			t.Errorf("%s: expected\n%+v\nbut got\n%+v", input, expected, tokens)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	labels := func(completions []Completion) (s []string) {
+		for _, c := range completions {
+			s = append(s, c.Kind+":"+c.Label)
+		}
+		return
+	}
+	for _, tc := range []struct {
+		input     string
+		offset    int
+		variables []string
+		expected  []string
+	}{
+		{"ro", 2, []string{"rows", "in"}, []string{"variable:rows", "function:rollingMax", "function:rollingMin", "function:round"}},
+		{"rowCount + ro", 13, nil, []string{"variable:rowCount", "function:rollingMax", "function:rollingMin", "function:round"}},
+		{"sqr + 1", 3, nil, []string{"function:sqrt"}},
+		{"math.sq", 7, nil, nil},
+		{"sqrt", 9, nil, nil},
+	} {
+		if got := labels(Complete(tc.input, tc.offset, tc.variables)); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: expected %v but got %v", tc.input, tc.expected, got)
+		}
+	}
+
+	c := Complete("roun", 4, nil)
+	if len(c) != 1 || c[0].Detail != "round(number, number)" || c[0].Documentation != "rounds x to decimal places" {
+		t.Errorf("unexpected completion %+v", c)
+	}
+}
+
+func TestHover(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		offset   int
+		expected string
+	}{
+		{"1 + round(a, 2)", 4, "round(number, number)\nrounds x to decimal places"},
+		{"1 + round(a, 2)", 8, "round(number, number)\nrounds x to decimal places"},
+		{"1 + round(a, 2)", 9, ""},
+		{"1 + round(a, 2)", 10, ""}, // variable
+		{"unknown(1)", 1, ""},
+	} {
+		text, ok := Hover(tc.input, tc.offset)
+		if text != tc.expected || ok != (tc.expected != "") {
+			t.Errorf("%s at %d: expected %q but got %q, %v", tc.input, tc.offset, tc.expected, text, ok)
+		}
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected []Diagnostic
+	}{
+		{"sqrt(2) + a", nil},
+		{"1 +\n  sqrt(1, 2)", []Diagnostic{{2, 3, "sqrt: wrong number of arguments, 2 instead of 1"}}},
+		{"a = 1; 1 + / 2", []Diagnostic{{1, 12, "expected operand, found '/'"}}},
+	} {
+		if got := Diagnostics(tc.input); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%q: expected %+v but got %+v", tc.input, tc.expected, got)
+		}
+	}
+}
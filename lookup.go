@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"strconv"
+	"sync"
+)
+
+// lookupTables holds the tables of lookupTable() by name
+var (
+	lookupTablesMu sync.RWMutex
+	lookupTables   = map[string]map[string]interface{}{}
+)
+
+// RegisterLookupTable makes table available as name in lookupTable(),
+// e.g. the labels of numeric device codes:
+//
+//	eval.RegisterLookupTable("oper-status", map[string]interface{}{
+//		"1": "up", "2": "down", "3": "testing",
+//	})
+//
+// The table is copied, registering a name again replaces it.
+func RegisterLookupTable(name string, table map[string]interface{}) {
+	copied := make(map[string]interface{}, len(table))
+	for k, v := range table {
+		copied[k] = v
+	}
+	lookupTablesMu.Lock()
+	defer lookupTablesMu.Unlock()
+	lookupTables[name] = copied
+}
+
+// lookupTableByName returns the table registered as name
+func lookupTableByName(name string) (map[string]interface{}, bool) {
+	lookupTablesMu.RLock()
+	defer lookupTablesMu.RUnlock()
+	table, ok := lookupTables[name]
+	return table, ok
+}
+
+// lookupKey returns x as key of a lookup table, numbers are formatted
+// without trailing zeros so that 2 and 2.0 both match "2". ok is false
+// for other types.
+func lookupKey(x interface{}) (key string, ok bool) {
+	switch v := x.(type) {
+	case string:
+		return v, true
+	case int:
+		return strconv.Itoa(v), true
+	// e.g. variables of SNMP counters
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
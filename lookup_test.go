@@ -0,0 +1,41 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	table := map[string]interface{}{"1": "up", "2": "down", "up": 1}
+	RegisterLookupTable("oper-status", table)
+	table["3"] = "testing" // the table is copied
+
+	var tests = map[string]interface{}{
+		`lookup(0, "0","OK", "1","Degraded", "2","Failed", "unknown")`:   "OK",
+		`lookup(2.0, "0","OK", "1","Degraded", "2","Failed", "unknown")`: "Failed",
+		`lookup(7, "0","OK", "1","Degraded", "2","Failed", "unknown")`:   "unknown",
+		`lookup("b", "a", 1, "b", 2)`:                                    2,
+		`lookup(1+1, 1, "one", 2, "two")`:                                "two",
+		`lookupTable("oper-status", 1)`:                                  "up",
+		`lookupTable("oper-status", "up")`:                               1,
+		`lookupTable("oper-status", 3, "unknown")`:                       "unknown",
+		`lookup(status, "1", "up", "2", "down")`:                         "down",
+		`lookupTable("oper-status", status)`:                             "down",
+		`lookup(code, "18446744073709551615", "max", "other")`:           "max",
+	}
+	variables := map[string]interface{}{"status": int64(2), "code": uint64(math.MaxUint64)}
+	for input, expected := range tests {
+		if result, err := New(input).Variables(variables).RunErr(); err != nil || result != expected {
+			t.Errorf("%s: expected %v but got %v (%v)", input, expected, result, err)
+		}
+	}
+
+	for _, input := range []string{`lookup("c", "a", 1, "b", 2)`, `lookupTable("oper-status", 3)`, `lookup(1, 2)`} {
+		if result, _ := New(input).RunErr(); !math.IsNaN(result.(float64)) {
+			t.Errorf("%s: expected NaN but got %v", input, result)
+		}
+	}
+	if _, err := New(`lookupTable("unknown", 1)`).RunErr(); err == nil {
+		t.Error("expected an error for an unknown table")
+	}
+}
@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// currency describes the minor units and the symbol of a currency
+type currency struct {
+	minorUnits int
+	symbol     string
+}
+
+// currencies holds the currencies of money() by ISO 4217 code
+var currencies = map[string]currency{
+	"AUD": {2, "A$"},
+	"BHD": {3, "BD"},
+	"CAD": {2, "C$"},
+	"CHF": {2, "CHF"},
+	"CNY": {2, "¥"},
+	"CZK": {2, "Kč"},
+	"DKK": {2, "kr."},
+	"EUR": {2, "€"},
+	"GBP": {2, "£"},
+	"HUF": {2, "Ft"},
+	"INR": {2, "₹"},
+	"JPY": {0, "¥"},
+	"KRW": {0, "₩"},
+	"KWD": {3, "KD"},
+	"NOK": {2, "kr"},
+	"PLN": {2, "zł"},
+	"SEK": {2, "kr"},
+	"USD": {2, "$"},
+}
+
+// moneyLocale describes how amounts are written in a locale
+type moneyLocale struct {
+	decimal, group string
+	// symbolAfter writes "1,00 €" instead of "€1.00"
+	symbolAfter bool
+	// space separates symbol and amount
+	space bool
+}
+
+// moneyLocales holds the locales of money() by language tag
+var moneyLocales = map[string]moneyLocale{
+	"de":    {decimal: ",", group: ".", symbolAfter: true, space: true},
+	"de-AT": {decimal: ",", group: ".", space: true},
+	"de-CH": {decimal: ".", group: "'", space: true},
+	"en":    {decimal: ".", group: ","},
+	"es":    {decimal: ",", group: ".", symbolAfter: true, space: true},
+	"fr":    {decimal: ",", group: " ", symbolAfter: true, space: true},
+	"it":    {decimal: ",", group: ".", symbolAfter: true, space: true},
+	"nl":    {decimal: ",", group: ".", space: true},
+}
+
+// formatMoney rounds x half away from zero to the minor units of the
+// currency code and formats it with the symbol in locale. ok is false
+// for unknown currencies or locales and for NaN or infinite values.
+func formatMoney(x float64, code, locale string) (s string, ok bool) {
+	cur, found := currencies[strings.ToUpper(code)]
+	loc, known := moneyLocales[locale]
+	if !found || !known || math.IsNaN(x) || math.IsInf(x, 0) {
+		return "", false
+	}
+	// 2.675 is 2.67499... as float64, the scaled value is rounded to 6
+	// decimal places first so that it becomes 2.68
+	scale := math.Pow10(cur.minorUnits)
+	scaled, _ := strconv.ParseFloat(strconv.FormatFloat(math.Abs(x)*scale, 'f', 6, 64), 64)
+	amount := strconv.FormatFloat(math.Round(scaled)/scale, 'f', cur.minorUnits, 64)
+
+	intPart, fraction, _ := strings.Cut(amount, ".")
+	var b strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(loc.group)
+		}
+		b.WriteRune(c)
+	}
+	if fraction != "" {
+		b.WriteString(loc.decimal)
+		b.WriteString(fraction)
+	}
+
+	sep := ""
+	if loc.space {
+		sep = " "
+	}
+	sign := ""
+	if x < 0 && math.Round(scaled) != 0 {
+		sign = "-"
+	}
+	if loc.symbolAfter {
+		return sign + b.String() + sep + cur.symbol, true
+	}
+	return sign + cur.symbol + sep + b.String(), true
+}
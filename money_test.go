@@ -0,0 +1,32 @@
+package eval
+
+import "testing"
+
+func TestMoney(t *testing.T) {
+	var tests = map[string]string{
+		`money(1234.567, "EUR")`:                              "€1,234.57",
+		`money(1234.567, "EUR", "de")`:                        "1.234,57 €",
+		`money(1234.567, "EUR", "de-AT")`:                     "€ 1.234,57",
+		`money(1234567.5, "CHF", "de-CH")`:                    "CHF 1'234'567.50",
+		`money(2.675, "USD")`:                                 "$2.68",
+		`money(-2.675, "usd")`:                                "-$2.68",
+		`money(-0.001, "EUR")`:                                "€0.00",
+		`money(1234.5, "JPY")`:                                "¥1,235",
+		`money(0.5, "JPY")`:                                   "¥1",
+		`money(12.3456, "KWD")`:                               "KD12.346",
+		`money(999.999, "EUR", "fr")`:                         "1 000,00 €",
+		`money("19.9", "GBP")`:                                "£19.90",
+		`sprintf("Total: %s", money(net * 1.2, "EUR", "de"))`: "Total: 120,00 €",
+		`money(1, "XXX")`:                                     "",
+		`money(1, "EUR", "xx")`:                               "",
+		`money("a", "EUR")`:                                   "",
+		`money(1 / 0, "EUR")`:                                 "",
+	}
+	for input, expected := range tests {
+		e := New(input).Variables(map[string]interface{}{"net": 100.0})
+		_ = e.ParseExpr()
+		if result := e.Run(); result != expected {
+			t.Errorf("%s: expected %q but got %q", input, expected, result)
+		}
+	}
+}
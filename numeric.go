@@ -0,0 +1,247 @@
+package eval
+
+import (
+	"go/ast"
+	"go/token"
+	"math"
+	"strconv"
+)
+
+// numericStack is the maximum stack depth of a numeric program
+const numericStack = 32
+
+// opcode is an instruction of the numeric stack machine
+type opcode uint8
+
+const (
+	opConst opcode = iota // push x
+	opVar                 // push the float64 variable name
+	opNeg                 // negate the top of the stack
+	opAdd
+	opSub
+	opMul
+	opQuo
+	opRem
+	opEql
+	opNeq
+	opLss
+	opGtr
+	opLeq
+	opGeq
+	opAnd
+	opOr
+)
+
+// binaryOps maps the supported binary operators to their opcode
+var binaryOps = map[token.Token]opcode{
+	token.ADD:  opAdd,
+	token.SUB:  opSub,
+	token.MUL:  opMul,
+	token.QUO:  opQuo,
+	token.REM:  opRem,
+	token.EQL:  opEql,
+	token.NEQ:  opNeq,
+	token.LSS:  opLss,
+	token.GTR:  opGtr,
+	token.LEQ:  opLeq,
+	token.GEQ:  opGeq,
+	token.LAND: opAnd,
+	token.LOR:  opOr,
+}
+
+type instruction struct {
+	op   opcode
+	x    float64
+	name string
+}
+
+// kind is the static type of a sub expression
+type kind uint8
+
+const (
+	kindInt kind = iota
+	kindFloat
+	kindBool
+	kindString
+	kindUnknown
+)
+
+// numeric is a pure numeric expression compiled for a float64 stack
+// machine which runs without boxing values into interfaces. Booleans
+// are 1 and 0 on the stack.
+type numeric struct {
+	code []instruction
+	// isBool is true when the result is a bool
+	isBool bool
+}
+
+// compileNumeric compiles exp when it uses numeric literals, variables
+// and arithmetic, comparison and logical operators only. ok is false
+// for all other expressions and for arithmetic of two ints which the
+// interpreter calculates as int.
+func compileNumeric(exp ast.Expr) (n *numeric, ok bool) {
+	n = &numeric{}
+	depth, max := 0, 0
+	var compile func(exp ast.Expr) (kind, bool)
+	push := func(in instruction) {
+		n.code = append(n.code, in)
+		if depth++; depth > max {
+			max = depth
+		}
+	}
+	compile = func(exp ast.Expr) (kind, bool) {
+		switch exp := exp.(type) {
+		case *ast.ParenExpr:
+			return compile(exp.X)
+		case *ast.BasicLit:
+			switch exp.Kind {
+			case token.INT:
+				i, err := strconv.ParseInt(exp.Value, 0, 64)
+				// larger ints lose precision as float64
+				if err != nil || i > 1<<53 {
+					return 0, false
+				}
+				push(instruction{op: opConst, x: float64(i)})
+				return kindInt, true
+			case token.FLOAT:
+				f, _ := strconv.ParseFloat(exp.Value, 64)
+				push(instruction{op: opConst, x: f})
+				return kindFloat, true
+			}
+		case *ast.Ident:
+			if exp.Name == "true" || exp.Name == "false" {
+				return 0, false
+			}
+			// the type of variables is checked while running
+			push(instruction{op: opVar, name: exp.Name})
+			return kindFloat, true
+		case *ast.UnaryExpr:
+			k, ok := compile(exp.X)
+			if !ok || k == kindBool {
+				return 0, false
+			}
+			switch exp.Op {
+			case token.ADD:
+				return k, true
+			case token.SUB:
+				n.code = append(n.code, instruction{op: opNeg})
+				return k, true
+			}
+		case *ast.BinaryExpr:
+			op, ok := binaryOps[exp.Op]
+			if !ok {
+				return 0, false
+			}
+			l, ok1 := compile(exp.X)
+			r, ok2 := compile(exp.Y)
+			if !ok1 || !ok2 {
+				return 0, false
+			}
+			n.code = append(n.code, instruction{op: op})
+			depth--
+			switch op {
+			case opAnd, opOr:
+				if l != kindBool || r != kindBool {
+					return 0, false
+				}
+				return kindBool, true
+			}
+			if l == kindBool || r == kindBool {
+				return 0, false
+			}
+			switch op {
+			case opAdd, opSub, opMul, opRem:
+				if l == kindInt && r == kindInt {
+					return 0, false
+				}
+				return kindFloat, true
+			case opQuo:
+				return kindFloat, true
+			}
+			return kindBool, true
+		}
+		return 0, false
+	}
+	k, ok := compile(exp)
+	if !ok || k == kindInt || max > numericStack {
+		return nil, false
+	}
+	n.isBool = k == kindBool
+	return n, true
+}
+
+// run executes the program with variables. ok is false when a
+// variable is not a float64, the interpreter must be used then.
+func (n *numeric) run(variables map[string]interface{}) (result float64, ok bool) {
+	var stack [numericStack]float64
+	sp := 0
+	for _, in := range n.code {
+		switch in.op {
+		case opConst:
+			stack[sp] = in.x
+			sp++
+			continue
+		case opVar:
+			v, found := variables[in.name]
+			f, isFloat := v.(float64)
+			if found && !isFloat {
+				return 0, false
+			}
+			if !found {
+				f = FloatError
+			}
+			stack[sp] = f
+			sp++
+			continue
+		case opNeg:
+			stack[sp-1] = -stack[sp-1]
+			continue
+		}
+		sp--
+		l, r := stack[sp-1], stack[sp]
+		var x float64
+		switch in.op {
+		case opAdd:
+			x = l + r
+		case opSub:
+			x = l - r
+		case opMul:
+			x = l * r
+		case opQuo:
+			// like the interpreter
+			if r == 0 {
+				x = math.Inf(1)
+			} else {
+				x = l / r
+			}
+		case opRem:
+			x = math.Mod(l, r)
+		case opEql:
+			x = truth(l == r)
+		case opNeq:
+			x = truth(l != r)
+		case opLss:
+			x = truth(l < r)
+		case opGtr:
+			x = truth(l > r)
+		case opLeq:
+			x = truth(l <= r)
+		case opGeq:
+			x = truth(l >= r)
+		case opAnd:
+			x = truth(l != 0 && r != 0)
+		case opOr:
+			x = truth(l != 0 || r != 0)
+		}
+		stack[sp-1] = x
+	}
+	return stack[0], true
+}
+
+// truth converts b to 1 or 0
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+package eval
+
+import (
+	"math"
+	"testing"
+)
+
+// TestNumeric checks that the numeric fast path calculates
+// the same results as the interpreter
+func TestNumeric(t *testing.T) {
+	variables := map[string]interface{}{
+		"a":   2.5,
+		"b":   -4.0,
+		"in":  1200.0,
+		"out": 150.0,
+		"nan": math.NaN(),
+	}
+	for _, s := range []string{
+		`1.5 + 2`,
+		`2 / 4`,
+		`-a * 2`,
+		`+a - -b`,
+		`(in - out) / in * 100`,
+		`(in-out)/in*100 > 80`,
+		`a / 0`,
+		`-1 / 0`,
+		`a == 2.5 && b != 4`,
+		`a != 2`,
+		`2 != a`,
+		`a < b || b <= -4`,
+		`a >= 2 && a > 2.5`,
+		`missing + 1.0`,
+		`nan == nan`,
+		`1 < 2`,
+		`((((a))))`,
+	} {
+		c := MustCompile(s)
+		if c.numeric == nil {
+			t.Errorf("%s: expected the fast path", s)
+			continue
+		}
+		want, _ := (&Compiled{input: c.input, exp: c.exp}).Run(variables)
+		got, err := c.Run(variables)
+		if err != nil || !sameResult(got, want) {
+			t.Errorf("%s: expected %v (%T) but got %v (%T), %v", s, want, want, got, got, err)
+		}
+	}
+
+	// expressions for the interpreter
+	for _, s := range []string{
+		`1 + 2`,
+		`-3`,
+		`a + (1 + 2)`, // 1 + 2 is an int
+		`abs(a)`,
+		`"a" == "a"`,
+		`true && a > 1`,
+		`1 | 2`,
+		`99999999999999999 > a`,
+	} {
+		if MustCompile(s).numeric != nil {
+			t.Errorf("%s: expected the interpreter", s)
+		}
+	}
+
+	// variables of other types fall back to the interpreter
+	c := MustCompile(`a * 2.0 + 1.0`)
+	for _, a := range []interface{}{2, "2"} {
+		want, _ := (&Compiled{input: c.input, exp: c.exp}).Run(map[string]interface{}{"a": a})
+		if got, _ := c.Run(map[string]interface{}{"a": a}); !sameResult(got, want) {
+			t.Errorf("a = %#v: expected %v but got %v", a, want, got)
+		}
+	}
+}
+
+func sameResult(a, b interface{}) bool {
+	fa, ok1 := a.(float64)
+	fb, ok2 := b.(float64)
+	if ok1 && ok2 && math.IsNaN(fa) && math.IsNaN(fb) {
+		return true
+	}
+	return a == b
+}
+
+func BenchmarkCompiledNumeric(b *testing.B) {
+	c := MustCompile(`(in-out)/in*100 > 80`)
+	variables := map[string]interface{}{"in": 1200.0, "out": 150.0}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Run(variables)
+	}
+}
+
+func BenchmarkCompiledInterpreter(b *testing.B) {
+	c := MustCompile(`(in-out)/in*100 > 80`)
+	c = &Compiled{input: c.input, exp: c.exp}
+	variables := map[string]interface{}{"in": 1200.0, "out": 150.0}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = c.Run(variables)
+	}
+}
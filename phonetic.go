@@ -0,0 +1,186 @@
+package eval
+
+import (
+	"strings"
+)
+
+// soundex returns the American Soundex code of s, e.g. "R163" for
+// "Robert". Characters other than ASCII letters are ignored.
+func soundex(s string) string {
+	const codes = "01230120022455012623010202" // A..Z
+	var b strings.Builder
+	var last byte
+	for _, r := range strings.ToUpper(s) {
+		if r < 'A' || r > 'Z' {
+			continue
+		}
+		code := codes[r-'A']
+		if b.Len() == 0 {
+			b.WriteRune(r)
+			last = code
+			continue
+		}
+		switch {
+		case r == 'H' || r == 'W':
+			// h and w do not separate equal codes
+		case code == '0':
+			last = code
+		case code != last:
+			b.WriteByte(code)
+			last = code
+		}
+		if b.Len() == 4 {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	for b.Len() < 4 {
+		b.WriteByte('0')
+	}
+	return b.String()[:4]
+}
+
+// metaphone returns the Metaphone key of s as described by
+// Lawrence Philips in 1990. '0' stands for the "th" sound.
+// Characters other than ASCII letters are ignored.
+func metaphone(s string) string {
+	var w []byte
+	for _, r := range strings.ToUpper(s) {
+		if r >= 'A' && r <= 'Z' {
+			w = append(w, byte(r))
+		}
+	}
+	if len(w) == 0 {
+		return ""
+	}
+
+	at := func(i int) byte {
+		if i < 0 || i >= len(w) {
+			return 0
+		}
+		return w[i]
+	}
+	isVowel := func(c byte) bool { return c != 0 && strings.IndexByte("AEIOU", c) >= 0 }
+	isFront := func(c byte) bool { return c == 'E' || c == 'I' || c == 'Y' }
+
+	// initial letter exceptions
+	prefix := string(w)
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	switch {
+	case prefix == "AE", prefix == "GN", prefix == "KN", prefix == "PN", prefix == "WR":
+		w = w[1:]
+	case prefix == "WH":
+		w = append([]byte{'W'}, w[2:]...)
+	case w[0] == 'X':
+		w[0] = 'S'
+	}
+
+	var key strings.Builder
+	for i := 0; i < len(w); i++ {
+		c := w[i]
+		if c == at(i-1) && c != 'C' {
+			continue
+		}
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if i == 0 {
+				key.WriteByte(c)
+			}
+		case 'B':
+			if !(at(i-1) == 'M' && i == len(w)-1) {
+				key.WriteByte('B')
+			}
+		case 'C':
+			switch {
+			case at(i+1) == 'I' && at(i+2) == 'A':
+				key.WriteByte('X')
+			case at(i+1) == 'H':
+				if at(i-1) == 'S' {
+					key.WriteByte('K')
+				} else {
+					key.WriteByte('X')
+				}
+				i++
+			case isFront(at(i + 1)):
+				if at(i-1) != 'S' {
+					key.WriteByte('S')
+				}
+			default:
+				key.WriteByte('K')
+			}
+		case 'D':
+			if at(i+1) == 'G' && isFront(at(i+2)) {
+				key.WriteByte('J')
+				i++
+			} else {
+				key.WriteByte('T')
+			}
+		case 'G':
+			switch {
+			case at(i+1) == 'H' && !(i+2 >= len(w) || isVowel(at(i+2))):
+				// silent as in "night"
+			case at(i+1) == 'N' && (i+2 == len(w) || (at(i+2) == 'E' && at(i+3) == 'D' && i+4 == len(w))):
+				// silent as in "sign" or "signed"
+			case isFront(at(i+1)) && at(i-1) != 'G':
+				key.WriteByte('J')
+			default:
+				key.WriteByte('K')
+			}
+		case 'H':
+			if isVowel(at(i+1)) && strings.IndexByte("CGPST", at(i-1)) < 0 {
+				key.WriteByte('H')
+			}
+		case 'K':
+			if at(i-1) != 'C' {
+				key.WriteByte('K')
+			}
+		case 'P':
+			if at(i+1) == 'H' {
+				key.WriteByte('F')
+			} else {
+				key.WriteByte('P')
+			}
+		case 'Q':
+			key.WriteByte('K')
+		case 'S':
+			switch {
+			case at(i+1) == 'H':
+				key.WriteByte('X')
+				i++
+			case at(i+1) == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				key.WriteByte('X')
+			default:
+				key.WriteByte('S')
+			}
+		case 'T':
+			switch {
+			case at(i+1) == 'I' && (at(i+2) == 'O' || at(i+2) == 'A'):
+				key.WriteByte('X')
+			case at(i+1) == 'H':
+				key.WriteByte('0')
+				i++
+			case at(i+1) == 'C' && at(i+2) == 'H':
+				// silent as in "watch"
+			default:
+				key.WriteByte('T')
+			}
+		case 'V':
+			key.WriteByte('F')
+		case 'W', 'Y':
+			if isVowel(at(i + 1)) {
+				key.WriteByte(c)
+			}
+		case 'X':
+			key.WriteString("KS")
+		case 'Z':
+			key.WriteByte('S')
+		default: // F, J, L, M, N, R
+			key.WriteByte(c)
+		}
+	}
+	return key.String()
+}
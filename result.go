@@ -0,0 +1,64 @@
+package eval
+
+import (
+	"math"
+	"strings"
+)
+
+// State is the state of a check in a Result, the values are those of
+// the exit codes of monitoring plugins
+type State int
+
+const (
+	// StateOK is a check without problems, the default of result()
+	StateOK State = iota
+	// StateWarning is a check above a warning threshold
+	StateWarning
+	// StateCritical is a check which needs attention now
+	StateCritical
+	// StateUnknown is a check which failed to get its value
+	StateUnknown
+)
+
+// stateNames are the names of the States accepted by result()
+var stateNames = []string{"ok", "warning", "critical", "unknown"}
+
+// String returns the name of s like "warning"
+func (s State) String() string {
+	if s < StateOK || s > StateUnknown {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// Result is the structured outcome of a check returned by result(),
+// e.g. 'result(usage, "%", ifExpr(usage > 90, "critical", "ok"), "disk
+// /var")'. Hosts get it with a type assertion of the result of Run:
+//
+//	if r, ok := result.(eval.Result); ok && r.State != eval.StateOK {
+//	  alert(r.Text, r.Value, r.Unit)
+//	}
+type Result struct {
+	Value interface{} `json:"value"`
+	Unit  string      `json:"unit,omitempty"`
+	State State       `json:"state"`
+	Text  string      `json:"text,omitempty"`
+}
+
+// parseState returns the State of a number 0..3 or of a name like
+// "warning", ok is false for other values
+func parseState(x interface{}) (State, bool) {
+	if s, ok := x.(string); ok {
+		for i, name := range stateNames {
+			if strings.EqualFold(s, name) {
+				return State(i), true
+			}
+		}
+		return 0, false
+	}
+	f := toNumber(x)
+	if f != math.Trunc(f) || f < float64(StateOK) || f > float64(StateUnknown) {
+		return 0, false
+	}
+	return State(f), true
+}
@@ -0,0 +1,74 @@
+package eval
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestResult(t *testing.T) {
+	variables := map[string]interface{}{"usage": 95.5, "name": "/var"}
+	for input, expected := range map[string]Result{
+		`result(usage)`:                       {Value: 95.5},
+		`result(usage, "%")`:                  {Value: 95.5, Unit: "%"},
+		`result(1, "", 2)`:                    {Value: 1, State: StateCritical},
+		`result("up", "", "Warning", "link")`: {Value: "up", State: StateWarning, Text: "link"},
+		`result(usage, "%", ifExpr(usage > 90, "critical", "ok"), sprintf("disk %s", name))`: {
+			Value: 95.5, Unit: "%", State: StateCritical, Text: "disk /var"},
+	} {
+		result, err := New(input).Variables(variables).RunErr()
+		r, ok := result.(Result)
+		if err != nil || !ok {
+			t.Errorf("%s: expected a Result but got %v, %v", input, result, err)
+			continue
+		}
+		if r != expected {
+			t.Errorf("%s: expected %+v but got %+v", input, expected, r)
+		}
+	}
+
+	// results pass through branches and variables
+	for _, input := range []string{
+		`ifExpr(usage > 90, result(usage, "%", 2), result(usage, "%", 0))`,
+		`switchExpr(usage > 90, true, result(usage, "%", 2), result(usage, "%", 0))`,
+		`switchExpr(1, 0, 0, result(usage, "%", 2))`,
+		`r = result(usage, "%", 2); r`,
+		`setVal("r", result(usage, "%", 2)); r`,
+		`let("r", result(usage, "%", 2), r)`,
+	} {
+		result, err := New(input).Variables(variables).RunErr()
+		if expected := (Result{Value: 95.5, Unit: "%", State: StateCritical}); result != expected || err != nil {
+			t.Errorf("%s: expected %+v but got %+v, %v", input, expected, result, err)
+		}
+	}
+
+	// failed metrics are reported as unknown
+	r, _ := New(`result(x, "", ifExpr(isNaN(x), "unknown", "ok"))`).RunErr()
+	if r, ok := r.(Result); !ok || !math.IsNaN(r.Value.(float64)) || r.State != StateUnknown {
+		t.Errorf("expected an unknown NaN Result but got %v", r)
+	}
+
+	for _, input := range []string{
+		`result(1, 2)`,
+		`result(1, "", 4)`,
+		`result(1, "", 1.5)`,
+		`result(1, "", "bad")`,
+		`result(1, "", 0, 1)`,
+	} {
+		result, _ := New(input).RunErr()
+		if f, ok := result.(float64); !ok || !math.IsNaN(f) {
+			t.Errorf("%s: expected NaN but got %v", input, result)
+		}
+	}
+
+	if s := StateWarning.String(); s != "warning" {
+		t.Errorf("expected warning but got %s", s)
+	}
+	if s := State(7).String(); s != "unknown" {
+		t.Errorf("expected unknown but got %s", s)
+	}
+	b, _ := json.Marshal(Result{Value: 1.5, Unit: "%", State: StateWarning})
+	if string(b) != `{"value":1.5,"unit":"%","state":1}` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+}
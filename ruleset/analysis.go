@@ -0,0 +1,130 @@
+package ruleset
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/itdesign-at/eval"
+)
+
+// Usage lists the rules reading and writing a variable
+type Usage struct {
+	ReadBy    []string
+	WrittenBy []string
+}
+
+// Analysis is the where-used report of rules, see Analyze()
+type Analysis struct {
+	// Variables maps each variable to the rules using it
+	Variables map[string]Usage
+	// Cycles lists groups of rules depending on each other,
+	// New rejects such rules
+	Cycles [][]string
+	// Dead lists rules writing variables which no other rule reads
+	Dead []string
+}
+
+// Analyze reports for each variable which rules read or write it and
+// finds cycles and dead rules, e.g. before refactoring large rulesets.
+// Unlike New it accepts cyclic rules, it returns parser errors only.
+func Analyze(rules []Rule) (*Analysis, error) {
+	a := &Analysis{Variables: make(map[string]Usage)}
+	compiled := make([]*eval.Compiled, len(rules))
+	for i, r := range rules {
+		c, err := eval.Compile(r.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		compiled[i] = c
+		for _, name := range c.Reads() {
+			u := a.Variables[name]
+			u.ReadBy = append(u.ReadBy, r.Name)
+			a.Variables[name] = u
+		}
+		for _, name := range writes(r, c) {
+			u := a.Variables[name]
+			u.WrittenBy = append(u.WrittenBy, r.Name)
+			a.Variables[name] = u
+		}
+	}
+
+	for i, r := range rules {
+		w := writes(r, compiled[i])
+		if len(w) == 0 {
+			continue
+		}
+		read := false
+		for _, name := range w {
+			for _, reader := range a.Variables[name].ReadBy {
+				read = read || reader != r.Name
+			}
+		}
+		if !read {
+			a.Dead = append(a.Dead, r.Name)
+		}
+	}
+
+	a.Cycles = cycles(rules, a.Variables)
+	return a, nil
+}
+
+// cycles returns the strongly connected groups of more than one rule
+// of the dependency graph using Tarjan's algorithm
+func cycles(rules []Rule, variables map[string]Usage) [][]string {
+	// edges from a rule to the rules it depends on
+	edges := make(map[string][]string)
+	for _, u := range variables {
+		for _, reader := range u.ReadBy {
+			for _, writer := range u.WrittenBy {
+				if reader != writer {
+					edges[reader] = append(edges[reader], writer)
+				}
+			}
+		}
+	}
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var result [][]string
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = len(index)
+		low[name] = index[name]
+		stack = append(stack, name)
+		onStack[name] = true
+		for _, dep := range edges[name] {
+			if _, visited := index[dep]; !visited {
+				connect(dep)
+				if low[dep] < low[name] {
+					low[name] = low[dep]
+				}
+			} else if onStack[dep] && index[dep] < low[name] {
+				low[name] = index[dep]
+			}
+		}
+		if low[name] != index[name] {
+			return
+		}
+		var group []string
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			group = append(group, n)
+			if n == name {
+				break
+			}
+		}
+		if len(group) > 1 {
+			sort.Strings(group)
+			result = append(result, group)
+		}
+	}
+	for _, r := range rules {
+		if _, visited := index[r.Name]; !visited {
+			connect(r.Name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package ruleset
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	a, err := Analyze([]Rule{
+		{Name: "usage", Expression: "(size-used)/size*100", Output: "usage"},
+		{Name: "alarm", Expression: "usage > limit"},
+		{Name: "unused", Expression: `setVal("tmp", size*2)`},
+		{Name: "a", Expression: "b + 1", Output: "a"},
+		{Name: "b", Expression: "c + 1", Output: "b"},
+		{Name: "c", Expression: "a + 1", Output: "c"},
+		{Name: "self", Expression: "self + 1", Output: "self"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"size":  "[usage unused] []",
+		"usage": "[alarm] [usage]",
+		"limit": "[alarm] []",
+		"tmp":   "[] [unused]",
+		"a":     "[c] [a]",
+		"self":  "[self] [self]",
+	} {
+		u := a.Variables[name]
+		if got := fmt.Sprint(u.ReadBy, " ", u.WrittenBy); got != want {
+			t.Errorf("%s: expected %s but got %s", name, want, got)
+		}
+	}
+	if got := fmt.Sprint(a.Dead); got != "[unused self]" {
+		t.Errorf("unexpected dead rules %s", got)
+	}
+	if got := fmt.Sprint(a.Cycles); got != "[[a b c]]" {
+		t.Errorf("unexpected cycles %s", got)
+	}
+
+	if _, err := Analyze([]Rule{{Name: "x", Expression: "("}}); err == nil {
+		t.Errorf("expected a parser error")
+	}
+}
@@ -0,0 +1,201 @@
+// Package ruleset loads bundles of named expressions, orders them by
+// the variables they read and write and evaluates them in one call.
+//
+// A ruleset file is JSON:
+//
+//  {
+//    "rules": [
+//      {"name": "usage", "expression": "(in-out)/in*100", "output": "usage"},
+//      {"name": "alarm", "expression": "usage > 80", "description": "disk almost full"}
+//    ]
+//  }
+//
+// Rule "alarm" reads the output of "usage" and runs after it, no matter
+// in which order the rules are listed.
+//
+// Other formats are read by LoadWith and ParseWith with the unmarshal
+// function of a package of your choice, e.g. a YAML file with
+//
+//  rs, err := ruleset.LoadWith("disk.yaml", yaml.Unmarshal)
+package ruleset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/itdesign-at/eval"
+)
+
+// Rule is a named expression
+type Rule struct {
+	// Name identifies the rule in the results
+	Name string `json:"name" yaml:"name"`
+	// Expression is evaluated by Run
+	Expression string `json:"expression" yaml:"expression"`
+	// Description is an optional text for humans
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Output is the optional variable the result is stored in
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
+// Ruleset is a compiled bundle of rules in the order of their
+// dependencies, it is created by Load, Parse or New.
+type Ruleset struct {
+	rules    []Rule
+	compiled []*eval.Compiled
+}
+
+// Load reads the JSON ruleset file path, see Parse()
+func Load(path string) (*Ruleset, error) {
+	return LoadWith(path, json.Unmarshal)
+}
+
+// LoadWith reads the ruleset file path decoded by unmarshal,
+// see ParseWith()
+func LoadWith(path string, unmarshal func(data []byte, v interface{}) error) (*Ruleset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseWith(data, unmarshal)
+}
+
+// Parse decodes a JSON ruleset, see New()
+func Parse(data []byte) (*Ruleset, error) {
+	return ParseWith(data, json.Unmarshal)
+}
+
+// ParseWith decodes a ruleset with unmarshal like json.Unmarshal or
+// the Unmarshal function of a YAML package, the top level key "rules"
+// holds the list of rules. See New()
+func ParseWith(data []byte, unmarshal func(data []byte, v interface{}) error) (*Ruleset, error) {
+	var file struct {
+		Rules []Rule `json:"rules" yaml:"rules"`
+	}
+	if err := unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	return New(file.Rules)
+}
+
+// New compiles rules and orders them so that rules writing a variable,
+// with setVal or as Output, run before the rules reading it. The order
+// of independent rules is kept. It returns an error for duplicate names,
+// parser errors and cyclic dependencies.
+func New(rules []Rule) (*Ruleset, error) {
+	compiled := make([]*eval.Compiled, len(rules))
+	names := make(map[string]bool, len(rules))
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule %d: missing name", i+1)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+		c, err := eval.Compile(r.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		compiled[i] = c
+	}
+	order, err := sortRules(rules, compiled)
+	if err != nil {
+		return nil, err
+	}
+	rs := &Ruleset{}
+	for _, i := range order {
+		rs.rules = append(rs.rules, rules[i])
+		rs.compiled = append(rs.compiled, compiled[i])
+	}
+	return rs, nil
+}
+
+// Rules returns the rules in the order they are run
+func (rs *Ruleset) Rules() []Rule {
+	return append([]Rule(nil), rs.rules...)
+}
+
+// Run evaluates all rules against env and returns their results by
+// name. Outputs are set in env before the next rule runs. A failing
+// rule doesn't stop the others, the first error is returned.
+func (rs *Ruleset) Run(env *eval.Environment) (map[string]interface{}, error) {
+	results := make(map[string]interface{}, len(rs.rules))
+	var first error
+	for i, r := range rs.rules {
+		result, err := env.Run(rs.compiled[i])
+		if err != nil && first == nil {
+			first = fmt.Errorf("rule %q: %w", r.Name, err)
+		}
+		if r.Output != "" {
+			env.Set(r.Output, result)
+		}
+		results[r.Name] = result
+	}
+	return results, first
+}
+
+// writes returns the variables written by rule r
+func writes(r Rule, c *eval.Compiled) []string {
+	w := c.Writes()
+	if r.Output != "" {
+		w = append(w, r.Output)
+	}
+	return w
+}
+
+// sortRules returns the indexes of rules in topological order of their
+// dependencies. Among the rules ready to run the first listed wins.
+func sortRules(rules []Rule, compiled []*eval.Compiled) ([]int, error) {
+	writers := make(map[string][]int)
+	for i, r := range rules {
+		for _, name := range writes(r, compiled[i]) {
+			writers[name] = append(writers[name], i)
+		}
+	}
+	// dependents[j] lists the rules which have to wait for rule j
+	dependents := make([][]int, len(rules))
+	waiting := make([]int, len(rules))
+	for i := range rules {
+		seen := make(map[int]bool)
+		for _, name := range compiled[i].Reads() {
+			for _, j := range writers[name] {
+				if j != i && !seen[j] {
+					seen[j] = true
+					dependents[j] = append(dependents[j], i)
+					waiting[i]++
+				}
+			}
+		}
+	}
+	var ready, order []int
+	for i := range rules {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Ints(ready)
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, i)
+		for _, j := range dependents[i] {
+			if waiting[j]--; waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	if len(order) < len(rules) {
+		var cyclic []string
+		for i, r := range rules {
+			if waiting[i] > 0 {
+				cyclic = append(cyclic, r.Name)
+			}
+		}
+		return nil, fmt.Errorf("cyclic dependencies between rules %s", strings.Join(cyclic, ", "))
+	}
+	return order, nil
+}
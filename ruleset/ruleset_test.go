@@ -0,0 +1,153 @@
+package ruleset
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/itdesign-at/eval"
+)
+
+const disk = `{
+  "rules": [
+    {"name": "alarm", "expression": "usage > 80 && val(\"free\") < 100", "description": "disk almost full"},
+    {"name": "usage", "expression": "(size-used)/size*100", "output": "usage"},
+    {"name": "free", "expression": "setVal(\"free\", size-used)"},
+    {"name": "unrelated", "expression": "1.5 * 2"}
+  ]
+}`
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.json")
+	if err := os.WriteFile(path, []byte(disk), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range rs.Rules() {
+		names = append(names, r.Name)
+	}
+	if got := strings.Join(names, " "); got != "usage free alarm unrelated" {
+		t.Errorf("unexpected order %s", got)
+	}
+
+	env := eval.NewEnvironment().Set("size", 1000.0).Set("used", 50.0)
+	results, err := rs.Run(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]interface{}{
+		"usage":     95.0,
+		"alarm":     false,
+		"unrelated": 3.0,
+	} {
+		if results[name] != want {
+			t.Errorf("%s: expected %v but got %v", name, want, results[name])
+		}
+	}
+	if usage, _ := env.Get("usage"); usage != 95.0 {
+		t.Errorf("expected the output usage to be set but got %v", usage)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+// unmarshalLines decodes lines "name: expression" like a tiny YAML
+// subset to test LoadWith
+func unmarshalLines(data []byte, v interface{}) error {
+	var rules []Rule
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		name, expression, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("invalid line %q", line)
+		}
+		rules = append(rules, Rule{Name: strings.TrimSpace(name), Expression: strings.TrimSpace(expression)})
+	}
+	data, err := json.Marshal(map[string]interface{}{"rules": rules})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func TestLoadWith(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.txt")
+	if err := os.WriteFile(path, []byte("alarm: usage > 80\nusage: setVal(\"usage\", used/size*100)\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := LoadWith(path, unmarshalLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := rs.Run(eval.NewEnvironment().Set("size", 100.0).Set("used", 90.0))
+	if err != nil || results["alarm"] != true {
+		t.Errorf("expected an alarm but got %v, %v", results, err)
+	}
+
+	if _, err := ParseWith([]byte("broken"), unmarshalLines); err == nil {
+		t.Errorf("expected the error of unmarshal")
+	}
+	if _, err := LoadWith(filepath.Join(t.TempDir(), "missing.txt"), unmarshalLines); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, tc := range []struct {
+		rules []Rule
+		err   string
+	}{
+		{[]Rule{{Name: "a", Expression: "1 +"}}, `rule "a"`},
+		{[]Rule{{Expression: "1"}}, "missing name"},
+		{[]Rule{{Name: "a", Expression: "1"}, {Name: "a", Expression: "2"}}, "duplicate"},
+		{[]Rule{
+			{Name: "a", Expression: "b + 1", Output: "a"},
+			{Name: "b", Expression: "a + 1", Output: "b"},
+			{Name: "c", Expression: "a"},
+		}, "cyclic dependencies between rules a, b, c"},
+	} {
+		if _, err := New(tc.rules); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expected error %q but got %v", tc.err, err)
+		}
+	}
+
+	// a rule reading its own output is no cycle
+	rs, err := New([]Rule{{Name: "n", Expression: "n + 1.0", Output: "n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := eval.NewEnvironment().Set("n", 1.0)
+	_, _ = rs.Run(env)
+	if results, _ := rs.Run(env); results["n"] != 3.0 {
+		t.Errorf("expected 3 but got %v", results["n"])
+	}
+
+	if _, err := Parse([]byte("[")); err == nil {
+		t.Errorf("expected an error for broken JSON")
+	}
+}
+
+func TestRunError(t *testing.T) {
+	rs, err := New([]Rule{
+		{Name: "broken", Expression: "unknown()"},
+		{Name: "ok", Expression: "2.5 * 2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := rs.Run(eval.NewEnvironment())
+	if err == nil || !strings.Contains(err.Error(), `rule "broken"`) {
+		t.Errorf("expected an error of rule broken but got %v", err)
+	}
+	if results["ok"] != 5.0 {
+		t.Errorf("expected the other rules to run but got %v", results)
+	}
+}
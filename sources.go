@@ -0,0 +1,111 @@
+package eval
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// Clock is the source of the current time of time(), ageSeconds() and
+// the stateful functions like throttle(), e.g. a fixed time in unit
+// tests of rules, see Eval.Clock()
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a function used as Clock
+type ClockFunc func() time.Time
+
+// Now calls f()
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// now returns the current time of the Clock of the Environment or of
+// the Eval, the time of the system without one
+func (e *Eval) now() time.Time {
+	if e.environment != nil && e.environment.clock != nil {
+		return e.environment.clock.Now()
+	}
+	if e.clock != nil {
+		return e.clock.Now()
+	}
+	return now()
+}
+
+// rand returns the random number generator of the Environment or of the
+// Eval, nil when random numbers are read from crypto/rand
+func (e *Eval) rand() *rand.Rand {
+	if e.environment != nil && e.environment.random != nil {
+		return e.environment.random
+	}
+	return e.random
+}
+
+// randomBytes fills b with random bytes
+func (e *Eval) randomBytes(b []byte) {
+	if r := e.rand(); r != nil {
+		_, _ = r.Read(b)
+		return
+	}
+	_, _ = crand.Read(b)
+}
+
+// randomFloat returns a random number in [0, 1)
+func (e *Eval) randomFloat() float64 {
+	if r := e.rand(); r != nil {
+		return r.Float64()
+	}
+	var b [8]byte
+	_, _ = crand.Read(b[:])
+	return float64(binary.BigEndian.Uint64(b[:])>>11) / (1 << 53)
+}
+
+// randomInt returns a random int in [0, n), n must be > 0
+func (e *Eval) randomInt(n int) int {
+	if r := e.rand(); r != nil {
+		return r.Intn(n)
+	}
+	i, err := crand.Int(crand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0
+	}
+	return int(i.Int64())
+}
+
+// environVars returns the environment variables of the Environment or
+// of the Eval, nil when the environment of the process is used
+func (e *Eval) environVars() map[string]string {
+	if e.environment != nil && e.environment.environ != nil {
+		return e.environment.environ
+	}
+	return e.environ
+}
+
+// getenv returns the environment variable key
+func (e *Eval) getenv(key string) string {
+	if environ := e.environVars(); environ != nil {
+		return environ[key]
+	}
+	return os.Getenv(key)
+}
+
+// setenv sets the environment variable key
+func (e *Eval) setenv(key, value string) error {
+	if environ := e.environVars(); environ != nil {
+		environ[key] = value
+		return nil
+	}
+	return os.Setenv(key, value)
+}
+
+// uuidString formats 16 random bytes as UUID version 4
+func uuidString(b [16]byte) string {
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,111 @@
+package eval
+
+import (
+	"math/rand"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := ClockFunc(func() time.Time { return at })
+	for input, expected := range map[string]interface{}{
+		`time("now", "epoch")`:   at.Unix(),
+		`time("now", "rfc3339")`: "2024-01-01T12:00:00Z",
+		`ageSeconds(1704110340)`: 60.0,
+	} {
+		if result, err := New(input).Clock(clock).RunErr(); err != nil || result != expected {
+			t.Errorf("%s: expected %v but got %v, %v", input, expected, result, err)
+		}
+	}
+
+	env := NewEnvironment().Clock(clock)
+	c := MustCompile(`throttle("mail", 1, 60)`)
+	for i, expected := range []bool{true, false, true} {
+		if i == 2 {
+			at = at.Add(time.Minute)
+		}
+		if r, _ := env.Run(c); r != expected {
+			t.Errorf("%d: expected %v but got %v", i, expected, r)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	run := func(input string) []interface{} {
+		e := New(input).Rand(rand.New(rand.NewSource(1)))
+		_ = e.ParseExpr()
+		var results []interface{}
+		for i := 0; i < 3; i++ {
+			results = append(results, e.Run())
+		}
+		return results
+	}
+	for _, input := range []string{`random()`, `random(6)`, `uuid()`} {
+		a, b := run(input), run(input)
+		for i := range a {
+			if a[i] != b[i] {
+				t.Errorf("%s: expected the same results but got %v and %v", input, a, b)
+			}
+		}
+		if a[0] == a[1] && a[1] == a[2] {
+			t.Errorf("%s: expected different numbers but got %v", input, a)
+		}
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for i := 0; i < 20; i++ {
+		f, _ := New(`random()`).RunErr()
+		if f := f.(float64); f < 0 || f >= 1 {
+			t.Errorf("random() out of range: %v", f)
+		}
+		n, _ := New(`random(3)`).RunErr()
+		if n := n.(int); n < 0 || n >= 3 {
+			t.Errorf("random(3) out of range: %v", n)
+		}
+		if s, _ := New(`uuid()`).RunErr(); !uuid.MatchString(s.(string)) {
+			t.Errorf("invalid UUID %v", s)
+		}
+	}
+	if u1, u2 := New(`uuid()`).Run(), New(`uuid()`).Run(); u1 == u2 {
+		t.Errorf("expected different UUIDs but got %v", u1)
+	}
+	for _, input := range []string{`random(0)`, `random(1.5)`, `random("a")`} {
+		if _, ok := New(input).Run().(float64); !ok {
+			t.Errorf("%s: expected NaN", input)
+		}
+	}
+
+	env := NewEnvironment().Rand(rand.New(rand.NewSource(7)))
+	r1, _ := env.Run(MustCompile(`uuid()`))
+	env.Rand(rand.New(rand.NewSource(7)))
+	if r2, _ := env.Run(MustCompile(`uuid()`)); r1 != r2 {
+		t.Errorf("expected %v but got %v", r1, r2)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	const key = "EVAL_ENVIRON_TEST"
+	vars := map[string]string{key: "test"}
+	e := New(`env("` + key + `")`).Environ(vars)
+	if r, _ := e.RunErr(); r != "test" {
+		t.Errorf("expected test but got %v", r)
+	}
+	if r, _ := New(`setEnv("` + key + `", "set"); env("` + key + `")`).Environ(vars).AllowSetEnv(true).RunErr(); r != "set" || vars[key] != "set" {
+		t.Errorf("expected set but got %v", r)
+	}
+	if _, ok := os.LookupEnv(key); ok {
+		t.Errorf("%s was set in the process", key)
+	}
+
+	env := NewEnvironment().Environ(map[string]string{"HOME": "/home/test"})
+	if r, _ := env.Run(MustCompile(`env("HOME")`)); r != "/home/test" {
+		t.Errorf("expected /home/test but got %v", r)
+	}
+	c, _ := New(`env("PATH")`).Environ(map[string]string{}).Compile()
+	if r, _ := c.Run(nil); r != "" {
+		t.Errorf("expected an empty PATH but got %v", r)
+	}
+}
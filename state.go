@@ -0,0 +1,196 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StateStore keeps the state of stateful functions like throttle(),
+// cache(), counterInc() and counterGet() between runs. Values are
+// float64, strings, slices and maps which can be encoded as JSON.
+type StateStore interface {
+	// Get returns the value of key, ok is false when key is not set
+	Get(key string) (value interface{}, ok bool)
+	// Set sets key to value
+	Set(key string, value interface{}) error
+	// Snapshot returns a copy of all keys and values
+	Snapshot() map[string]interface{}
+}
+
+// MemoryStore is a StateStore which keeps the state in memory,
+// it is used when no other StateStore is set.
+type MemoryStore struct {
+	mu    sync.Mutex
+	state map[string]interface{}
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: make(map[string]interface{})}
+}
+
+// Get returns the value of key
+func (s *MemoryStore) Get(key string) (interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.state[key]
+	return value, ok
+}
+
+// Set sets key to value
+func (s *MemoryStore) Set(key string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[key] = value
+	return nil
+}
+
+// Snapshot returns a copy of all keys and values
+func (s *MemoryStore) Snapshot() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snapshot := make(map[string]interface{}, len(s.state))
+	for k, v := range s.state {
+		snapshot[k] = v
+	}
+	return snapshot
+}
+
+// FileStore is a StateStore which writes the state as JSON to a file
+// on every change, so the state survives restarts of the process.
+//
+// Example:
+//  store, err := eval.NewFileStore("/var/lib/checks/state.json")
+//  if err != nil { ... }
+//  env := eval.NewEnvironment().StateStore(store)
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// NewFileStore returns a FileStore writing to path. The state is
+// loaded from path when the file exists. Numbers are loaded with their
+// type, ints as int and float64 values as float64.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: MemoryStore{state: make(map[string]interface{})}, path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&s.state); err != nil {
+		return nil, err
+	}
+	if s.state == nil {
+		s.state = make(map[string]interface{})
+	}
+	for k, v := range s.state {
+		s.state[k] = loadedValue(v)
+	}
+	return s, nil
+}
+
+// Set sets key to value and writes the state to the file. The file
+// is replaced atomically, it is never left half written. Values which
+// can't be encoded as JSON like math.NaN() are rejected, the state is
+// changed only when the file was written.
+func (s *FileStore) Set(key string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := make(map[string]interface{}, len(s.state)+1)
+	for k, v := range s.state {
+		state[k] = storedValue(v)
+	}
+	state[key] = storedValue(value)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	s.state[key] = value
+	return nil
+}
+
+// storedValue returns x with float64 values as json.Number with a
+// decimal point or exponent, so that 42.0 is not loaded as int 42
+func storedValue(x interface{}) interface{} {
+	switch v := x.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return v
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return json.Number(s)
+	case []float64:
+		values := make([]interface{}, len(v))
+		for i, f := range v {
+			values[i] = storedValue(f)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = storedValue(value)
+		}
+		return values
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for k, value := range v {
+			values[k] = storedValue(value)
+		}
+		return values
+	}
+	return x
+}
+
+// loadedValue returns x with the json.Numbers of storedValue() as int
+// or float64
+func loadedValue(x interface{}) interface{} {
+	switch v := x.(type) {
+	case json.Number:
+		if !strings.ContainsAny(string(v), ".eE") {
+			if i, err := strconv.Atoi(string(v)); err == nil {
+				return i
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = loadedValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = loadedValue(v[k])
+		}
+	}
+	return x
+}
@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	if _, ok := s.Get("a"); ok {
+		t.Errorf("expected a to be missing")
+	}
+	_ = s.Set("a", 1.0)
+	snapshot := s.Snapshot()
+	_ = s.Set("a", 2.0)
+	if v, ok := s.Get("a"); !ok || v != 2.0 {
+		t.Errorf("expected 2 but got %v, %v", v, ok)
+	}
+	if snapshot["a"] != 1.0 {
+		t.Errorf("expected the snapshot to be a copy but got %v", snapshot["a"])
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	run := func(input string) interface{} {
+		store, err := NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := NewEnvironment().StateStore(store).Run(MustCompile(input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	// every run uses a new FileStore reading the state of the last one
+	for i, want := range []float64{1, 2, 3} {
+		if result := run(`counterInc("restarts")`); result != want {
+			t.Errorf("%d: expected %v but got %v", i, want, result)
+		}
+	}
+	for i, want := range []bool{true, true, false} {
+		if result := run(`throttle("mail", 2, 3600)`); result != want {
+			t.Errorf("%d: expected %v but got %v", i, want, result)
+		}
+	}
+	if result := run(`cache("x", 3600, 42)`); result != 42 {
+		t.Errorf("expected 42 but got %v", result)
+	}
+	// numbers keep their type
+	if result := run(`cache("x", 3600, 43)`); result != 42 {
+		t.Errorf("expected the cached 42 but got %v (%T)", result, result)
+	}
+	if result := run(`cache("f", 3600, 2.0) + cache("g", 3600, 1e300)`); result != 2.0+1e300 {
+		t.Errorf("expected 2+1e300 but got %v", result)
+	}
+	if result := run(`cache("f", 3600, 0)`); result != 2.0 {
+		t.Errorf("expected the cached 2.0 but got %v (%T)", result, result)
+	}
+	if result := run(`rollingMax("r", 1.5, 3600) + rollingMax("r", 0.5, 3600)`); result != 3.0 {
+		t.Errorf("expected 3 but got %v", result)
+	}
+
+	// NaN is no change and not kept, other values are written further on
+	if result := run(`changed("t", 1.5) || changed("t", float64("n/a")) || changed("t", 1.5)`); result != false {
+		t.Errorf("expected no change but got %v", result)
+	}
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("nan", math.NaN()); err == nil {
+		t.Errorf("expected an error for NaN")
+	}
+	if _, ok := s.Get("nan"); ok {
+		t.Errorf("expected NaN not to be kept")
+	}
+	if err := s.Set("counter:ok", 1.0); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if result := run(`counterGet("restarts") + cache("f", 3600, 0) + counterInc("ok")`); result != 7.0 {
+		t.Errorf("expected 7 but got %v", result)
+	}
+
+	// a broken file is reported
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Errorf("expected an error for a broken file")
+	}
+
+	// a failing write is reported by the run
+	store, _ := NewFileStore(filepath.Join(t.TempDir(), "missing", "state.json"))
+	e := New(`counterInc("n")`).StateStore(store)
+	_ = e.ParseExpr()
+	if result := e.Run(); result != 1.0 || e.err == nil {
+		t.Errorf("expected 1 and an error but got %v, %v", result, e.err)
+	}
+}
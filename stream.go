@@ -0,0 +1,120 @@
+package eval
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Decoder splits a stream into records, see Stream()
+type Decoder interface {
+	// NewReader returns a RecordReader reading records from r
+	NewReader(r io.Reader) RecordReader
+}
+
+// RecordReader reads one record after the other
+type RecordReader interface {
+	// Read returns the next record as variables or io.EOF
+	// after the last record
+	Read() (map[string]interface{}, error)
+}
+
+// Stream evaluates input for every record decoded from r and calls fn
+// with the result. Only one record is held in memory at a time, so
+// Stream is a building block for log and metric pipelines:
+//
+//  err := eval.Stream(os.Stdin, eval.JSONLines{}, `cpu > 90`, func(result interface{}) {
+//  	fmt.Println(result)
+//  })
+//
+// It returns the parser error of input or the first error of the
+// decoder. Errors while running input don't stop the stream.
+func Stream(r io.Reader, decoder Decoder, input string, fn func(result interface{})) error {
+	c, err := Compile(input)
+	if err != nil {
+		return err
+	}
+	records := decoder.NewReader(r)
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		result, _ := c.Run(record)
+		fn(result)
+	}
+}
+
+// JSONLines decodes a stream of JSON objects, one per line.
+// Numbers are float64 values.
+type JSONLines struct{}
+
+// NewReader returns a RecordReader of JSON objects
+func (JSONLines) NewReader(r io.Reader) RecordReader {
+	return jsonLinesReader{json.NewDecoder(r)}
+}
+
+type jsonLinesReader struct {
+	d *json.Decoder
+}
+
+func (r jsonLinesReader) Read() (map[string]interface{}, error) {
+	var record map[string]interface{}
+	if err := r.d.Decode(&record); err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("JSONLines: null is no object")
+	}
+	return record, nil
+}
+
+// CSV decodes comma separated values. The first line holds the names
+// of the variables, numeric fields are float64 values.
+type CSV struct {
+	// Comma is the field delimiter, ',' when not set
+	Comma rune
+}
+
+// NewReader returns a RecordReader of CSV lines
+func (d CSV) NewReader(r io.Reader) RecordReader {
+	c := csv.NewReader(r)
+	if d.Comma != 0 {
+		c.Comma = d.Comma
+	}
+	c.ReuseRecord = true
+	return &csvReader{r: c}
+}
+
+type csvReader struct {
+	r     *csv.Reader
+	names []string
+}
+
+func (r *csvReader) Read() (map[string]interface{}, error) {
+	if r.names == nil {
+		header, err := r.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		r.names = append([]string(nil), header...)
+	}
+	fields, err := r.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	record := make(map[string]interface{}, len(r.names))
+	for i, name := range r.names {
+		if f := toFloat(fields[i]); !math.IsNaN(f) {
+			record[name] = f
+		} else {
+			record[name] = fields[i]
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		decoder Decoder
+		expr    string
+		want    []interface{}
+	}{
+		{
+			name:    "JSONLines",
+			input:   "{\"host\":\"a\",\"cpu\":95}\n{\"host\":\"b\",\"cpu\":12.5}\n\n{\"host\":\"c\"}\n",
+			decoder: JSONLines{},
+			expr:    `cpu > 90`,
+			want:    []interface{}{true, false, false},
+		},
+		{
+			name:    "CSV",
+			input:   "host,cpu\na,95\nb,12.5\n",
+			decoder: CSV{},
+			expr:    `sprintf("%s:%.1f", host, cpu)`,
+			want:    []interface{}{"a:95.0", "b:12.5"},
+		},
+		{
+			name:    "CSV with semicolon",
+			input:   "host;cpu\na;95\n",
+			decoder: CSV{Comma: ';'},
+			expr:    `cpu * 2`,
+			want:    []interface{}{190.0},
+		},
+		{
+			name:    "state is kept between records",
+			input:   "host\na\na\nb\n",
+			decoder: CSV{},
+			expr:    `changed("host", host) || counterInc("n") > 2`,
+			want:    []interface{}{false, false, true},
+		},
+		{
+			name:    "empty",
+			input:   "",
+			decoder: CSV{},
+			expr:    `cpu`,
+		},
+	} {
+		var got []interface{}
+		err := Stream(strings.NewReader(tc.input), tc.decoder, tc.expr, func(result interface{}) {
+			got = append(got, result)
+		})
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(got) != len(tc.want) {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("%s: expected %v but got %v", tc.name, tc.want, got)
+				break
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		input   string
+		decoder Decoder
+		expr    string
+	}{
+		{"{}", JSONLines{}, `1 +`},
+		{"{\"cpu\":1}\n{broken", JSONLines{}, `cpu`},
+		{"null", JSONLines{}, `cpu`},
+		{"a,b\n1\n", CSV{}, `a`},
+	} {
+		calls := 0
+		err := Stream(strings.NewReader(tc.input), tc.decoder, tc.expr, func(result interface{}) { calls++ })
+		if err == nil {
+			t.Errorf("%q: expected an error", tc.input)
+		}
+		if calls > 1 {
+			t.Errorf("%q: unexpected %d calls", tc.input, calls)
+		}
+	}
+}
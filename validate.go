@@ -0,0 +1,429 @@
+package eval
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidationError is a problem found by Validate at a position of the input
+type ValidationError struct {
+	// Line and Column of the problem, both start at 1
+	Line, Column int
+	Msg          string
+	// Err is the cause like ErrUnknownFunction or ErrArity, it is nil
+	// for other problems
+	Err error
+}
+
+// Error returns "line:column: message"
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("%d:%d: %s", v.Line, v.Column, v.Msg)
+}
+
+// Unwrap returns the cause
+func (v *ValidationError) Unwrap() error {
+	return v.Err
+}
+
+// Validate checks the expression without running it and returns the
+// problems found as ValidationErrors in the order of their positions:
+// calls of unknown functions like rund(3.14,2), of builtins which are
+// not allowed, see AllowFunctions(), wrong numbers of
+// arguments, arguments of obviously wrong types like sqrt("abc") and
+// sprintf formats which don't match their arguments. Functions of an
+// Environment are unknown to Validate, register them with
+// RegisterFunction. The input is parsed when ParseExpr was not called
+// before, a parser error is returned as it is.
+func (e *Eval) Validate() []error {
+	if e.exp == nil {
+		if err := e.ParseExpr(); err != nil {
+			return []error{err}
+		}
+	}
+	var errs []error
+	ast.Inspect(e.exp, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || call.Fun == sequence {
+			return true
+		}
+		name := functionName(call.Fun)
+		if _, ok := e.functions[name]; ok {
+			return true
+		}
+		if _, ok := registeredFunction(name); ok {
+			return true
+		}
+		builtin := resolveName(name)
+		a, ok := builtins[builtin]
+		if !ok {
+			errs = append(errs, e.validationError(call.Pos(), name+": "+ErrUnknownFunction.Error(), ErrUnknownFunction))
+			return true
+		}
+		if !e.permitted(builtin) {
+			errs = append(errs, e.validationError(call.Pos(), name+": "+ErrNotAllowed.Error(), ErrNotAllowed))
+			return true
+		}
+		// the number of arguments spread from a slice is known when running
+		spread := call.Ellipsis.IsValid()
+		if !spread && !a.accepts(len(call.Args)) {
+			msg := fmt.Sprintf("%s: %v, %d instead of %v", name, ErrArity, len(call.Args), a)
+			errs = append(errs, e.validationError(call.Pos(), msg, ErrArity))
+			return true
+		}
+		args := call.Args
+		if spread {
+			args = args[:len(args)-1]
+		}
+		for i, want := range paramKinds[builtin] {
+			if i < len(args) && !paramAccepts(want, args[i]) {
+				msg := fmt.Sprintf("%s: argument %d is no %s", name, i+1, kindNames[want])
+				errs = append(errs, e.validationError(call.Args[i].Pos(), msg, nil))
+			}
+		}
+		switch builtin {
+		case "sprintf":
+			if msg := checkSprintf(call); msg != "" {
+				errs = append(errs, e.validationError(call.Pos(), "sprintf: "+msg, nil))
+			}
+		}
+		return true
+	})
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].(*ValidationError), errs[j].(*ValidationError)
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return errs
+}
+
+// validationError returns a ValidationError at pos of the input
+func (e *Eval) validationError(pos token.Pos, msg string, cause error) error {
+	// parser.ParseExpr starts the positions at 1
+	offset := int(pos) - 1
+	if offset < 0 || offset > len(e.input) {
+		offset = 0
+	}
+	line := strings.Count(e.input[:offset], "\n") + 1
+	column := offset - strings.LastIndex(e.input[:offset], "\n")
+	return &ValidationError{Line: line, Column: column, Msg: msg, Err: cause}
+}
+
+// paramKinds lists the parameters of builtins which take a number
+// (kindFloat) or a string, kindUnknown parameters are not checked
+var paramKinds = map[string][]kind{
+	"abs":                  {kindFloat},
+	"acos":                 {kindFloat},
+	"almostEqual":          {kindFloat, kindFloat, kindFloat},
+	"altitudeFromPressure": {kindFloat, kindFloat},
+	"apparentTemp":         {kindFloat, kindFloat, kindFloat},
+	"asin":                 {kindFloat},
+	"atan":                 {kindFloat},
+	"atan2":                {kindFloat, kindFloat},
+	"backoffDue":           {kindString, kindFloat, kindFloat, kindFloat},
+	"businessDaysBetween":  {kindFloat, kindFloat, kindString, kindString},
+	"cache":                {kindString, kindFloat},
+	"camelCase":            {kindString},
+	"ceil":                 {kindFloat, kindFloat},
+	"changed":              {kindString},
+	"clamp":                {kindFloat, kindFloat, kindFloat},
+	"cos":                  {kindFloat},
+	"counterGet":           {kindString},
+	"counterInc":           {kindString, kindFloat},
+	"csvField":             {kindString, kindFloat, kindString},
+	"deg2rad":              {kindFloat},
+	"dewPoint":             {kindFloat, kindFloat},
+	"ellipsis":             {kindString, kindFloat},
+	"env":                  {kindString},
+	"exists":               {kindString},
+	"flapCount":            {kindString, kindUnknown, kindFloat},
+	"floor":                {kindFloat, kindFloat},
+	"fuzzyMatch":           {kindString, kindString, kindFloat},
+	"globMatch":            {kindString, kindString},
+	"hashBucket":           {kindUnknown, kindFloat},
+	"heatIndex":            {kindFloat, kindFloat},
+	"hmacSha256":           {kindString, kindString},
+	"htmlEscape":           {kindString},
+	"htmlUnescape":         {kindString},
+	"isEmail":              {kindString},
+	"isURL":                {kindString},
+	"jsonType":             {kindString, kindString},
+	"jsonValid":            {kindString},
+	"jwtClaim":             {kindString, kindString, kindString},
+	"kebabCase":            {kindString},
+	"kvGet":                {kindString, kindString},
+	"levenshtein":          {kindString, kindString},
+	"lineCount":            {kindString},
+	"lookupTable":          {kindString},
+	"metaphone":            {kindString},
+	"mod":                  {kindFloat, kindFloat},
+	"money":                {kindFloat, kindString, kindString},
+	"normalize":            {kindFloat, kindFloat, kindFloat},
+	"normalizeSpace":       {kindString},
+	"not":                  {kindBool},
+	"parseTime":            {kindString, kindString},
+	"pctChange":            {kindFloat, kindFloat, kindFloat},
+	"plural":               {kindFloat, kindString, kindString},
+	"pow":                  {kindFloat, kindFloat},
+	"previous":             {kindString},
+	"queryParam":           {kindString, kindString},
+	"rad2deg":              {kindFloat},
+	"random":               {kindFloat},
+	"regexpMatch":          {kindString, kindString},
+	"result":               {kindUnknown, kindString, kindUnknown, kindString},
+	"rollingMax":           {kindString, kindUnknown, kindFloat},
+	"rollingMin":           {kindString, kindUnknown, kindFloat},
+	"round":                {kindFloat, kindFloat},
+	"seaLevelPressure":     {kindFloat, kindFloat},
+	"setEnv":               {kindString},
+	"sin":                  {kindFloat},
+	"snakeCase":            {kindString},
+	"soundex":              {kindString},
+	"sqrt":                 {kindFloat},
+	"startOfDay":           {kindUnknown, kindString},
+	"startOfHour":          {kindUnknown, kindString},
+	"startOfMonth":         {kindUnknown, kindString},
+	"stripAnsi":            {kindString},
+	"stripControl":         {kindString},
+	"substr":               {kindString, kindFloat, kindFloat},
+	"tan":                  {kindFloat},
+	"tariff":               {kindFloat, kindString},
+	"throttle":             {kindString, kindFloat, kindFloat},
+	"titleCase":            {kindString},
+	"translate":            {kindString},
+	"trunc":                {kindFloat, kindFloat},
+	"val":                  {kindString},
+	"valOr":                {kindString, kindUnknown},
+	"windChill":            {kindFloat, kindFloat},
+	"wordCount":            {kindString},
+	"xmlGet":               {kindString, kindString},
+}
+
+// kindNames names the kinds of parameters in messages
+var kindNames = map[kind]string{
+	kindBool:   "bool",
+	kindFloat:  "number",
+	kindString: "string",
+}
+
+// paramAccepts reports whether arg may be passed to a parameter of kind
+// want. Numbers reject bools and string literals which are no numbers,
+// strings reject numbers and bools, bools reject numbers and strings.
+func paramAccepts(want kind, arg ast.Expr) bool {
+	k := staticKind(arg)
+	switch want {
+	case kindFloat:
+		if s, ok := constantString(arg); ok {
+			return !math.IsNaN(toNumber(s))
+		}
+		return k != kindBool
+	case kindString:
+		return k == kindString || k == kindUnknown
+	case kindBool:
+		return k == kindBool || k == kindUnknown
+	}
+	return true
+}
+
+// checkSprintf compares the verbs of a constant format with the number
+// and the types of the arguments, it returns a message for the first
+// mismatch or ""
+func checkSprintf(call *ast.CallExpr) string {
+	if len(call.Args) == 0 {
+		return "missing format"
+	}
+	format, ok := constantString(call.Args[0])
+	if !ok {
+		return ""
+	}
+	args := call.Args[1:]
+	n := 0 // arguments used
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		// flags, width and precision, '*' takes an int argument
+		for ; i < len(format) && strings.IndexByte("+-# 0123456789.*", format[i]) >= 0; i++ {
+			if format[i] == '*' {
+				if n >= len(args) {
+					return "missing argument for *"
+				}
+				if k := staticKind(args[n]); k != kindInt && k != kindUnknown {
+					return fmt.Sprintf("argument %d for * is no int", n+2)
+				}
+				n++
+			}
+		}
+		if i == len(format) {
+			return "format ends with %"
+		}
+		verb := format[i]
+		switch verb {
+		case '%':
+			continue
+		case '[':
+			// explicit argument indexes are not checked
+			return ""
+		}
+		if n >= len(args) {
+			return fmt.Sprintf("missing argument for %%%c", verb)
+		}
+		if !verbAccepts(verb, staticKind(args[n])) {
+			return fmt.Sprintf("%%%c doesn't match argument %d", verb, n+2)
+		}
+		n++
+	}
+	if n < len(args) {
+		return fmt.Sprintf("%d extra arguments", len(args)-n)
+	}
+	return ""
+}
+
+// verbAccepts reports whether a fmt verb formats values of kind k
+func verbAccepts(verb byte, k kind) bool {
+	if k == kindUnknown || verb == 'v' {
+		return true
+	}
+	switch verb {
+	case 'd', 'b', 'o', 'O', 'c', 'U':
+		return k == kindInt
+	case 'x', 'X':
+		return k == kindInt || k == kindFloat || k == kindString
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		return k == kindFloat
+	case 's', 'q':
+		return k == kindString
+	case 't':
+		return k == kindBool
+	}
+	return false
+}
+
+// resultKinds lists the result of builtins which always
+// return the same kind of value
+var resultKinds = map[string]kind{
+	"abs":                  kindFloat,
+	"acos":                 kindFloat,
+	"almostEqual":          kindBool,
+	"altitudeFromPressure": kindFloat,
+	"apparentTemp":         kindFloat,
+	"asin":                 kindFloat,
+	"atan":                 kindFloat,
+	"atan2":                kindFloat,
+	"avg":                  kindFloat,
+	"backoffDue":           kindBool,
+	"camelCase":            kindString,
+	"ceil":                 kindFloat,
+	"changed":              kindBool,
+	"clamp":                kindFloat,
+	"cos":                  kindFloat,
+	"count":                kindInt,
+	"counterGet":           kindFloat,
+	"counterInc":           kindFloat,
+	"csvLine":              kindString,
+	"deg2rad":              kindFloat,
+	"dewPoint":             kindFloat,
+	"ellipsis":             kindString,
+	"env":                  kindString,
+	"exists":               kindBool,
+	"flapCount":            kindFloat,
+	"float64":              kindFloat,
+	"floor":                kindFloat,
+	"fuzzyMatch":           kindBool,
+	"globMatch":            kindBool,
+	"heatIndex":            kindFloat,
+	"hmacSha256":           kindString,
+	"htmlEscape":           kindString,
+	"htmlUnescape":         kindString,
+	"isEmail":              kindBool,
+	"isNaN":                kindBool,
+	"isURL":                kindBool,
+	"jsonValid":            kindBool,
+	"kebabCase":            kindString,
+	"len":                  kindInt,
+	"luhnValid":            kindBool,
+	"max":                  kindFloat,
+	"min":                  kindFloat,
+	"mod97Valid":           kindBool,
+	"money":                kindString,
+	"normalize":            kindFloat,
+	"normalizeSpace":       kindString,
+	"not":                  kindBool,
+	"num":                  kindFloat,
+	"parseTime":            kindFloat,
+	"pctChange":            kindFloat,
+	"pow":                  kindFloat,
+	"rad2deg":              kindFloat,
+	"regexpMatch":          kindBool,
+	"round":                kindFloat,
+	"score":                kindFloat,
+	"seaLevelPressure":     kindFloat,
+	"sin":                  kindFloat,
+	"snakeCase":            kindString,
+	"sqrt":                 kindFloat,
+	"stripAnsi":            kindString,
+	"stripControl":         kindString,
+	"substr":               kindString,
+	"sum":                  kindFloat,
+	"tan":                  kindFloat,
+	"tariff":               kindFloat,
+	"throttle":             kindBool,
+	"titleCase":            kindString,
+	"translate":            kindString,
+	"trunc":                kindFloat,
+	"uuid":                 kindString,
+	"wavg":                 kindFloat,
+	"windChill":            kindFloat,
+}
+
+// staticKind returns the kind of value exp results in when it is
+// known without running it, otherwise kindUnknown
+func staticKind(exp ast.Expr) kind {
+	switch exp := exp.(type) {
+	case *ast.ParenExpr:
+		return staticKind(exp.X)
+	case *ast.BasicLit:
+		switch exp.Kind {
+		case token.INT:
+			return kindInt
+		case token.FLOAT:
+			return kindFloat
+		case token.STRING:
+			return kindString
+		}
+	case *ast.Ident:
+		if exp.Name == "true" || exp.Name == "false" {
+			return kindBool
+		}
+	case *ast.UnaryExpr:
+		if exp.Op == token.NOT {
+			return kindBool
+		}
+		if k := staticKind(exp.X); k == kindInt || k == kindFloat {
+			return k
+		}
+	case *ast.BinaryExpr:
+		switch exp.Op {
+		case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ, token.LAND, token.LOR:
+			return kindBool
+		case token.QUO:
+			return kindFloat
+		case token.ADD, token.SUB, token.MUL, token.REM:
+			l, r := staticKind(exp.X), staticKind(exp.Y)
+			switch {
+			case l == kindInt && r == kindInt:
+				return kindInt
+			case (l == kindInt || l == kindFloat) && (r == kindInt || r == kindFloat):
+				return kindFloat
+			}
+		}
+	case *ast.CallExpr:
+		if k, ok := resultKinds[resolveName(functionName(exp.Fun))]; ok {
+			return k
+		}
+	}
+	return kindUnknown
+}
@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateSprintf(t *testing.T) {
+	var ok = []string{
+		`sprintf("%s %.3f", text, pi*n)`,
+		`sprintf("%d%% of %s", 5, "disk")`,
+		`sprintf("%.2f", round(x, 2)) + sprintf("%v", 1)`,
+		`sprintf("%*d", 5, 42)`,
+		`sprintf("%t", a > b)`,
+		`sprintf("%x", "abc")`,
+		`sprintf("%[2]s %[1]s", "a", "b")`,
+		`sprintf(format, 1, 2)`,
+		`sprintf("no verbs")`,
+	}
+	for _, s := range ok {
+		if errs := New(s).Validate(); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors %v", s, errs)
+		}
+	}
+
+	var wrong = map[string]string{
+		`sprintf("%s %s", "a")`:                `1:1: sprintf: missing argument for %s`,
+		`sprintf("%s", "a", 1)`:                `1:1: sprintf: 1 extra arguments`,
+		`sprintf("%.2f", 5)`:                   `1:1: sprintf: %f doesn't match argument 2`,
+		`sprintf("%d", 2.5)`:                   `1:1: sprintf: %d doesn't match argument 2`,
+		`sprintf("%d", 1/2)`:                   `1:1: sprintf: %d doesn't match argument 2`,
+		`sprintf("%s", sqrt(2))`:               `1:1: sprintf: %s doesn't match argument 2`,
+		`sprintf("%t", "true")`:                `1:1: sprintf: %t doesn't match argument 2`,
+		`sprintf("100%")`:                      `1:1: sprintf: format ends with %`,
+		`sprintf("%*d", "5", 1)`:               `1:1: sprintf: argument 2 for * is no int`,
+		`sprintf()`:                            `1:1: sprintf: wrong number of arguments, 0 instead of at least 1`,
+		"1 +\n  str.sprintf(\"%d\", 1.5)":      `2:3: sprintf: %d doesn't match argument 2`,
+		`ifExpr(x, "", sprintf("%s %s", "a"))`: `1:15: sprintf: missing argument for %s`,
+	}
+	for s, want := range wrong {
+		errs := New(s).Validate()
+		if len(errs) != 1 || errs[0].Error() != want {
+			t.Errorf("%s: expected %q but got %v", s, want, errs)
+		}
+	}
+
+	if errs := New("1 +").Validate(); len(errs) != 1 {
+		t.Errorf("expected the parser error but got %v", errs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	RegisterFunction("testValidate", func(args ...interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	defer func() {
+		functionsMu.Lock()
+		delete(functions, "testValidate")
+		functionsMu.Unlock()
+	}()
+	var ok = []string{
+		`round(pow(val("r"), 2) * pi, 0)`,
+		`sqrt("16") + abs(x) + math.sqrt(2)`,
+		`substr(name, 0, 3) + substr(sprintf("%d", n), 0, 1)`,
+		`testValidate(1, 2, 3) + local("x")`,
+		`setVal("a", 1); ifExpr(a > 0, "yes", "no")`,
+		`avg(1, 2, 3, "x")`,
+	}
+	for _, s := range ok {
+		e := New(s).RegisterFunction("local", func(args ...interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		if errs := e.Validate(); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors %v", s, errs)
+		}
+	}
+
+	var wrong = map[string][]string{
+		`rund(3.14, 2)`:                {`1:1: rund: unknown function`},
+		`1 + math.rund(2)`:             {`1:5: math.rund: unknown function`},
+		`sqrt(16, 2)`:                  {`1:1: sqrt: wrong number of arguments, 2 instead of 1`},
+		`isBetween(1, 2)`:              {`1:1: isBetween: wrong number of arguments, 2 instead of 3 to 4`},
+		`sqrt("abc")`:                  {`1:6: sqrt: argument 1 is no number`},
+		`round(x, true)`:               {`1:10: round: argument 2 is no number`},
+		`substr(123, 0, "a")`:          {`1:8: substr: argument 1 is no string`, `1:16: substr: argument 3 is no number`},
+		`titleCase(1 + 2)`:             {`1:11: titleCase: argument 1 is no string`},
+		`not(1) && not(!up)`:           {`1:5: not: argument 1 is no bool`},
+		"sqrt(x) +\n  foo(sqrt(1, 2))": {`2:3: foo: unknown function`, `2:7: sqrt: wrong number of arguments, 2 instead of 1`},
+		`abs(wordCount(5, 1))`:         {`1:5: wordCount: wrong number of arguments, 2 instead of 1`},
+	}
+	for s, want := range wrong {
+		errs := New(s).Validate()
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: expected %q but got %q", s, want, got)
+		}
+	}
+
+	errs := New(`rund(1) + sqrt()`).Validate()
+	if len(errs) != 2 || !errors.Is(errs[0], ErrUnknownFunction) || !errors.Is(errs[1], ErrArity) {
+		t.Errorf("expected ErrUnknownFunction and ErrArity but got %v", errs)
+	}
+}